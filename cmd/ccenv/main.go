@@ -6,9 +6,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/imty42/claude-code-env/internal/admin"
 	"github.com/imty42/claude-code-env/internal/config"
 	"github.com/imty42/claude-code-env/internal/executor"
+	"github.com/imty42/claude-code-env/internal/llm_proxy"
 	"github.com/spf13/cobra"
 )
 
@@ -27,25 +30,32 @@ var rootCmd = &cobra.Command{
 	},
 }
 
-// startCmd 启动代理服务命令
-var startCmd = &cobra.Command{
-	Use:   "start",
-	Short: "启动透明代理服务（前台运行）",
-	Long:  "启动透明代理服务，用于测试。服务将在前台运行，按 Ctrl+C 可停止服务。",
-	Run: func(cmd *cobra.Command, args []string) {
-		// 检查配置文件
-		if err := ensureConfig(); err != nil {
-			fmt.Printf("配置错误: %v\n", err)
-			os.Exit(1)
-		}
+// createStartCmd 创建启动代理服务命令
+func createStartCmd() *cobra.Command {
+	var debugWire bool
 
-		// 启动代理服务（前台运行）
-		err := executor.StartProxyService()
-		if err != nil {
-			fmt.Printf("启动代理服务失败: %v\n", err)
-			os.Exit(1)
-		}
-	},
+	startCmd := &cobra.Command{
+		Use:   "start",
+		Short: "启动透明代理服务（前台运行）",
+		Long:  "启动透明代理服务，用于测试。服务将在前台运行，按 Ctrl+C 可停止服务。",
+		Run: func(cmd *cobra.Command, args []string) {
+			// 检查配置文件
+			if err := ensureConfig(); err != nil {
+				fmt.Printf("配置错误: %v\n", err)
+				os.Exit(1)
+			}
+
+			// 启动代理服务（前台运行）
+			err := executor.StartProxyService(debugWire)
+			if err != nil {
+				fmt.Printf("启动代理服务失败: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	startCmd.Flags().BoolVar(&debugWire, "debug-wire", false, "记录每个请求的原始请求、上游请求和响应到 ~/.claude-code-env/wire")
+	return startCmd
 }
 
 // codeCmd 启动 claude code 命令
@@ -76,69 +86,341 @@ var codeCmd = &cobra.Command{
 	DisableFlagParsing: true, // 禁用标志解析，允许参数透传
 }
 
-// logsCmd 查看日志命令
-var logsCmd = &cobra.Command{
-	Use:   "logs [options...]",
-	Short: "查看日志文件",
-	Long: `查看代理服务的日志文件，支持所有 tail 命令的参数。
+// createConfigCmd 创建显示配置命令
+func createConfigCmd() *cobra.Command {
+	var options executor.ConfigOptions
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "显示当前配置文件信息",
+		Long: `显示当前的配置文件信息和状态，并预览请求的路由结果。
+不指定示例请求时预览常见请求和为每条路由规则生成的请求，指定任一示例请求参数时只预览该请求。
 
 示例:
-  ccenv logs                    # 查看最近的日志
-  ccenv logs -f                 # 实时跟踪日志
-  ccenv logs -n 50              # 查看最后50行日志`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// 检查配置文件
-		if err := ensureConfig(); err != nil {
-			fmt.Printf("配置错误: %v\n", err)
-			os.Exit(1)
-		}
+  ccenv config                                   # 显示配置和默认的路由预览
+  ccenv config --model claude-opus-4-20250514 --thinking --tokens 120000
+  ccenv config --header X-Team=infra --tools`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, name := range []string{"model", "header", "tokens", "tools", "images", "thinking"} {
+				if cmd.Flags().Changed(name) {
+					options.Sample = true
+				}
+			}
+
+			// 显示配置信息
+			err := executor.ShowConfig(options)
+			if err != nil {
+				fmt.Printf("显示配置失败: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	flags := configCmd.Flags()
+	flags.StringVar(&options.Model, "model", "claude-sonnet-4-20250514", "示例请求的模型")
+	flags.StringArrayVar(&options.Headers, "header", nil, "示例请求的请求头，格式为 key=value，可重复指定")
+	flags.IntVar(&options.Tokens, "tokens", 2000, "示例请求估算的输入 token 数")
+	flags.BoolVar(&options.Tools, "tools", false, "示例请求携带 tools")
+	flags.BoolVar(&options.Images, "images", false, "示例请求包含图片")
+	flags.BoolVar(&options.Thinking, "thinking", false, "示例请求开启 thinking")
+
+	return configCmd
+}
+
+// createLogsCmd 创建查看日志命令
+func createLogsCmd() *cobra.Command {
+	var options executor.LogsOptions
+
+	logsCmd := &cobra.Command{
+		Use:   "logs",
+		Short: "查看和过滤日志",
+		Long: `查看代理服务的日志，按时间顺序读取包括轮转文件（含 .gz）在内的全部日志，支持文本和 JSON 格式。
+
+示例:
+  ccenv logs                           # 查看最后 10 条日志
+  ccenv logs -f                        # 实时跟踪日志
+  ccenv logs -n 50 --level warn        # 查看最后 50 条 WARN 及以上级别的日志
+  ccenv logs --request a1b2c3d4        # 查看某个请求的全部日志
+  ccenv logs --provider siliconflow --since 2h --grep 429
+  ccenv logs --stats --since 1d        # 按 provider 统计请求数、错误率和延迟分位数`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			// 检查配置文件
+			if err := ensureConfig(); err != nil {
+				fmt.Printf("配置错误: %v\n", err)
+				os.Exit(1)
+			}
+
+			// 按请求ID查看时默认显示该请求的全部日志
+			if options.Request != "" && !cmd.Flags().Changed("lines") {
+				options.Lines = 0
+			}
+
+			if err := executor.ShowLogs(options); err != nil {
+				fmt.Printf("显示日志失败: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
 
-		// 显示日志，支持所有 tail 参数
-		err := executor.ShowLogs(args)
+	flags := logsCmd.Flags()
+	flags.IntVarP(&options.Lines, "lines", "n", 10, "显示最后多少条匹配的日志，0 表示全部")
+	flags.BoolVarP(&options.Follow, "follow", "f", false, "持续跟踪新写入的日志")
+	flags.StringVar(&options.Level, "level", "", "最低日志级别: DEBUG, INFO, WARN, ERROR")
+	flags.StringSliceVar(&options.Modules, "module", nil, "模块名，可用逗号分隔多个，如 PROXY,PROVIDER")
+	flags.StringVar(&options.Provider, "provider", "", "provider 名称")
+	flags.StringVar(&options.Request, "request", "", "请求ID")
+	flags.StringVar(&options.Since, "since", "", "起始时间，如 30m、2h、7d、2025-06-01、\"2025-06-01 10:00\"")
+	flags.StringVar(&options.Until, "until", "", "结束时间，格式同 --since")
+	flags.StringVar(&options.Grep, "grep", "", "匹配日志行的正则表达式")
+	flags.StringVar(&options.Color, "color", "auto", "按级别着色: auto, always, never")
+	flags.BoolVar(&options.Stats, "stats", false, "按 provider 统计请求数、错误数和延迟分位数")
+	logsCmd.MarkFlagsMutuallyExclusive("stats", "follow")
+
+	logsCmd.RegisterFlagCompletionFunc("level", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"DEBUG", "INFO", "WARN", "ERROR"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	logsCmd.RegisterFlagCompletionFunc("module", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"PROXY", "CONFIG", "EXECUTOR", "SERVER", "PROVIDER", "BUDGET"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	logsCmd.RegisterFlagCompletionFunc("color", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"auto", "always", "never"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	logsCmd.RegisterFlagCompletionFunc("provider", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		cfg, err := config.LoadConfig()
 		if err != nil {
-			fmt.Printf("显示日志失败: %v\n", err)
-			os.Exit(1)
+			return nil, cobra.ShellCompDirectiveNoFileComp
 		}
-	},
-	DisableFlagParsing: true, // 禁用标志解析，允许参数透传
-	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		// 为 logs 命令提供 tail 命令的常用参数补全
-		var suggestions []string
-
-		// 根据输入情况提供不同的补全建议
-		if len(args) == 0 || toComplete == "-" {
-			// 提供主要的 tail 选项
-			suggestions = []string{
-				"-f",
-				"-n",
-				"-c",
-				"--help",
+		var names []string
+		for _, p := range cfg.Providers {
+			names = append(names, p.Name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return logsCmd
+}
+
+// createUsageCmd 创建用量报表命令
+func createUsageCmd() *cobra.Command {
+	var options executor.UsageOptions
+	var jsonOutput, csvOutput bool
+
+	usageCmd := &cobra.Command{
+		Use:   "usage",
+		Short: "查看请求用量和费用报表",
+		Long: `汇总代理记录的请求用量（~/.claude-code-env/usage.jsonl），按维度统计 token 和费用。
+
+示例:
+  ccenv usage                          # 按天汇总全部记录
+  ccenv usage --since 7d --by provider # 最近 7 天按 provider 汇总
+  ccenv usage --since 2025-06-01 --by model --csv > usage.csv`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Format = "table"
+			if jsonOutput {
+				options.Format = "json"
+			} else if csvOutput {
+				options.Format = "csv"
 			}
-		} else if len(args) > 0 {
-			lastArg := args[len(args)-1]
-			if lastArg == "-n" || lastArg == "-c" {
-				// 为 -n 和 -c 参数提供常用数字
-				suggestions = []string{"10", "20", "50", "100", "200", "500"}
+
+			if err := executor.ShowUsage(options); err != nil {
+				fmt.Printf("查看用量失败: %v\n", err)
+				os.Exit(1)
 			}
-		}
+		},
+	}
 
-		return suggestions, cobra.ShellCompDirectiveNoFileComp
-	},
+	usageCmd.Flags().StringVar(&options.Since, "since", "", "起始时间，如 24h、7d、2025-06-01")
+	usageCmd.Flags().StringVar(&options.By, "by", "day", "分组维度: day, provider, model, session")
+	usageCmd.Flags().BoolVar(&jsonOutput, "json", false, "以 JSON 格式输出")
+	usageCmd.Flags().BoolVar(&csvOutput, "csv", false, "以 CSV 格式输出")
+	usageCmd.MarkFlagsMutuallyExclusive("json", "csv")
+	usageCmd.RegisterFlagCompletionFunc("by", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"day", "provider", "model", "session"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return usageCmd
 }
 
-// configCmd 显示配置命令
-var configCmd = &cobra.Command{
-	Use:   "config",
-	Short: "显示当前配置文件信息",
-	Long:  "显示当前的配置文件信息和状态。",
-	Run: func(cmd *cobra.Command, args []string) {
-		// 显示配置信息
-		err := executor.ShowConfig()
-		if err != nil {
-			fmt.Printf("显示配置失败: %v\n", err)
-			os.Exit(1)
+// createProviderCmd 创建 provider 运行时控制命令
+func createProviderCmd() *cobra.Command {
+	var persist bool
+	var duration time.Duration
+
+	providerCmd := &cobra.Command{
+		Use:   "provider",
+		Short: "查看和控制运行中代理服务的 providers",
+		Long: `通过管理服务查看 provider 状态，并在不重启代理服务的情况下启用、禁用、重置或临时强制使用 provider。
+启用/禁用和路由策略默认只在运行时生效，使用 --persist 写回配置文件。
+
+示例:
+  ccenv provider list                     # 查看 provider 状态
+  ccenv provider disable provider-a       # 临时禁用
+  ccenv provider enable provider-a --persist
+  ccenv provider force provider-b -d 2h   # 2 小时内所有请求都发往 provider-b
+  ccenv provider unforce provider-b
+  ccenv provider strategy robin`,
+	}
+
+	run := func(action string) func(cmd *cobra.Command, args []string) {
+		return func(cmd *cobra.Command, args []string) {
+			if err := executor.ProviderAction(action, args[0], persist, duration); err != nil {
+				fmt.Printf("操作失败: %v\n", err)
+				os.Exit(1)
+			}
 		}
-	},
+	}
+	completeNames := func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var names []string
+		if cfg, err := config.LoadConfig(); err == nil {
+			for _, p := range cfg.Providers {
+				names = append(names, p.Name)
+			}
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "查看 provider 的运行时状态",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := executor.ListProviders(); err != nil {
+				fmt.Printf("查看 provider 状态失败: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	actions := []struct {
+		use, short string
+	}{
+		{"enable", "启用 provider，同时清除失败计数和熔断状态"},
+		{"disable", "禁用 provider"},
+		{"reset", "重置 provider 的失败计数和熔断状态"},
+		{"force", "临时将 provider 设为唯一目标，忽略路由规则和熔断状态"},
+		{"unforce", "取消强制使用，恢复正常路由"},
+	}
+	for _, action := range actions {
+		actionCmd := &cobra.Command{
+			Use:               action.use + " <provider>",
+			Short:             action.short,
+			Args:              cobra.ExactArgs(1),
+			Run:               run(action.use),
+			ValidArgsFunction: completeNames,
+		}
+		switch action.use {
+		case "enable", "disable":
+			actionCmd.Flags().BoolVar(&persist, "persist", false, "同时写回配置文件")
+		case "force":
+			actionCmd.Flags().DurationVarP(&duration, "duration", "d", time.Hour, "强制使用的时长，如 30m、2h")
+		}
+		providerCmd.AddCommand(actionCmd)
+	}
+
+	strategyCmd := &cobra.Command{
+		Use:       "strategy <default|robin>",
+		Short:     "切换路由策略",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"default", "robin"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := executor.SetRoutingStrategy(args[0], persist); err != nil {
+				fmt.Printf("切换路由策略失败: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	strategyCmd.Flags().BoolVar(&persist, "persist", false, "同时写回配置文件")
+
+	providerCmd.AddCommand(listCmd, strategyCmd)
+	return providerCmd
+}
+
+// createTestCmd 创建 provider 连通性测试命令
+func createTestCmd() *cobra.Command {
+	var options executor.ProbeOptions
+
+	testCmd := &cobra.Command{
+		Use:   "test [provider...]",
+		Short: "向 provider 发送测试请求，检查连通性",
+		Long: `绕过路由，向指定 provider 发送一个最小的 Messages 请求（默认依次测试非流式和流式），
+报告 DNS、连接、TLS 耗时、状态码、首 token 耗时、实际模型、token 用量和错误响应。
+请求使用与真实请求相同的模型映射、请求头、代理和超时设置。代理服务运行时通过管理服务测试，否则在本地直接发送请求。
+
+示例:
+  ccenv test                          # 测试所有启用的 provider
+  ccenv test provider-a --mode stream
+  ccenv test provider-a --model claude-3-5-haiku-20241022`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := executor.TestProviders(args, options); err != nil {
+				fmt.Printf("测试失败: %v\n", err)
+				os.Exit(1)
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			var names []string
+			if cfg, err := config.LoadConfig(); err == nil {
+				for _, p := range cfg.Providers {
+					names = append(names, p.Name)
+				}
+			}
+			return names, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+
+	testCmd.Flags().StringVar(&options.Model, "model", "", "请求的模型，默认 "+llm_proxy.DefaultProbeModel+"，与真实请求一样按 provider 配置映射")
+	testCmd.Flags().StringVar(&options.Mode, "mode", "both", "测试模式: both, stream, non-stream")
+	testCmd.RegisterFlagCompletionFunc("mode", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"both", "stream", "non-stream"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return testCmd
+}
+
+// createAdminCmd 创建管理服务认证相关的命令
+func createAdminCmd() *cobra.Command {
+	adminCmd := &cobra.Command{
+		Use:   "admin",
+		Short: "生成管理服务的认证信息",
+		Long: `生成配置文件 admin_auth 中使用的令牌和密码哈希。
+
+示例:
+  ccenv admin token                              # 生成随机令牌，填入 admin_auth.tokens
+  ccenv admin hash-password                      # 输入密码，输出 bcrypt 哈希，填入 admin_auth.users
+  echo -n 'password' | ccenv admin hash-password`,
+	}
+
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "生成随机的管理服务令牌",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := executor.GenerateAdminToken(); err != nil {
+				fmt.Printf("%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	hashCmd := &cobra.Command{
+		Use:   "hash-password",
+		Short: "生成密码的 bcrypt 哈希",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := executor.HashPassword(); err != nil {
+				fmt.Printf("%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	adminCmd.AddCommand(tokenCmd, hashCmd)
+	return adminCmd
 }
 
 // createCompletionCmd 创建自动补全命令
@@ -329,10 +611,14 @@ func ensureBashCompletionLoaded(homeDir string) error {
 
 func init() {
 	// 添加所有子命令
-	rootCmd.AddCommand(startCmd)
+	rootCmd.AddCommand(createStartCmd())
 	rootCmd.AddCommand(codeCmd)
-	rootCmd.AddCommand(logsCmd)
-	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(createLogsCmd())
+	rootCmd.AddCommand(createConfigCmd())
+	rootCmd.AddCommand(createUsageCmd())
+	rootCmd.AddCommand(createProviderCmd())
+	rootCmd.AddCommand(createTestCmd())
+	rootCmd.AddCommand(createAdminCmd())
 
 	// 添加自动补全命令
 	rootCmd.AddCommand(createCompletionCmd())
@@ -342,6 +628,7 @@ func init() {
 
 	// 设置版本信息
 	rootCmd.SetVersionTemplate("ccenv version: {{.Version}}\n")
+	admin.Version = Version
 }
 
 func main() {
@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// staticFiles 管理界面的静态资源，编译时嵌入，不依赖外部 CDN
+//
+//go:embed static
+var staticFiles embed.FS
+
+// staticHandler 提供 /static/ 下的静态资源
+func staticHandler() http.Handler {
+	sub, _ := fs.Sub(staticFiles, "static")
+	return http.StripPrefix("/static/", http.FileServer(http.FS(sub)))
+}
+
+// servePage 输出嵌入的 HTML 页面
+func servePage(w http.ResponseWriter, r *http.Request, name string) {
+	data, err := staticFiles.ReadFile("static/" + name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
+
+// handleProvidersPage 输出 provider 配置编辑页面
+func (s *AdminServer) handleProvidersPage(w http.ResponseWriter, r *http.Request) {
+	servePage(w, r, "providers.html")
+}
@@ -0,0 +1,395 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+const (
+	// sessionCookie 登录会话的 Cookie 名称
+	sessionCookie = "ccenv_session"
+	// csrfHeader 使用登录会话执行修改操作时需要携带的 CSRF 令牌请求头
+	csrfHeader = "X-CSRF-Token"
+	// loginFailureDelay 登录失败后的延迟，降低暴力破解的速度
+	loginFailureDelay = time.Second
+)
+
+// principal 已认证的访问者
+type principal struct {
+	Name string // 用户名或令牌名称
+	Role string // config.AdminRoleAdmin 或 config.AdminRoleRead
+	key  string // 标识凭据，用于会话在配置变化后重新确认身份和角色
+}
+
+// session 登录会话
+type session struct {
+	key     string
+	csrf    string
+	expires time.Time
+}
+
+// sessions 登录会话，配置重载重建管理服务器时保持不变，用户和令牌仍然有效时不需要重新登录
+var sessions = struct {
+	items map[string]*session
+	mutex sync.Mutex
+}{items: make(map[string]*session)}
+
+type principalKey struct{}
+
+// principalFrom 返回请求的访问者
+func principalFrom(r *http.Request) principal {
+	p, _ := r.Context().Value(principalKey{}).(principal)
+	return p
+}
+
+// randomToken 生成随机令牌
+func randomToken() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// hashKey 返回凭据的摘要，会话中不保存凭据原文
+func hashKey(prefix, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return prefix + ":" + hex.EncodeToString(sum[:])
+}
+
+// tokenPrincipal 返回令牌对应的访问者
+func tokenPrincipal(t config.AdminToken) principal {
+	name := t.Name
+	if name == "" {
+		name = "token"
+	}
+	return principal{Name: name, Role: t.Role, key: hashKey("token", t.Token)}
+}
+
+// userPrincipal 返回用户对应的访问者，修改密码后原有会话失效
+func userPrincipal(u config.AdminUser) principal {
+	return principal{Name: u.Username, Role: u.Role, key: hashKey("user:"+u.Username, u.PasswordHash)}
+}
+
+// checkToken 按令牌查找访问者
+func (s *AdminServer) checkToken(token string) (principal, bool) {
+	for _, t := range s.auth.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return tokenPrincipal(t), true
+		}
+	}
+	return principal{}, false
+}
+
+// checkPassword 校验用户名和密码
+func (s *AdminServer) checkPassword(username, password string) (principal, bool) {
+	for _, u := range s.auth.Users {
+		if u.Username == username {
+			if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+				return principal{}, false
+			}
+			return userPrincipal(u), true
+		}
+	}
+	return principal{}, false
+}
+
+// keyPrincipal 按会话中保存的凭据标识查找访问者，用户或令牌已被删除或修改时返回 false
+func (s *AdminServer) keyPrincipal(key string) (principal, bool) {
+	for _, t := range s.auth.Tokens {
+		if p := tokenPrincipal(t); p.key == key {
+			return p, true
+		}
+	}
+	for _, u := range s.auth.Users {
+		if p := userPrincipal(u); p.key == key {
+			return p, true
+		}
+	}
+	return principal{}, false
+}
+
+// sessionFrom 返回请求 Cookie 对应的有效会话
+func sessionFrom(r *http.Request) *session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+	sess := sessions.items[cookie.Value]
+	if sess == nil || time.Now().After(sess.expires) {
+		delete(sessions.items, cookie.Value)
+		return nil
+	}
+	return sess
+}
+
+// authenticate 依次使用 Bearer 令牌、Basic 认证和登录会话认证请求，通过会话认证时返回会话（修改操作需要校验 CSRF 令牌）
+func (s *AdminServer) authenticate(r *http.Request) (p principal, sess *session, ok bool) {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		if token, found := strings.CutPrefix(authorization, "Bearer "); found {
+			p, ok = s.checkToken(strings.TrimSpace(token))
+			return p, nil, ok
+		}
+		if username, password, found := r.BasicAuth(); found {
+			p, ok = s.checkPassword(username, password)
+			return p, nil, ok
+		}
+		return principal{}, nil, false
+	}
+	if sess = sessionFrom(r); sess != nil {
+		p, ok = s.keyPrincipal(sess.key)
+		return p, sess, ok
+	}
+	return principal{}, nil, false
+}
+
+// clientIP 返回客户端地址，不信任 X-Forwarded-For 等可以伪造的请求头
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// isLoopbackHost 判断监听地址是否只能从本机访问
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// clientAllowed 判断客户端地址是否允许访问：本机地址始终允许，其他地址需要在 allowed_networks 中
+func (s *AdminServer) clientAllowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, network := range s.auth.AllowedNetworks {
+		if _, ipNet, err := net.ParseCIDR(network); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnsafeMethod 判断请求是否为修改操作
+func isUnsafeMethod(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// hostAllowed 判断 Host（或 Origin 中的主机）是否为管理服务自身的地址，防止 DNS 重绑定攻击：
+// 允许 localhost、127.0.0.1、[::1] 和配置的监听地址，监听所有地址（0.0.0.0 或 ::）时允许任意 IP 地址
+// 攻击者控制的域名即使解析到本机也会被拒绝
+func (s *AdminServer) hostAllowed(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	switch host {
+	case "":
+		return false
+	case "localhost", "127.0.0.1", "::1", strings.ToLower(strings.Trim(s.host, "[]")):
+		return true
+	}
+	listen := net.ParseIP(strings.Trim(s.host, "[]"))
+	return listen != nil && listen.IsUnspecified() && net.ParseIP(host) != nil
+}
+
+// sameOrigin 判断修改操作是否来自管理界面自身，阻止其他网站借助浏览器向管理服务发送请求
+// 没有 Origin 请求头时（命令行工具等非浏览器客户端）视为同源
+func (s *AdminServer) sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host && s.hostAllowed(u.Host)
+}
+
+// isPublicPath 不需要认证即可访问的路径：登录页面和静态资源
+func isPublicPath(path string) bool {
+	return path == "/login" || path == "/api/login" || strings.HasPrefix(path, "/static/")
+}
+
+// withAuth 管理服务的访问控制：限制客户端地址，校验凭据、角色和 CSRF 令牌
+func (s *AdminServer) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !s.clientAllowed(ip) {
+			logger.Warn(logger.ModuleProxy, "拒绝来自 %s 的管理请求: 地址不在 admin_auth.allowed_networks 中", r.RemoteAddr)
+			writeJSONError(w, http.StatusForbidden, "管理服务只允许本机访问，可以在 admin_auth.allowed_networks 中允许其他地址")
+			return
+		}
+		if !s.hostAllowed(r.Host) {
+			logger.Warn(logger.ModuleProxy, "拒绝来自 %s 的管理请求: Host %q 不是管理服务的地址", r.RemoteAddr, r.Host)
+			writeJSONError(w, http.StatusForbidden, "Host 不是管理服务的地址，请通过 localhost、127.0.0.1 或配置的监听地址访问")
+			return
+		}
+		if isUnsafeMethod(r.Method) && !s.sameOrigin(r) {
+			writeJSONError(w, http.StatusForbidden, "拒绝跨站请求")
+			return
+		}
+
+		// 未配置认证时只有本机可以访问（远程地址即使在允许列表中也拒绝），本机访问者拥有全部权限
+		if !s.auth.Enabled() {
+			if !ip.IsLoopback() {
+				writeJSONError(w, http.StatusForbidden, "远程访问管理服务需要先在 admin_auth 中配置令牌或用户")
+				return
+			}
+			next.ServeHTTP(w, withPrincipal(r, principal{Name: "local", Role: config.AdminRoleAdmin}))
+			return
+		}
+
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, sess, ok := s.authenticate(r)
+		if !ok {
+			if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/metrics" {
+				// 页面请求跳转到登录页面，登录后返回原页面
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ccenv"`)
+			writeJSONError(w, http.StatusUnauthorized, "需要登录或提供有效的认证信息")
+			return
+		}
+		if isUnsafeMethod(r.Method) && r.URL.Path != "/api/logout" {
+			if p.Role != config.AdminRoleAdmin {
+				writeJSONError(w, http.StatusForbidden, fmt.Sprintf("%s 为只读账号，不能执行修改操作", p.Name))
+				return
+			}
+			if sess != nil && subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(sess.csrf)) != 1 {
+				writeJSONError(w, http.StatusForbidden, "CSRF 令牌无效，请刷新页面后重试")
+				return
+			}
+		}
+		next.ServeHTTP(w, withPrincipal(r, p))
+	})
+}
+
+// withPrincipal 将访问者保存到请求上下文
+func withPrincipal(r *http.Request, p principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+}
+
+// handleLogin 使用用户名密码或令牌登录，成功后设置会话 Cookie 并返回 CSRF 令牌
+func (s *AdminServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 POST 请求")
+		return
+	}
+	if !s.auth.Enabled() {
+		writeJSONError(w, http.StatusBadRequest, "未配置管理认证，不需要登录")
+		return
+	}
+
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Token    string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("解析请求体失败: %v", err))
+		return
+	}
+
+	var p principal
+	var ok bool
+	if body.Token != "" {
+		p, ok = s.checkToken(body.Token)
+	} else {
+		p, ok = s.checkPassword(body.Username, body.Password)
+	}
+	if !ok {
+		logger.Warn(logger.ModuleProxy, "管理界面登录失败: 用户 %q, 来自 %s", body.Username, r.RemoteAddr)
+		time.Sleep(loginFailureDelay)
+		writeJSONError(w, http.StatusUnauthorized, "用户名、密码或令牌错误")
+		return
+	}
+
+	id := randomToken()
+	sess := &session{key: p.key, csrf: randomToken(), expires: time.Now().Add(time.Duration(s.auth.SessionHours) * time.Hour)}
+	sessions.mutex.Lock()
+	for existing, item := range sessions.items {
+		if time.Now().After(item.expires) {
+			delete(sessions.items, existing)
+		}
+	}
+	sessions.items[id] = sess
+	sessions.mutex.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  sess.expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	logger.Info(logger.ModuleProxy, "管理界面登录: %s (%s), 来自 %s", p.Name, p.Role, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"name": p.Name, "role": p.Role, "csrf_token": sess.csrf})
+}
+
+// handleLogout 退出登录，删除会话
+func (s *AdminServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 POST 请求")
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		sessions.mutex.Lock()
+		delete(sessions.items, cookie.Value)
+		sessions.mutex.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// handleSession 返回当前访问者的信息，通过会话登录时包含 CSRF 令牌
+func (s *AdminServer) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 请求")
+		return
+	}
+	p := principalFrom(r)
+	result := map[string]interface{}{
+		"name":         p.Name,
+		"role":         p.Role,
+		"auth_enabled": s.auth.Enabled(),
+	}
+	if sess := sessionFrom(r); sess != nil {
+		result["csrf_token"] = sess.csrf
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleLoginPage 输出登录页面
+func (s *AdminServer) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	servePage(w, r, "login.html")
+}
@@ -0,0 +1,152 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/imty42/claude-code-env/internal/config"
+)
+
+func TestWithAuth(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	cfg := &config.Config{AdminAuth: config.AdminAuth{
+		Tokens:          []config.AdminToken{{Name: "ci", Token: "read-token", Role: "read"}},
+		Users:           []config.AdminUser{{Username: "alice", PasswordHash: string(hash)}},
+		AllowedNetworks: []string{"10.0.0.1"},
+	}}
+	cfg.SetDefaults()
+	s := &AdminServer{auth: cfg.AdminAuth}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/login", s.handleLogin)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(principalFrom(r).Name))
+	})
+	handler := s.withAuth(mux)
+
+	do := func(method, path, remote string, setup func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(`{"username": "alice", "password": "secret"}`))
+		r.RemoteAddr = remote
+		r.Host = "127.0.0.1:9998"
+		if setup != nil {
+			setup(r)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		remote string
+		setup  func(r *http.Request)
+		code   int
+	}{
+		{"remote address not allowed", "GET", "/api/status", "192.168.1.2:1234", nil, http.StatusForbidden},
+		{"page redirects to login", "GET", "/providers", "10.0.0.1:1234", nil, http.StatusFound},
+		{"api requires auth", "GET", "/api/status", "127.0.0.1:1234", nil, http.StatusUnauthorized},
+		{"read token can view", "GET", "/api/status", "127.0.0.1:1234", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusOK},
+		{"read token cannot modify", "POST", "/api/routing", "127.0.0.1:1234", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusForbidden},
+		{"basic auth admin can modify", "POST", "/api/routing", "127.0.0.1:1234", func(r *http.Request) { r.SetBasicAuth("alice", "secret") }, http.StatusOK},
+		{"wrong password", "GET", "/api/status", "127.0.0.1:1234", func(r *http.Request) { r.SetBasicAuth("alice", "wrong") }, http.StatusUnauthorized},
+		{"cross-site request", "POST", "/api/routing", "127.0.0.1:1234", func(r *http.Request) {
+			r.SetBasicAuth("alice", "secret")
+			r.Header.Set("Origin", "http://evil.example.com")
+		}, http.StatusForbidden},
+		{"same-origin request", "POST", "/api/routing", "127.0.0.1:1234", func(r *http.Request) {
+			r.SetBasicAuth("alice", "secret")
+			r.Header.Set("Origin", "http://127.0.0.1:9998")
+		}, http.StatusOK},
+		{"dns rebinding", "GET", "/api/status", "127.0.0.1:1234", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer read-token")
+			r.Host = "evil.example.com:9998"
+		}, http.StatusForbidden},
+		{"dns rebinding with matching origin", "POST", "/api/routing", "127.0.0.1:1234", func(r *http.Request) {
+			r.SetBasicAuth("alice", "secret")
+			r.Host = "evil.example.com:9998"
+			r.Header.Set("Origin", "http://evil.example.com:9998")
+		}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := do(tt.method, tt.path, tt.remote, tt.setup); w.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.code, w.Body.String())
+		}
+	}
+
+	// 登录后使用会话 Cookie 访问，修改操作需要 CSRF 令牌
+	login := do("POST", "/api/login", "127.0.0.1:1234", nil)
+	if login.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", login.Code, login.Body.String())
+	}
+	cookie := login.Result().Cookies()[0]
+	csrf := strings.Split(strings.Split(login.Body.String(), `"csrf_token": "`)[1], `"`)[0]
+
+	withCookie := func(r *http.Request) { r.AddCookie(cookie) }
+	if w := do("GET", "/api/status", "127.0.0.1:1234", withCookie); w.Code != http.StatusOK || w.Body.String() != "alice" {
+		t.Errorf("session GET = %d %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/api/routing", "127.0.0.1:1234", withCookie); w.Code != http.StatusForbidden {
+		t.Errorf("session POST without CSRF token = %d, want 403", w.Code)
+	}
+	if w := do("POST", "/api/routing", "127.0.0.1:1234", func(r *http.Request) {
+		withCookie(r)
+		r.Header.Set(csrfHeader, csrf)
+	}); w.Code != http.StatusOK {
+		t.Errorf("session POST with CSRF token = %d: %s", w.Code, w.Body.String())
+	}
+
+	// 修改密码后会话失效
+	s.auth.Users[0].PasswordHash = "changed"
+	if w := do("GET", "/api/status", "127.0.0.1:1234", withCookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("session after password change = %d, want 401", w.Code)
+	}
+}
+
+func TestWithAuthDisabled(t *testing.T) {
+	cfg := &config.Config{AdminAuth: config.AdminAuth{AllowedNetworks: []string{"10.0.0.0/8"}}}
+	cfg.SetDefaults()
+	handler := (&AdminServer{auth: cfg.AdminAuth}).withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for remote, code := range map[string]int{"127.0.0.1:1234": http.StatusOK, "[::1]:1234": http.StatusOK, "10.1.2.3:1234": http.StatusForbidden} {
+		r := httptest.NewRequest("POST", "/api/routing", nil)
+		r.RemoteAddr = remote
+		r.Host = "localhost:9998"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("%s: status = %d, want %d", remote, w.Code, code)
+		}
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	local := &AdminServer{host: "127.0.0.1"}
+	all := &AdminServer{host: "0.0.0.0"}
+	named := &AdminServer{host: "ccenv.lan"}
+	tests := []struct {
+		s     *AdminServer
+		host  string
+		allow bool
+	}{
+		{local, "127.0.0.1:9998", true},
+		{local, "localhost:9998", true},
+		{local, "[::1]:9998", true},
+		{local, "192.168.1.2:9998", false},
+		{local, "rebind.example.com:9998", false},
+		{local, "", false},
+		{all, "192.168.1.2:9998", true},
+		{all, "rebind.example.com:9998", false},
+		{named, "ccenv.lan:9998", true},
+	}
+	for _, tt := range tests {
+		if got := tt.s.hostAllowed(tt.host); got != tt.allow {
+			t.Errorf("hostAllowed(%q) with listen %s = %v, want %v", tt.host, tt.s.host, got, tt.allow)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/provider"
+)
+
+// editableProvider 管理界面编辑的 provider，OriginalName 为编辑前的名称（新增时为空），用于还原未修改的打码密钥
+type editableProvider struct {
+	config.Provider
+	OriginalName string `json:"original_name,omitempty"`
+}
+
+// providersDocument 配置文件中的 providers 和读取时的文件哈希
+type providersDocument struct {
+	Hash      string             `json:"hash"`
+	Providers []editableProvider `json:"providers"`
+}
+
+// handleConfigProviders 读取或保存配置文件中的 providers
+// GET 返回打码后的 providers 和文件哈希，PUT 校验后替换 providers 并写回配置文件，哈希不一致时返回 409
+func (s *AdminServer) handleConfigProviders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		providers, hash, err := config.ReadProviders()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		doc := providersDocument{Hash: hash, Providers: []editableProvider{}}
+		for _, p := range config.MaskProviderSecrets(providers) {
+			doc.Providers = append(doc.Providers, editableProvider{Provider: p, OriginalName: p.Name})
+		}
+		writeJSON(w, http.StatusOK, doc)
+	case http.MethodPut:
+		s.saveConfigProviders(w, r)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 和 PUT 请求")
+	}
+}
+
+// saveConfigProviders 保存管理界面提交的 providers
+func (s *AdminServer) saveConfigProviders(w http.ResponseWriter, r *http.Request) {
+	var doc providersDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("解析请求体失败: %v", err))
+		return
+	}
+	if doc.Hash == "" {
+		writeJSONError(w, http.StatusBadRequest, "缺少 hash，请先读取配置")
+		return
+	}
+
+	originals, hash, err := config.ReadProviders()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if hash != doc.Hash {
+		writeJSONError(w, http.StatusConflict, config.ErrConfigConflict.Error())
+		return
+	}
+
+	// 还原未修改的打码密钥
+	providers := make([]config.Provider, 0, len(doc.Providers))
+	for _, edited := range doc.Providers {
+		p := edited.Provider
+		if p.Env == nil {
+			p.Env = map[string]string{}
+		}
+		if err := config.RestoreProviderSecrets(&p, findProvider(originals, edited.OriginalName)); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		providers = append(providers, p)
+	}
+
+	if err := config.ValidateProviders(providers); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := config.SaveProviders(providers, doc.Hash); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, config.ErrConfigConflict) {
+			status = http.StatusConflict
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	logger.Info(logger.ModuleProxy, "通过管理界面保存 providers 配置，共 %d 个 provider", len(providers))
+
+	_, newHash, err := config.ReadProviders()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"hash":     newHash,
+		"warnings": routingWarnings(providers),
+	})
+}
+
+// findProvider 按名称查找 provider，不存在时返回 nil
+func findProvider(providers []config.Provider, name string) *config.Provider {
+	if name == "" {
+		return nil
+	}
+	for i := range providers {
+		if providers[i].Name == name {
+			return &providers[i]
+		}
+	}
+	return nil
+}
+
+// routingWarnings 检查路由规则是否引用了不存在的 provider
+func routingWarnings(providers []config.Provider) []string {
+	warnings := []string{}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return warnings
+	}
+	for _, rule := range cfg.Routing.Rules {
+		for _, name := range provider.ResolveTarget(cfg.Routing, rule.Target) {
+			if findProvider(providers, name) == nil {
+				warnings = append(warnings, fmt.Sprintf("路由规则 %s 的目标 %s 引用了不存在的 provider: %s", rule.Name, rule.Target, name))
+			}
+		}
+	}
+	return warnings
+}
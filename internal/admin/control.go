@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+// defaultForceDuration 强制使用 provider 的默认时长
+const defaultForceDuration = time.Hour
+
+// handleProviderAction 对 provider 执行运行时控制操作
+//
+//	POST   /api/providers/{name}/enable   启用，?persist=true 时写回配置文件
+//	POST   /api/providers/{name}/disable  禁用，?persist=true 时写回配置文件
+//	POST   /api/providers/{name}/reset    重置失败计数和熔断状态
+//	POST   /api/providers/{name}/force    临时强制为唯一目标，请求体 {"duration": "30m"}，默认 1 小时
+//	DELETE /api/providers/{name}/force    取消强制使用
+//	POST   /api/providers/{name}/test     发送测试请求，见 handleProviderTest
+func (s *AdminServer) handleProviderAction(w http.ResponseWriter, r *http.Request, name, action string) {
+	if action == "test" {
+		s.handleProviderTest(w, r, name)
+		return
+	}
+
+	persist, err := persistParam(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if persist && (action == "reset" || action == "force") {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("操作 %s 只在运行时生效，不支持 persist", action))
+		return
+	}
+
+	switch {
+	case action == "force" && r.Method == http.MethodDelete:
+		if forced, _ := s.providerManager.Forced(); forced != name {
+			writeJSONError(w, http.StatusConflict, fmt.Sprintf("provider %s 未被强制使用", name))
+			return
+		}
+		s.providerManager.ClearForce()
+	case r.Method != http.MethodPost:
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 POST 请求")
+		return
+	case action == "enable" || action == "disable":
+		err = s.providerManager.SetProviderEnabled(name, action == "enable")
+	case action == "reset":
+		err = s.providerManager.ResetProvider(name)
+	case action == "force":
+		var duration time.Duration
+		if duration, err = forceDuration(r); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		err = s.providerManager.ForceProvider(name, duration)
+	default:
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("不支持的操作 %s，可选: enable, disable, reset, force, test", action))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, s.errorStatus(name), err.Error())
+		return
+	}
+
+	if persist {
+		state := "off"
+		if action == "enable" {
+			state = "on"
+		}
+		if err := config.SaveProviderState(name, state); err != nil {
+			logger.Error(logger.ModuleProxy, "写回 provider %s 的状态失败: %v", name, err)
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("已在运行时生效，但写回配置文件失败: %v", err))
+			return
+		}
+		logger.Info(logger.ModuleProxy, "已将 provider %s 的状态 %s 写回配置文件", name, state)
+	}
+
+	status, _ := s.providerManager.GetProvider(name)
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleRouting 查看或在运行时切换路由策略
+// GET 返回当前策略和强制使用的 provider，POST {"strategy": "robin"} 切换策略，?persist=true 时写回配置文件
+func (s *AdminServer) handleRouting(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		persist, err := persistParam(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var body struct {
+			Strategy string `json:"strategy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Strategy == "" {
+			writeJSONError(w, http.StatusBadRequest, `请求体应为 {"strategy": "default"} 或 {"strategy": "robin"}`)
+			return
+		}
+		if err := s.providerManager.SetRoutingStrategy(body.Strategy); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if persist {
+			if err := config.SaveRoutingStrategy(body.Strategy); err != nil {
+				logger.Error(logger.ModuleProxy, "写回路由策略失败: %v", err)
+				writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("已在运行时生效，但写回配置文件失败: %v", err))
+				return
+			}
+			logger.Info(logger.ModuleProxy, "已将路由策略 %s 写回配置文件", body.Strategy)
+		}
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 和 POST 请求")
+		return
+	}
+
+	result := map[string]interface{}{"strategy": s.providerManager.RoutingStrategy()}
+	if forced, until := s.providerManager.Forced(); forced != "" {
+		result["forced_provider"] = forced
+		result["forced_until"] = until.Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// persistParam 解析 persist 查询参数
+func persistParam(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("persist")
+	if value == "" {
+		return false, nil
+	}
+	persist, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("无效的 persist 参数 %q", value)
+	}
+	return persist, nil
+}
+
+// forceDuration 解析强制使用时长，请求体为空时使用默认时长
+func forceDuration(r *http.Request) (time.Duration, error) {
+	var body struct {
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		return 0, fmt.Errorf(`请求体应为 {"duration": "30m"}`)
+	}
+	if body.Duration == "" {
+		return defaultForceDuration, nil
+	}
+	duration, err := time.ParseDuration(body.Duration)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("无效的时长 %q，如 30m、2h", body.Duration)
+	}
+	return duration, nil
+}
+
+// errorStatus 根据 provider 是否存在返回控制操作失败时的状态码
+func (s *AdminServer) errorStatus(name string) int {
+	if _, exists := s.providerManager.GetProvider(name); !exists {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,154 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/logview"
+)
+
+// logHeartbeatInterval SSE 心跳间隔，避免空闲连接被代理或浏览器断开
+const logHeartbeatInterval = 15 * time.Second
+
+// logEvent 推送给管理界面的日志
+type logEvent struct {
+	Time       string  `json:"time"`
+	Level      string  `json:"level"`
+	Module     string  `json:"module"`
+	RequestID  string  `json:"request_id,omitempty"`
+	Provider   string  `json:"provider,omitempty"`
+	Model      string  `json:"model,omitempty"`
+	Status     int     `json:"status,omitempty"`
+	DurationMS float64 `json:"duration_ms,omitempty"`
+	Message    string  `json:"message"`
+	Error      string  `json:"error,omitempty"`
+	Caller     string  `json:"caller,omitempty"`
+
+	UpstreamRequestID string `json:"upstream_request_id,omitempty"`
+}
+
+// newLogEvent 将日志记录转换为推送格式
+func newLogEvent(record logger.Record) logEvent {
+	return logEvent{
+		Time:       record.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		Level:      record.Level,
+		Module:     record.Module,
+		RequestID:  record.RequestID,
+		Provider:   record.Provider,
+		Model:      record.Model,
+		Status:     record.Status,
+		DurationMS: float64(record.Duration.Microseconds()) / 1000,
+		Message:    record.Message,
+		Error:      record.Error,
+		Caller:     record.Caller,
+
+		UpstreamRequestID: record.UpstreamRequestID,
+	}
+}
+
+// handleLogStream 以 SSE 推送实时日志
+// 查询参数 level、module（逗号分隔）、provider、request_id、grep 用于过滤，backlog 为连接时先推送的最近日志条数（默认 200）
+func (s *AdminServer) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 请求")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "当前连接不支持流式响应")
+		return
+	}
+
+	query := r.URL.Query()
+	var modules []string
+	if module := query.Get("module"); module != "" {
+		modules = strings.Split(module, ",")
+	}
+	filter, err := logview.NewFilter(query.Get("level"), modules, query.Get("provider"), query.Get("request_id"), "", "", query.Get("grep"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	backlog := 200
+	if value := query.Get("backlog"); value != "" {
+		if backlog, err = strconv.Atoi(value); err != nil || backlog < 0 {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("无效的 backlog 参数 %q", value))
+			return
+		}
+	}
+
+	// 先订阅再读取最近的日志，避免两者之间写入的日志丢失（可能重复一条，由界面按顺序显示）
+	sub := logger.Subscribe(256)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var recent []logger.Record
+	for _, record := range logger.Recent() {
+		if filter.Match(record, logLine(record)) {
+			recent = append(recent, record)
+		}
+	}
+	if len(recent) > backlog {
+		recent = recent[len(recent)-backlog:]
+	}
+	for _, record := range recent {
+		writeLogEvent(w, record)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(logHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case record, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if dropped := sub.TakeDropped(); dropped > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped)
+			}
+			if filter.Match(record, logLine(record)) {
+				writeLogEvent(w, record)
+				flusher.Flush()
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// writeLogEvent 写入一条 SSE 日志事件
+func writeLogEvent(w http.ResponseWriter, record logger.Record) {
+	data, err := json.Marshal(newLogEvent(record))
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// logLine 返回用于 grep 匹配的日志内容
+func logLine(record logger.Record) string {
+	if record.Error != "" {
+		return record.Message + ": " + record.Error
+	}
+	return record.Message
+}
+
+// handleLogsPage 输出实时日志页面
+func (s *AdminServer) handleLogsPage(w http.ResponseWriter, r *http.Request) {
+	servePage(w, r, "logs.html")
+}
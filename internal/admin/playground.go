@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/imty42/claude-code-env/internal/llm_proxy"
+)
+
+// playgroundHeaders 从 playground 请求转发给代理处理流程的请求头，管理服务的 Cookie、认证和 CSRF 请求头不会发往上游
+var playgroundHeaders = []string{"Content-Type", "Anthropic-Version", "Anthropic-Beta"}
+
+// handlePlayground 在进程内将请求交给 LLM 代理的 /v1/messages 处理流程，响应（包括流式响应）原样返回
+// POST /api/playground/messages，请求体为 Messages API 请求，请求头 X-Ccenv-Provider 指定 provider，省略时按路由规则选择
+// 只有管理员可以指定 provider，代理端口不接受该请求头
+func (s *AdminServer) handlePlayground(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 POST 请求")
+		return
+	}
+
+	req := r.Clone(llm_proxy.WithPinnedProvider(r.Context(), r.Header.Get(llm_proxy.PinProviderHeader)))
+	req.URL.Path = "/v1/messages"
+	req.Header = http.Header{}
+	for _, key := range playgroundHeaders {
+		if value := r.Header.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	if req.Header.Get("Anthropic-Version") == "" {
+		req.Header.Set("Anthropic-Version", "2023-06-01")
+	}
+	req.Header.Set("User-Agent", "ccenv-playground")
+	s.llmServer.ServeMessages(w, req)
+}
+
+// handlePlaygroundPage 输出 playground 页面
+func (s *AdminServer) handlePlaygroundPage(w http.ResponseWriter, r *http.Request) {
+	servePage(w, r, "playground.html")
+}
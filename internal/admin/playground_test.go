@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/llm_proxy"
+	"github.com/imty42/claude-code-env/internal/provider"
+)
+
+func TestPlaygroundPinnedProvider(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var served string // 最近一次上游请求使用的令牌
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if r.Header.Get(llm_proxy.PinProviderHeader) != "" {
+			t.Errorf("%s should not be forwarded upstream", llm_proxy.PinProviderHeader)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"m","stop_reason":"end_turn","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`)
+	}))
+	defer upstream.Close()
+
+	env := func(token string) map[string]string {
+		return map[string]string{"ANTHROPIC_BASE_URL": upstream.URL, "ANTHROPIC_AUTH_TOKEN": token}
+	}
+	cfg := &config.Config{Providers: []config.Provider{
+		{Name: "a", State: "on", Env: env("token-a")},
+		{Name: "off", State: "off", Env: env("token-off")},
+		{Name: "disabled", State: "on", Env: env("token-disabled")},
+		{Name: "noauth", State: "on", Env: map[string]string{"ANTHROPIC_BASE_URL": upstream.URL}},
+	}}
+	cfg.SetDefaults()
+	pm := provider.NewProviderManager(cfg)
+	pm.SetProviderEnabled("disabled", false)
+	llmServer := llm_proxy.NewLLMProxyServer(pm, cfg)
+	s := NewAdminServer(pm, llmServer, cfg)
+
+	send := func(handler http.HandlerFunc, pin string) int {
+		served = ""
+		r := httptest.NewRequest("POST", "/api/playground/messages", strings.NewReader(`{"model":"m","max_tokens":16,"messages":[{"role":"user","content":"ping"}]}`))
+		r.Header.Set(llm_proxy.PinProviderHeader, pin)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	// playground 可以指定配置中未启用的 provider，便于启用前测试
+	if code := send(s.handlePlayground, "off"); code != http.StatusOK || served != "token-off" {
+		t.Errorf("playground pinned off: status = %d, served = %q", code, served)
+	}
+	// 代理端口忽略该请求头，按路由规则选择
+	if code := send(llmServer.ServeMessages, "off"); code != http.StatusOK || served != "token-a" {
+		t.Errorf("proxy with pin header: status = %d, served = %q", code, served)
+	}
+	// 被管理接口禁用、缺少认证配置或不存在的 provider 不能指定
+	for _, pin := range []string{"disabled", "noauth", "missing"} {
+		if code := send(s.handlePlayground, pin); code != http.StatusBadRequest || served != "" {
+			t.Errorf("playground pinned %s: status = %d, served = %q", pin, code, served)
+		}
+	}
+}
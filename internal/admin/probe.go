@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/imty42/claude-code-env/internal/llm_proxy"
+)
+
+// handleProviderTest 向 provider 发送测试请求，绕过路由和熔断状态
+// POST /api/providers/{name}/test，请求体 {"model": "...", "mode": "both|stream|non-stream"}，均可省略，默认依次测试非流式和流式请求
+func (s *AdminServer) handleProviderTest(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 POST 请求")
+		return
+	}
+	var body struct {
+		Model string `json:"model"`
+		Mode  string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("解析请求体失败: %v", err))
+		return
+	}
+	modes, err := probeModes(body.Mode)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var results []*llm_proxy.ProbeResult
+	for _, stream := range modes {
+		result, err := s.llmServer.Probe(r.Context(), name, llm_proxy.ProbeOptions{Model: body.Model, Stream: stream})
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		results = append(results, result)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// probeModes 解析测试模式，返回依次测试的是否流式
+func probeModes(mode string) ([]bool, error) {
+	switch mode {
+	case "", "both":
+		return []bool{false, true}, nil
+	case "stream":
+		return []bool{true}, nil
+	case "non-stream":
+		return []bool{false}, nil
+	default:
+		return nil, fmt.Errorf("不支持的测试模式 %q，可选: both, stream, non-stream", mode)
+	}
+}
@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/imty42/claude-code-env/internal/history"
+)
+
+// handleRequests 返回最近的 /v1/messages 请求，最新的在前
+// 查询参数 provider 按实际服务或尝试过的 provider 过滤，status 为 error（状态码 >= 400）、ok 或具体状态码，limit 限制返回条数
+func (s *AdminServer) handleRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 请求")
+		return
+	}
+	query := r.URL.Query()
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit 必须是非负整数")
+			return
+		}
+		limit = n
+	}
+	status := query.Get("status")
+	if status != "" && status != "error" && status != "ok" {
+		if _, err := strconv.Atoi(status); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "status 可选: error, ok 或具体状态码")
+			return
+		}
+	}
+	providerName := query.Get("provider")
+
+	requests := []history.Request{}
+	for _, request := range history.List(0) {
+		if limit > 0 && len(requests) >= limit {
+			break
+		}
+		if matchesRequest(request, providerName, status) {
+			requests = append(requests, request)
+		}
+	}
+	writeJSON(w, http.StatusOK, requests)
+}
+
+// matchesRequest 判断请求是否满足过滤条件，仍在处理的请求不匹配状态过滤
+func matchesRequest(request history.Request, providerName, status string) bool {
+	if providerName != "" && request.Provider != providerName {
+		attempted := false
+		for _, attempt := range request.Attempts {
+			attempted = attempted || attempt.Provider == providerName
+		}
+		if !attempted {
+			return false
+		}
+	}
+	switch {
+	case status == "":
+		return true
+	case request.FinishedAt == nil:
+		return false
+	case status == "error":
+		return request.Status >= 400
+	case status == "ok":
+		return request.Status < 400
+	default:
+		return strconv.Itoa(request.Status) == status
+	}
+}
+
+// handleRequest 按代理请求ID或上游请求ID返回单个请求的详情
+// GET /api/requests/{id}
+func (s *AdminServer) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 请求")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/requests/")
+	request, exists := history.Get(id)
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, "请求 "+id+" 不在最近的请求记录中")
+		return
+	}
+	writeJSON(w, http.StatusOK, request)
+}
+
+// handleRequestsPage 输出最近请求页面
+func (s *AdminServer) handleRequestsPage(w http.ResponseWriter, r *http.Request) {
+	servePage(w, r, "requests.html")
+}
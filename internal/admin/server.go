@@ -2,37 +2,97 @@ package admin
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/imty42/claude-code-env/internal/capture"
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/llm_proxy"
 	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/metrics"
+	"github.com/imty42/claude-code-env/internal/provider"
 )
 
-// AdminServer 管理服务器 - 简化版本，仅提供Web管理界面
+// Version 程序版本，由 main 在启动时设置
+var Version = "dev"
+
+// processStart 进程启动时间，配置重载重建管理服务器时保持不变
+var processStart = time.Now()
+
+// AdminServer 管理服务器 - 提供Web管理界面和管理接口
 type AdminServer struct {
-	server *http.Server
-	host   string
-	port   int
+	server          *http.Server
+	providerManager *provider.ProviderManager
+	llmServer       *llm_proxy.LLMProxyServer // 发送 provider 测试请求和 playground 请求，与真实请求使用相同的处理流程
+	host            string
+	port            int
+	apiPort         int
+	closing         chan struct{} // 关闭时通知日志推送等长连接结束
+	closeOnce       sync.Once
+	auth            config.AdminAuth
 }
 
-// NewAdminServer 创建新的管理服务器
-func NewAdminServer(host string, port int) *AdminServer {
+// NewAdminServer 创建新的管理服务器，providerManager 为当前生效的 provider 管理器，llmServer 用于发送 provider 测试请求和 playground 请求
+func NewAdminServer(providerManager *provider.ProviderManager, llmServer *llm_proxy.LLMProxyServer, cfg *config.Config) *AdminServer {
 	adminServer := &AdminServer{
-		host: host,
-		port: port,
+		providerManager: providerManager,
+		llmServer:       llmServer,
+		host:            cfg.CCEnvHost,
+		port:            cfg.AdminPort,
+		apiPort:         cfg.LLMProxyPort,
+		closing:         make(chan struct{}),
+		auth:            cfg.AdminAuth,
 	}
 
 	// 创建路由器
 	mux := http.NewServeMux()
 
-	// 仅注册Web管理界面路由
+	// 注册Web管理界面和监控指标路由
 	mux.HandleFunc("/", adminServer.handleUI)
+	mux.HandleFunc("/metrics", adminServer.handleMetrics)
+	mux.HandleFunc("/api/debug/wire", adminServer.handleDebugWire)
+
+	// 注册 provider 和服务状态接口
+	mux.HandleFunc("/api/status", adminServer.handleStatus)
+	mux.HandleFunc("/api/providers", adminServer.handleProviders)
+	mux.HandleFunc("/api/providers/", adminServer.handleProvider)
+	mux.HandleFunc("/api/routing", adminServer.handleRouting)
+	mux.HandleFunc("/api/timeline", adminServer.handleTimeline)
+
+	// 注册 provider 配置编辑页面和接口
+	mux.HandleFunc("/providers", adminServer.handleProvidersPage)
+	mux.HandleFunc("/api/config/providers", adminServer.handleConfigProviders)
+	mux.Handle("/static/", staticHandler())
+
+	// 注册实时日志页面和推送接口
+	mux.HandleFunc("/logs", adminServer.handleLogsPage)
+	mux.HandleFunc("/api/logs/stream", adminServer.handleLogStream)
+
+	// 注册最近请求页面和接口
+	mux.HandleFunc("/requests", adminServer.handleRequestsPage)
+	mux.HandleFunc("/api/requests", adminServer.handleRequests)
+	mux.HandleFunc("/api/requests/", adminServer.handleRequest)
+
+	// 注册 playground 页面和接口
+	mux.HandleFunc("/playground", adminServer.handlePlaygroundPage)
+	mux.HandleFunc("/api/playground/messages", adminServer.handlePlayground)
+
+	// 注册登录页面和会话接口
+	mux.HandleFunc("/login", adminServer.handleLoginPage)
+	mux.HandleFunc("/api/login", adminServer.handleLogin)
+	mux.HandleFunc("/api/logout", adminServer.handleLogout)
+	mux.HandleFunc("/api/session", adminServer.handleSession)
 
 	// 创建服务器
 	adminServer.server = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", host, port),
-		Handler: mux,
+		Addr:    fmt.Sprintf("%s:%d", adminServer.host, adminServer.port),
+		Handler: adminServer.withAuth(mux),
 	}
 
 	return adminServer
@@ -41,6 +101,9 @@ func NewAdminServer(host string, port int) *AdminServer {
 // Start 启动管理服务器
 func (s *AdminServer) Start() error {
 	logger.Info(logger.ModuleProxy, "启动管理服务器: http://%s:%d", s.host, s.port)
+	if !s.auth.Enabled() && !isLoopbackHost(s.host) {
+		logger.Warn(logger.ModuleProxy, "管理服务监听在 %s 但未配置 admin_auth，只接受本机的请求", s.host)
+	}
 
 	go func() {
 		if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
@@ -56,6 +119,8 @@ func (s *AdminServer) Start() error {
 // Shutdown 关闭管理服务器
 func (s *AdminServer) Shutdown() error {
 	logger.Info(logger.ModuleProxy, "关闭管理服务器...")
+	// Shutdown 不会中断长连接，先通知日志推送结束，避免配置重载等待超时
+	s.closeOnce.Do(func() { close(s.closing) })
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -63,89 +128,134 @@ func (s *AdminServer) Shutdown() error {
 	return s.server.Shutdown(ctx)
 }
 
-// handleUI 处理管理界面路由
+// handleMetrics 以 Prometheus 文本格式输出监控指标
+func (s *AdminServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteText(w)
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// writeJSONError 写入 JSON 格式的错误响应
+func writeJSONError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]string{"error": message})
+}
+
+// handleDebugWire 查看或在运行时切换请求抓包
+// GET 返回当前状态，POST {"enabled": true|false} 开启或关闭
+func (s *AdminServer) handleDebugWire(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+			writeJSONError(w, http.StatusBadRequest, `请求体应为 {"enabled": true} 或 {"enabled": false}`)
+			return
+		}
+		capture.SetEnabled(*body.Enabled)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 和 POST 请求")
+		return
+	}
+
+	enabled, dir := capture.Status()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": enabled, "dir": dir})
+}
+
+// handleStatus 返回服务状态：版本、运行时长、监听地址和路由策略
+func (s *AdminServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 请求")
+		return
+	}
+
+	providers := s.providerManager.GetProviderStatus()
+	available := 0
+	for _, ps := range providers {
+		if ps.Available {
+			available++
+		}
+	}
+
+	forced, _ := s.providerManager.Forced()
+	wireEnabled, _ := capture.Status()
+	uptime := time.Since(processStart)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version":        Version,
+		"go_version":     runtime.Version(),
+		"pid":            os.Getpid(),
+		"started_at":     processStart.Format(time.RFC3339),
+		"uptime":         uptime.Round(time.Second).String(),
+		"uptime_seconds": int64(uptime.Round(time.Second).Seconds()),
+		"listen": map[string]string{
+			"llm_proxy": fmt.Sprintf("http://%s:%d", s.host, s.apiPort),
+			"admin":     fmt.Sprintf("http://%s:%d", s.host, s.port),
+		},
+		"routing_strategy":    s.providerManager.RoutingStrategy(),
+		"forced_provider":     forced,
+		"providers_total":     len(providers),
+		"providers_available": available,
+		"debug_wire":          wireEnabled,
+	})
+}
+
+// handleProviders 返回所有 provider 的运行时状态
+func (s *AdminServer) handleProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 请求")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.providerManager.GetProviderStatus())
+}
+
+// handleProvider 处理单个 provider 的接口：
+// GET /api/providers/{name} 返回运行时状态，POST /api/providers/{name}/{action} 执行运行时控制操作
+func (s *AdminServer) handleProvider(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/providers/"), "/")
+	if name == "" {
+		s.handleProviders(w, r)
+		return
+	}
+	if action != "" {
+		s.handleProviderAction(w, r, name, action)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 请求")
+		return
+	}
+	status, exists := s.providerManager.GetProvider(name)
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("provider %s 不存在", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleUI 输出管理界面首页（仪表盘），其他未注册的路径返回 404
 func (s *AdminServer) handleUI(w http.ResponseWriter, r *http.Request) {
-	logger.Info(logger.ModuleProxy, "接收到管理界面请求: %s %s", r.Method, r.URL.Path)
-
-	// 设置 HTML 响应头
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-	// 返回简化的管理界面
-	html := fmt.Sprintf(`<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Claude Code Env - 管理界面</title>
-    <style>
-        body { 
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; 
-            max-width: 800px; margin: 2rem auto; padding: 1rem; 
-            background: #f5f5f5; color: #333;
-        }
-        .container { 
-            background: white; padding: 2rem; border-radius: 8px; 
-            box-shadow: 0 2px 10px rgba(0,0,0,0.1);
-        }
-        .header { color: #2563eb; border-bottom: 2px solid #e5e7eb; padding-bottom: 1rem; margin-bottom: 2rem; }
-        .status { background: #f0f9ff; border: 1px solid #bae6fd; padding: 1rem; border-radius: 4px; margin: 1rem 0; }
-        .future { background: #f9fafb; border: 1px solid #d1d5db; padding: 1rem; border-radius: 4px; }
-        .version { color: #6b7280; font-size: 0.875rem; margin-top: 2rem; }
-        .refresh { float: right; background: #2563eb; color: white; padding: 0.5rem 1rem; text-decoration: none; border-radius: 4px; }
-        .refresh:hover { background: #1d4ed8; }
-    </style>
-    <script>
-        function refreshPage() {
-            location.reload();
-        }
-        // 自动刷新页面
-        setInterval(refreshPage, 60000); // 60秒刷新一次
-    </script>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🚀 Claude Code Env 管理界面</h1>
-            <p>LLM代理服务管理控制台</p>
-            <a href="javascript:refreshPage()" class="refresh">刷新</a>
-        </div>
-        
-        <div class="status">
-            <h3>📊 服务状态</h3>
-            <p>✅ 管理服务器正在运行 (端口: %d)</p>
-            <p>✅ LLM代理服务正在运行</p>
-            <p>✅ 服务时间: %s</p>
-        </div>
-        
-        <div class="future">
-            <h3>🎯 即将推出的功能</h3>
-            <ul>
-                <li>📝 Provider 配置在线编辑</li>
-                <li>📈 实时监控和统计</li>
-                <li>📋 日志查看和搜索</li>
-                <li>🔧 系统状态和健康检查</li>
-                <li>⚙️ 动态配置热重载</li>
-                <li>🔐 访问控制和安全设置</li>
-            </ul>
-        </div>
-        
-        <div class="future">
-            <h3>📖 当前可用功能</h3>
-            <p>• <strong>LLM API代理</strong>: 端口9999，支持所有 /v1/* 请求</p>
-            <p>• <strong>管理界面</strong>: 端口9998，Web管理控制台</p>
-            <p>• <strong>配置管理</strong>: 编辑 ~/.claude-code-env/settings.json</p>
-            <p>• <strong>日志查看</strong>: 使用 <code>ccenv logs</code> 命令</p>
-            <p>• <strong>服务管理</strong>: 使用 <code>ccenv start/stop</code> 命令</p>
-        </div>
-        
-        <div class="version">
-            <p>Claude Code Env v2.0 Admin Server | 请求路径: %s</p>
-            <p>页面将每60秒自动刷新</p>
-        </div>
-    </div>
-</body>
-</html>`, s.port, time.Now().Format("2006-01-02 15:04:05"), r.URL.Path)
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(html))
-}
\ No newline at end of file
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	servePage(w, r, "index.html")
+}
+
+// handleTimeline 返回最近 1 小时按分钟汇总的请求数、错误率、耗时和 token 用量
+func (s *AdminServer) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持 GET 请求")
+		return
+	}
+	writeJSON(w, http.StatusOK, metrics.Timeline.Snapshot())
+}
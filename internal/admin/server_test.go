@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"testing"
+
+	"github.com/imty42/claude-code-env/internal/config"
+)
+
+func TestShutdownTwice(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.SetDefaults()
+	s := NewAdminServer(nil, nil, cfg)
+
+	// 启动失败回滚和配置重载都可能重复关闭同一个管理服务器
+	if err := s.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
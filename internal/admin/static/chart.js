@@ -0,0 +1,132 @@
+// 简单的 SVG 折线图，不依赖第三方库
+
+const CHART_COLORS = ['#2563eb', '#16a34a', '#dc2626', '#d97706', '#7c3aed', '#0891b2', '#db2777', '#4b5563'];
+const SVG_NS = 'http://www.w3.org/2000/svg';
+
+function svgElement(name, attrs, text) {
+    const el = document.createElementNS(SVG_NS, name);
+    for (const key of Object.keys(attrs)) {
+        el.setAttribute(key, attrs[key]);
+    }
+    if (text !== undefined) {
+        el.textContent = text;
+    }
+    return el;
+}
+
+// niceMax 将最大值向上取整为便于阅读的刻度
+function niceMax(value) {
+    if (value <= 0) {
+        return 1;
+    }
+    const magnitude = Math.pow(10, Math.floor(Math.log10(value)));
+    for (const step of [1, 2, 2.5, 5, 10]) {
+        if (value <= step * magnitude) {
+            return step * magnitude;
+        }
+    }
+    return 10 * magnitude;
+}
+
+function formatClock(date) {
+    return String(date.getHours()).padStart(2, '0') + ':' + String(date.getMinutes()).padStart(2, '0');
+}
+
+// lineChart 在 svg 中绘制折线图
+// times 为横轴时间，series 为 [{name, values}]，values 中的 null 表示没有数据（折线断开），format 格式化纵轴数值
+function lineChart(svg, times, series, format) {
+    const width = svg.clientWidth || 500, height = svg.clientHeight || 200;
+    const left = 56, right = 8, top = 8, bottom = 40;
+    const plotWidth = width - left - right, plotHeight = height - top - bottom;
+
+    svg.setAttribute('viewBox', '0 0 ' + width + ' ' + height);
+    svg.innerHTML = '';
+
+    let max = 0;
+    for (const s of series) {
+        for (const v of s.values) {
+            if (v !== null && v > max) {
+                max = v;
+            }
+        }
+    }
+    max = niceMax(max);
+
+    const x = function (i) { return left + (times.length > 1 ? i * plotWidth / (times.length - 1) : 0); };
+    const y = function (v) { return top + plotHeight - v / max * plotHeight; };
+
+    // 网格和纵轴刻度
+    for (let i = 0; i <= 4; i++) {
+        const value = max * i / 4;
+        svg.appendChild(svgElement('line', { x1: left, x2: width - right, y1: y(value), y2: y(value), class: 'grid-line' }));
+        svg.appendChild(svgElement('text', { x: left - 6, y: y(value) + 4, 'text-anchor': 'end', class: 'axis' }, format(value)));
+    }
+    // 横轴每 15 分钟一个刻度
+    for (let i = 0; i < times.length; i++) {
+        if (times[i].getMinutes() % 15 === 0) {
+            svg.appendChild(svgElement('text', { x: x(i), y: top + plotHeight + 16, 'text-anchor': 'middle', class: 'axis' }, formatClock(times[i])));
+        }
+    }
+
+    series.forEach(function (s, index) {
+        const color = CHART_COLORS[index % CHART_COLORS.length];
+        let path = '', drawing = false;
+        s.values.forEach(function (v, i) {
+            if (v === null) {
+                drawing = false;
+                return;
+            }
+            path += (drawing ? 'L' : 'M') + x(i).toFixed(1) + ' ' + y(v).toFixed(1);
+            drawing = true;
+            // 孤立的点画成圆点，否则看不到
+            const prev = i > 0 ? s.values[i - 1] : null, next = i + 1 < s.values.length ? s.values[i + 1] : null;
+            if (prev === null && next === null) {
+                svg.appendChild(svgElement('circle', { cx: x(i), cy: y(v), r: 2.5, fill: color }));
+            }
+        });
+        if (path) {
+            svg.appendChild(svgElement('path', { d: path, stroke: color, fill: 'none', 'stroke-width': 1.5 }));
+        }
+    });
+
+    // 图例
+    let legendX = left;
+    series.forEach(function (s, index) {
+        const color = CHART_COLORS[index % CHART_COLORS.length];
+        svg.appendChild(svgElement('rect', { x: legendX, y: height - 12, width: 10, height: 10, fill: color }));
+        const label = svgElement('text', { x: legendX + 14, y: height - 3, class: 'legend' }, s.name);
+        svg.appendChild(label);
+        legendX += 24 + s.name.length * 7;
+    });
+
+    // 悬停时显示该分钟的数值
+    const cursor = svgElement('line', { y1: top, y2: top + plotHeight, class: 'cursor', visibility: 'hidden' });
+    const tooltip = svgElement('text', { y: top + 12, class: 'tooltip', visibility: 'hidden' });
+    svg.appendChild(cursor);
+    svg.appendChild(tooltip);
+    svg.onmousemove = function (e) {
+        const rect = svg.getBoundingClientRect();
+        const px = (e.clientX - rect.left) * width / rect.width;
+        const i = Math.round((px - left) / plotWidth * (times.length - 1));
+        if (i < 0 || i >= times.length) {
+            return;
+        }
+        cursor.setAttribute('x1', x(i));
+        cursor.setAttribute('x2', x(i));
+        cursor.setAttribute('visibility', 'visible');
+
+        const parts = [formatClock(times[i])];
+        for (const s of series) {
+            parts.push(s.name + ' ' + (s.values[i] === null ? '-' : format(s.values[i])));
+        }
+        tooltip.textContent = parts.join('  ');
+        const right = x(i) > left + plotWidth / 2;
+        tooltip.setAttribute('x', right ? x(i) - 6 : x(i) + 6);
+        tooltip.setAttribute('text-anchor', right ? 'end' : 'start');
+        tooltip.setAttribute('visibility', 'visible');
+    };
+    svg.onmouseleave = function () {
+        cursor.setAttribute('visibility', 'hidden');
+        tooltip.setAttribute('visibility', 'hidden');
+    };
+}
@@ -0,0 +1,92 @@
+// 管理界面公共函数
+
+// esc 转义 HTML 特殊字符
+function esc(value) {
+    return String(value === undefined || value === null ? '' : value)
+        .replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;').replace(/'/g, '&#39;');
+}
+
+let session = null;     // 当前登录信息，见 /api/session
+
+// loadSession 读取当前登录信息，在导航栏显示用户和退出按钮，只读账号隐藏修改操作
+async function loadSession() {
+    const resp = await fetch('/api/session');
+    if (!resp.ok) {
+        return null;
+    }
+    session = await resp.json();
+
+    const nav = document.querySelector('.nav');
+    if (session.auth_enabled && nav && !document.getElementById('session-user')) {
+        const spacer = document.createElement('span');
+        spacer.className = 'spacer';
+        const user = document.createElement('span');
+        user.id = 'session-user';
+        user.textContent = session.name + (session.role === 'read' ? '（只读）' : '');
+        const logout = document.createElement('a');
+        logout.href = '#';
+        logout.textContent = '退出';
+        logout.onclick = async function (e) {
+            e.preventDefault();
+            await api('POST', '/api/logout');
+            location.href = '/login';
+        };
+        nav.append(spacer, user, logout);
+    }
+    if (session.role === 'read') {
+        document.body.classList.add('readonly');
+    }
+    return session;
+}
+
+// api 调用管理接口，非 2xx 响应抛出带 status 的错误
+// 修改操作携带 CSRF 令牌，登录过期时跳转到登录页面
+async function api(method, path, body) {
+    const options = { method: method, headers: {} };
+    if (method !== 'GET' && path !== '/api/login') {
+        if (!session) {
+            await loadSession();
+        }
+        if (session && session.csrf_token) {
+            options.headers['X-CSRF-Token'] = session.csrf_token;
+        }
+    }
+    if (body !== undefined) {
+        options.headers['Content-Type'] = 'application/json';
+        options.body = JSON.stringify(body);
+    }
+    const resp = await fetch(path, options);
+    const text = await resp.text();
+    let data = null;
+    try { data = text ? JSON.parse(text) : null; } catch (e) { data = null; }
+    if (resp.status === 401 && path !== '/api/login') {
+        location.href = '/login?next=' + encodeURIComponent(location.pathname + location.search);
+    }
+    if (!resp.ok) {
+        const err = new Error((data && data.error) || (resp.status + ' ' + resp.statusText));
+        err.status = resp.status;
+        throw err;
+    }
+    return data;
+}
+
+// showMessage 在页面顶部显示提示信息，type 为 info、success 或 error
+function showMessage(type, text, html) {
+    const el = document.getElementById('message');
+    el.className = 'message show ' + type;
+    if (html) {
+        el.innerHTML = html;
+    } else {
+        el.textContent = text;
+    }
+}
+
+// hideMessage 隐藏提示信息
+function hideMessage() {
+    document.getElementById('message').className = 'message';
+}
+
+if (location.pathname !== '/login') {
+    loadSession();
+}
@@ -0,0 +1,159 @@
+// 概览页面：服务状态、provider 状态和最近 1 小时的趋势图
+
+const REFRESH_INTERVAL = 10000;
+
+let timeline = null;    // 最近一次读取的时间序列
+let providers = [];     // 最近一次读取的 provider 运行时状态
+
+function formatNumber(value) {
+    if (value >= 1e6) {
+        return (value / 1e6).toFixed(value >= 1e7 ? 0 : 1) + 'M';
+    }
+    if (value >= 1e3) {
+        return (value / 1e3).toFixed(value >= 1e4 ? 0 : 1) + 'k';
+    }
+    return String(Math.round(value * 10) / 10);
+}
+
+function formatMS(value) {
+    return value >= 1000 ? (value / 1000).toFixed(value >= 10000 ? 0 : 1) + 's' : Math.round(value) + 'ms';
+}
+
+function formatPercent(value) {
+    return (value * 100).toFixed(value > 0 && value < 0.1 ? 1 : 0) + '%';
+}
+
+// sum 汇总一个序列中所有点的字段
+function sum(series, field) {
+    return series.points.reduce(function (total, p) { return total + p[field]; }, 0);
+}
+
+// chartSeries 生成当前显示方式下的折线，value 从数据点取值，返回 null 表示该分钟没有数据
+function chartSeries(value) {
+    const view = document.getElementById('view').value;
+    return timeline.series
+        .filter(function (s) { return view === 'total' ? s.name === '*' : s.name !== '*'; })
+        .map(function (s) {
+            return { name: s.name === '*' ? '全部' : s.name, values: s.points.map(value) };
+        });
+}
+
+function renderCharts() {
+    if (!timeline) {
+        return;
+    }
+    const times = timeline.series[0].points.map(function (p) { return new Date(p.time); });
+    const pct = document.getElementById('percentile').value;
+
+    lineChart(document.getElementById('chart-requests'), times,
+        chartSeries(function (p) { return p.requests; }), formatNumber);
+    lineChart(document.getElementById('chart-errors'), times,
+        chartSeries(function (p) { return p.requests ? p.error_rate : null; }), formatPercent);
+    lineChart(document.getElementById('chart-latency'), times,
+        chartSeries(function (p) { return p.requests ? p['latency_' + pct + '_ms'] : null; }), formatMS);
+    lineChart(document.getElementById('chart-ttft'), times,
+        chartSeries(function (p) { return p['ttft_' + pct + '_ms'] || null; }), formatMS);
+    lineChart(document.getElementById('chart-tokens'), times,
+        chartSeries(function (p) { return p.output_tokens; }), formatNumber);
+    lineChart(document.getElementById('chart-input'), times,
+        chartSeries(function (p) { return p.input_tokens; }), formatNumber);
+}
+
+function providerBadge(status) {
+    if (status.forced) {
+        return '<span class="badge warn">强制使用</span>';
+    }
+    if (status.breaker === 'open') {
+        return '<span class="badge error">熔断中</span>';
+    }
+    if (status.budget_exhausted) {
+        return '<span class="badge error">预算耗尽</span>';
+    }
+    if (!status.available) {
+        return '<span class="badge off">' + (status.state === 'off' ? '已禁用' : '不可用') + '</span>';
+    }
+    if (status.failure_count > 0) {
+        return '<span class="badge warn">失败 ' + status.failure_count + ' 次</span>';
+    }
+    return '<span class="badge ok">正常</span>';
+}
+
+function renderProviders() {
+    const byName = {};
+    if (timeline) {
+        for (const s of timeline.series) {
+            byName[s.name] = s;
+        }
+    }
+    const tbody = document.getElementById('providers');
+    if (providers.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="7" class="muted">没有配置 provider</td></tr>';
+        return;
+    }
+    tbody.innerHTML = providers.map(function (status) {
+        const series = byName[status.name];
+        const requests = series ? sum(series, 'requests') : 0;
+        const errors = series ? sum(series, 'errors') : 0;
+        const latency = status.latency.samples ? formatMS(status.latency.p50_ms) + ' / ' + formatMS(status.latency.p90_ms) : '-';
+        return '<tr>' +
+            '<td><strong>' + esc(status.name) + '</strong></td>' +
+            '<td>' + providerBadge(status) + '</td>' +
+            '<td>' + formatNumber(requests) + '</td>' +
+            '<td>' + (requests ? formatPercent(errors / requests) : '-') + '</td>' +
+            '<td>' + latency + '</td>' +
+            '<td>' + (series ? formatNumber(sum(series, 'output_tokens')) : '0') + '</td>' +
+            '<td class="muted" title="' + esc(status.last_error) + '">' + esc(status.last_error ? status.last_error.substring(0, 60) : '') + '</td>' +
+        '</tr>';
+    }).join('');
+}
+
+function renderStatus(status) {
+    document.getElementById('stat-version').textContent = status.version;
+    document.getElementById('stat-uptime').textContent = '已运行 ' + status.uptime + '，PID ' + status.pid;
+    document.getElementById('stat-providers').textContent = status.providers_available + ' / ' + status.providers_total;
+    let routing = '路由策略 ' + status.routing_strategy;
+    if (status.forced_provider) {
+        routing += '，强制使用 ' + status.forced_provider;
+    }
+    document.getElementById('stat-routing').textContent = routing;
+
+    const total = timeline.series[0];
+    const requests = sum(total, 'requests'), errors = sum(total, 'errors');
+    document.getElementById('stat-requests').textContent = formatNumber(requests);
+    document.getElementById('stat-errors').textContent = '错误 ' + errors + (requests ? '（' + formatPercent(errors / requests) + '）' : '');
+    document.getElementById('stat-tokens').textContent = formatNumber(sum(total, 'output_tokens'));
+    document.getElementById('stat-input').textContent = '输出，输入 ' + formatNumber(sum(total, 'input_tokens'));
+}
+
+async function refresh() {
+    try {
+        const results = await Promise.all([api('GET', '/api/status'), api('GET', '/api/providers'), api('GET', '/api/timeline')]);
+        timeline = results[2];
+        providers = results[1];
+        renderStatus(results[0]);
+        renderProviders();
+        renderCharts();
+        hideMessage();
+        document.getElementById('updated').textContent = '更新于 ' + new Date().toLocaleTimeString();
+    } catch (err) {
+        showMessage('error', '读取服务状态失败: ' + err.message);
+    }
+}
+
+document.getElementById('view').addEventListener('change', renderCharts);
+document.getElementById('percentile').addEventListener('change', renderCharts);
+window.addEventListener('resize', renderCharts);
+
+// 页面不可见时暂停刷新，切换回来后立即刷新
+setInterval(function () {
+    if (!document.hidden) {
+        refresh();
+    }
+}, REFRESH_INTERVAL);
+document.addEventListener('visibilitychange', function () {
+    if (!document.hidden) {
+        refresh();
+    }
+});
+
+refresh();
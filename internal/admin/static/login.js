@@ -0,0 +1,26 @@
+// 登录页面
+
+// nextPage 登录后返回的页面，只允许本站路径
+function nextPage() {
+    const next = new URLSearchParams(location.search).get('next') || '/';
+    return next.startsWith('/') && !next.startsWith('//') ? next : '/';
+}
+
+document.getElementById('login-form').addEventListener('submit', async function (e) {
+    e.preventDefault();
+    const username = document.getElementById('username').value.trim();
+    const password = document.getElementById('password').value;
+    const body = username ? { username: username, password: password } : { token: password };
+
+    const button = document.getElementById('submit');
+    button.disabled = true;
+    try {
+        await api('POST', '/api/login', body);
+        location.href = nextPage();
+    } catch (err) {
+        button.disabled = false;
+        showMessage('error', '登录失败: ' + err.message);
+    }
+});
+
+document.getElementById('username').focus();
@@ -0,0 +1,164 @@
+// 实时日志查看
+
+const MAX_LINES = 2000;
+
+let source = null;      // 当前的 EventSource 连接
+let paused = false;
+let pending = [];       // 暂停期间收到的日志
+let search = null;      // 页面内搜索的正则表达式
+
+document.getElementById('max-lines').textContent = MAX_LINES;
+
+// streamURL 根据服务端过滤条件生成推送地址
+function streamURL() {
+    const params = new URLSearchParams();
+    params.set('level', document.getElementById('level').value);
+    const fields = { module: 'module', provider: 'provider', request_id: 'request-id' };
+    for (const key of Object.keys(fields)) {
+        const value = document.getElementById(fields[key]).value.trim();
+        if (value) {
+            params.set(key, value);
+        }
+    }
+    return '/api/logs/stream?' + params.toString();
+}
+
+function setState(type, text) {
+    const el = document.getElementById('state');
+    el.className = 'badge ' + type;
+    el.textContent = text;
+}
+
+// connect 按当前过滤条件重新连接，EventSource 断开后会自动重连
+function connect() {
+    if (source) {
+        source.close();
+    }
+    document.getElementById('logs').innerHTML = '';
+    pending = [];
+    setState('off', '连接中');
+
+    source = new EventSource(streamURL());
+    source.onopen = function () {
+        hideMessage();
+        setState('ok', '已连接');
+    };
+    source.onerror = function () {
+        setState('error', '连接断开，正在重连');
+    };
+    source.onmessage = function (e) {
+        const record = JSON.parse(e.data);
+        if (paused) {
+            pending.push(record);
+            document.getElementById('pause').textContent = '继续 (' + pending.length + ')';
+        } else {
+            append([record]);
+        }
+    };
+    source.addEventListener('dropped', function (e) {
+        append([{ level: 'WARN', module: 'ADMIN', time: '', message: '推送不及时，丢弃了 ' + e.data + ' 条日志' }]);
+    });
+}
+
+function formatTime(value) {
+    // 2006-01-02T15:04:05.000+08:00 只显示时间部分
+    return value ? value.substring(11, 23) : '';
+}
+
+function render(record) {
+    const row = document.createElement('div');
+    row.className = 'log-line ' + (record.level || '').toLowerCase();
+
+    let text = formatTime(record.time) + ' [' + record.level + '] ' + record.module;
+    if (record.request_id) {
+        text += ' [' + record.request_id + ']';
+    }
+    if (record.provider) {
+        text += ' [' + record.provider + ']';
+    }
+    text += ' ' + record.message;
+    if (record.error) {
+        text += ': ' + record.error;
+    }
+    if (record.status) {
+        text += ' status=' + record.status;
+    }
+    if (record.duration_ms) {
+        text += ' ' + record.duration_ms + 'ms';
+    }
+    row.textContent = text;
+    if (search && !search.test(text)) {
+        row.hidden = true;
+    }
+    if (record.request_id) {
+        row.title = '点击只看请求 ' + record.request_id + ' 的日志';
+        row.dataset.requestId = record.request_id;
+    }
+    return row;
+}
+
+function append(records) {
+    const view = document.getElementById('logs');
+    // 已滚动到底部时自动跟随新日志
+    const follow = view.scrollTop + view.clientHeight >= view.scrollHeight - 20;
+    const fragment = document.createDocumentFragment();
+    for (const record of records) {
+        fragment.appendChild(render(record));
+    }
+    view.appendChild(fragment);
+    while (view.childElementCount > MAX_LINES) {
+        view.removeChild(view.firstChild);
+    }
+    if (follow) {
+        view.scrollTop = view.scrollHeight;
+    }
+}
+
+function applySearch() {
+    const value = document.getElementById('search').value;
+    try {
+        search = value ? new RegExp(value, 'i') : null;
+        hideMessage();
+    } catch (err) {
+        showMessage('error', '无效的搜索表达式: ' + err.message);
+        return;
+    }
+    for (const row of document.getElementById('logs').children) {
+        row.hidden = search !== null && !search.test(row.textContent);
+    }
+}
+
+document.getElementById('pause').onclick = function () {
+    paused = !paused;
+    this.textContent = paused ? '继续' : '暂停';
+    if (!paused && pending.length) {
+        append(pending);
+        pending = [];
+    }
+};
+document.getElementById('clear').onclick = function () {
+    document.getElementById('logs').innerHTML = '';
+    pending = [];
+};
+document.getElementById('logs').addEventListener('click', function (e) {
+    const requestID = e.target.dataset.requestId;
+    if (requestID && window.getSelection().toString() === '') {
+        document.getElementById('request-id').value = requestID;
+        connect();
+    }
+});
+for (const id of ['level', 'module', 'provider', 'request-id']) {
+    document.getElementById(id).addEventListener('change', connect);
+}
+document.getElementById('search').addEventListener('input', applySearch);
+
+// 支持通过 /logs?request_id=xxx&level=DEBUG 打开时预设过滤条件
+const initial = new URLSearchParams(location.search);
+if (initial.get('request_id')) {
+    document.getElementById('request-id').value = initial.get('request_id');
+}
+if (initial.get('level')) {
+    document.getElementById('level').value = initial.get('level').toUpperCase();
+}
+
+connect();
@@ -0,0 +1,276 @@
+// Playground：在浏览器中发送 Messages 请求，查看流式回答、原始 SSE 事件、响应头和用量
+
+const MAX_RAW_EVENTS = 1000;
+
+let controller = null;  // 当前请求的 AbortController
+let rawEvents = 0;
+
+async function loadProviders() {
+    try {
+        const select = document.getElementById('provider');
+        for (const status of await api('GET', '/api/providers')) {
+            const option = document.createElement('option');
+            option.value = status.name;
+            option.textContent = status.name + (status.available ? '' : '（' + (status.state === 'off' ? '已禁用' : '不可用') + '）');
+            select.appendChild(option);
+        }
+    } catch (err) {
+        showMessage('error', '读取 provider 列表失败: ' + err.message);
+    }
+}
+
+// buildRequest 根据表单生成 Messages API 请求体
+function buildRequest() {
+    const body = {
+        model: document.getElementById('model').value.trim(),
+        max_tokens: Number(document.getElementById('max-tokens').value),
+        messages: [{ role: 'user', content: document.getElementById('prompt').value }],
+    };
+    const system = document.getElementById('system').value.trim();
+    if (system) {
+        body.system = system;
+    }
+    if (document.getElementById('stream').checked) {
+        body.stream = true;
+    }
+    if (document.getElementById('thinking').checked) {
+        const budget = Number(document.getElementById('budget').value);
+        body.thinking = { type: 'enabled', budget_tokens: budget };
+        // max_tokens 必须大于 thinking 预算
+        if (body.max_tokens <= budget) {
+            body.max_tokens = budget + 1024;
+        }
+    }
+    return body;
+}
+
+function setState(type, text) {
+    const el = document.getElementById('state');
+    el.className = 'badge ' + type;
+    el.textContent = text;
+}
+
+function setSummary(rows) {
+    document.getElementById('summary').innerHTML = rows.map(function (row) {
+        return '<tr><th>' + row[0] + '</th><td class="mono">' + esc(row[1]) + '</td></tr>';
+    }).join('');
+}
+
+function appendRaw(text) {
+    if (rawEvents++ < MAX_RAW_EVENTS) {
+        document.getElementById('raw').textContent += text + '\n\n';
+    }
+    document.getElementById('raw-title').textContent = '原始 SSE 事件（' + rawEvents + '）';
+}
+
+function appendText(id, text) {
+    document.getElementById(id).textContent += text;
+}
+
+// newSummary 创建响应摘要，流式响应读取过程中逐步更新模型、stop_reason 和用量
+function newSummary(resp, startTime) {
+    return {
+        status: resp.status + ' ' + resp.statusText,
+        requestID: resp.headers.get('x-ccenv-request-id') || '',
+        servedModel: resp.headers.get('x-ccenv-served-model') || '',
+        model: '',
+        stopReason: '',
+        usage: {},
+        headersMS: Date.now() - startTime,
+        ttftMS: 0,
+        totalMS: 0,
+    };
+}
+
+function renderSummary(summary) {
+    const usage = summary.usage;
+    const rows = [
+        ['状态码', summary.status],
+        ['请求ID', summary.requestID || '-'],
+        ['实际服务模型', summary.servedModel || '-'],
+        ['响应 model', summary.model || '-'],
+        ['耗时', '响应头 ' + summary.headersMS + 'ms' + (summary.ttftMS ? '，首 token ' + summary.ttftMS + 'ms' : '') + (summary.totalMS ? '，总计 ' + summary.totalMS + 'ms' : '')],
+        ['stop_reason', summary.stopReason || '-'],
+        ['Token', '输入 ' + (usage.input_tokens || 0) + '，输出 ' + (usage.output_tokens || 0) +
+            (usage.cache_read_input_tokens ? '，缓存读取 ' + usage.cache_read_input_tokens : '') +
+            (usage.cache_creation_input_tokens ? '，缓存写入 ' + usage.cache_creation_input_tokens : '')],
+    ];
+    setSummary(rows);
+    const link = document.getElementById('request-link');
+    link.hidden = !summary.requestID;
+    link.href = '/requests?id=' + encodeURIComponent(summary.requestID);
+}
+
+// applyMessage 从 message 对象（非流式响应或 message_start 事件）提取内容和用量
+function applyMessage(message, summary) {
+    summary.model = message.model || summary.model;
+    summary.stopReason = message.stop_reason || summary.stopReason;
+    Object.assign(summary.usage, message.usage || {});
+    for (const block of message.content || []) {
+        if (block.type === 'thinking') {
+            document.getElementById('thinking-block').hidden = false;
+            appendText('thinking-text', block.thinking || '');
+        } else if (block.type === 'text') {
+            appendText('answer', block.text || '');
+        } else if (block.type === 'tool_use') {
+            appendText('answer', '\n[tool_use ' + block.name + '] ' + JSON.stringify(block.input));
+        }
+    }
+}
+
+// applyEvent 处理一个 SSE 事件
+function applyEvent(event, summary) {
+    switch (event.type) {
+    case 'message_start':
+        applyMessage(event.message || {}, summary);
+        break;
+    case 'content_block_start':
+        if (event.content_block && event.content_block.type === 'thinking') {
+            document.getElementById('thinking-block').hidden = false;
+        }
+        break;
+    case 'content_block_delta':
+        if (event.delta.type === 'text_delta') {
+            appendText('answer', event.delta.text);
+        } else if (event.delta.type === 'thinking_delta') {
+            appendText('thinking-text', event.delta.thinking);
+        }
+        break;
+    case 'message_delta':
+        summary.stopReason = (event.delta && event.delta.stop_reason) || summary.stopReason;
+        Object.assign(summary.usage, event.usage || {});
+        break;
+    case 'error':
+        showMessage('error', '流式响应返回错误: ' + JSON.stringify(event.error));
+        break;
+    }
+}
+
+// readStream 逐个解析 SSE 事件，原始事件同时显示在页面上
+async function readStream(resp, summary, startTime) {
+    const reader = resp.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    for (;;) {
+        const chunk = await reader.read();
+        if (chunk.done) {
+            break;
+        }
+        buffer += decoder.decode(chunk.value, { stream: true }).replace(/\r\n/g, '\n');
+        let end;
+        while ((end = buffer.indexOf('\n\n')) >= 0) {
+            const raw = buffer.slice(0, end);
+            buffer = buffer.slice(end + 2);
+            if (!raw.trim()) {
+                continue;
+            }
+            appendRaw(raw);
+            const data = raw.split('\n').filter(function (line) { return line.startsWith('data:'); })
+                .map(function (line) { return line.slice(5).trim(); }).join('\n');
+            try {
+                const event = JSON.parse(data);
+                // 与代理统计的 TTFT 口径一致：收到第一个 content_block_delta 的耗时
+                if (!summary.ttftMS && event.type === 'content_block_delta') {
+                    summary.ttftMS = Date.now() - startTime;
+                }
+                applyEvent(event, summary);
+            } catch (e) {
+                // 非 JSON 事件（如 ping 注释）只显示原始内容
+            }
+        }
+        renderSummary(summary);
+    }
+}
+
+async function send() {
+    const body = buildRequest();
+    if (!body.model) {
+        showMessage('error', '请输入模型');
+        return;
+    }
+    hideMessage();
+    for (const id of ['answer', 'thinking-text', 'headers', 'raw']) {
+        document.getElementById(id).textContent = '';
+    }
+    rawEvents = 0;
+    document.getElementById('raw-title').textContent = body.stream ? '原始 SSE 事件' : '原始响应';
+    document.getElementById('thinking-block').hidden = true;
+    document.getElementById('result').hidden = false;
+    setSummary([]);
+    setState('warn', '请求中');
+
+    if (!session) {
+        await loadSession();
+    }
+    const headers = { 'Content-Type': 'application/json' };
+    if (session && session.csrf_token) {
+        headers['X-CSRF-Token'] = session.csrf_token;
+    }
+    const provider = document.getElementById('provider').value;
+    if (provider) {
+        headers['X-Ccenv-Provider'] = provider;
+    }
+
+    controller = new AbortController();
+    document.getElementById('send').disabled = true;
+    document.getElementById('stop').disabled = false;
+    const startTime = Date.now();
+    try {
+        const resp = await fetch('/api/playground/messages', {
+            method: 'POST', headers: headers, body: JSON.stringify(body), signal: controller.signal,
+        });
+        if (resp.status === 401) {
+            location.href = '/login?next=' + encodeURIComponent(location.pathname);
+            return;
+        }
+        const summary = newSummary(resp, startTime);
+        const lines = [];
+        resp.headers.forEach(function (value, key) { lines.push(key + ': ' + value); });
+        document.getElementById('headers').textContent = lines.sort().join('\n');
+
+        if (resp.ok && (resp.headers.get('Content-Type') || '').startsWith('text/event-stream')) {
+            await readStream(resp, summary, startTime);
+        } else {
+            const text = await resp.text();
+            document.getElementById('raw').textContent = text;
+            try {
+                const data = JSON.parse(text);
+                if (resp.ok) {
+                    applyMessage(data, summary);
+                } else {
+                    showMessage('error', '请求失败: ' + ((data.error && data.error.message) || text));
+                }
+            } catch (e) {
+                showMessage('error', '解析响应失败: ' + text.substring(0, 200));
+            }
+        }
+        summary.totalMS = Date.now() - startTime;
+        renderSummary(summary);
+        setState(resp.ok ? 'ok' : 'error', resp.ok ? '完成' : '失败');
+    } catch (err) {
+        if (err.name === 'AbortError') {
+            setState('off', '已停止');
+        } else {
+            setState('error', '失败');
+            showMessage('error', '请求失败: ' + err.message);
+        }
+    } finally {
+        controller = null;
+        document.getElementById('send').disabled = false;
+        document.getElementById('stop').disabled = true;
+    }
+}
+
+document.getElementById('send').onclick = send;
+document.getElementById('stop').onclick = function () {
+    if (controller) {
+        controller.abort();
+    }
+};
+document.getElementById('prompt').addEventListener('keydown', function (e) {
+    if (e.key === 'Enter' && (e.ctrlKey || e.metaKey)) {
+        send();
+    }
+});
+
+loadProviders();
@@ -0,0 +1,314 @@
+// Provider 配置编辑器
+
+// 由编辑表单单独管理的字段，其余字段在"其他配置"中以 JSON 编辑
+const BASE_FIELDS = ['name', 'state', 'env', 'original_name'];
+const SENSITIVE = /TOKEN|KEY|SECRET|PASSWORD|AUTHORIZATION/i;
+
+let hash = '';          // 读取时的配置文件哈希，保存时用于检测并发修改
+let providers = [];     // 当前编辑中的 providers
+let runtime = {};       // 运行中代理服务的 provider 状态，按名称索引
+let editing = -1;       // 正在编辑的下标，-1 表示新增
+let dirty = false;
+
+async function load() {
+    try {
+        const doc = await api('GET', '/api/config/providers');
+        hash = doc.hash;
+        providers = doc.providers;
+        setDirty(false);
+        closeEditor();
+    } catch (err) {
+        showMessage('error', '读取配置失败: ' + err.message);
+        return;
+    }
+    try {
+        runtime = {};
+        for (const status of await api('GET', '/api/providers')) {
+            runtime[status.name] = status;
+        }
+    } catch (err) {
+        runtime = {};
+    }
+    render();
+}
+
+function setDirty(value) {
+    dirty = value;
+    document.getElementById('dirty').hidden = !value;
+    document.getElementById('save').disabled = !value;
+}
+
+// runtimeBadge 显示运行中代理服务的 provider 状态，配置未保存或未重载时可能与列表不一致
+function runtimeBadge(p) {
+    const status = runtime[p.original_name || p.name];
+    if (!status) {
+        return '<span class="badge off">未加载</span>';
+    }
+    if (status.forced) {
+        return '<span class="badge warn">强制使用</span>';
+    }
+    if (status.breaker === 'open') {
+        return '<span class="badge error" title="' + esc(status.last_error) + '">熔断中</span>';
+    }
+    if (!status.available) {
+        return '<span class="badge off">不可用</span>';
+    }
+    if (status.failure_count > 0) {
+        return '<span class="badge warn" title="' + esc(status.last_error) + '">失败 ' + status.failure_count + ' 次</span>';
+    }
+    return '<span class="badge ok">正常</span>';
+}
+
+function render() {
+    const tbody = document.getElementById('providers');
+    if (providers.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="7" class="muted">还没有 provider，点击"新增 provider"添加</td></tr>';
+        return;
+    }
+    tbody.innerHTML = providers.map(function (p, i) {
+        const env = p.env || {};
+        return '<tr>' +
+            '<td class="muted">' + (i + 1) + '</td>' +
+            '<td><strong>' + esc(p.name) + '</strong></td>' +
+            '<td><input type="checkbox" data-toggle="' + i + '"' + (p.state === 'on' ? ' checked' : '') + '></td>' +
+            '<td class="mono">' + esc(env.ANTHROPIC_BASE_URL) + '</td>' +
+            '<td class="mono">' + esc(env.ANTHROPIC_MODEL || '-') + '</td>' +
+            '<td>' + runtimeBadge(p) + '</td>' +
+            '<td class="actions">' +
+                '<button class="secondary small" data-move="' + i + '" data-delta="-1"' + (i === 0 ? ' disabled' : '') + '>↑</button> ' +
+                '<button class="secondary small" data-move="' + i + '" data-delta="1"' + (i === providers.length - 1 ? ' disabled' : '') + '>↓</button> ' +
+                (runtime[p.original_name || p.name] ? '<button class="secondary small" data-test="' + esc(p.original_name || p.name) + '">测试</button> ' : '') +
+                '<button class="secondary small" data-edit="' + i + '">编辑</button> ' +
+                '<button class="danger small" data-delete="' + i + '">删除</button>' +
+            '</td>' +
+        '</tr>';
+    }).join('');
+}
+
+document.getElementById('providers').addEventListener('click', function (e) {
+    const target = e.target;
+    if (target.dataset.move !== undefined) {
+        const i = Number(target.dataset.move), j = i + Number(target.dataset.delta);
+        const moved = providers.splice(i, 1)[0];
+        providers.splice(j, 0, moved);
+        setDirty(true);
+        render();
+    } else if (target.dataset.test !== undefined) {
+        probe(target.dataset.test);
+    } else if (target.dataset.edit !== undefined) {
+        openEditor(Number(target.dataset.edit));
+    } else if (target.dataset.delete !== undefined) {
+        const i = Number(target.dataset.delete);
+        if (confirm('删除 provider ' + providers[i].name + '？保存后才会写入配置文件。')) {
+            providers.splice(i, 1);
+            setDirty(true);
+            closeEditor();
+            render();
+        }
+    }
+});
+
+document.getElementById('providers').addEventListener('change', function (e) {
+    if (e.target.dataset.toggle !== undefined) {
+        providers[Number(e.target.dataset.toggle)].state = e.target.checked ? 'on' : 'off';
+        setDirty(true);
+    }
+});
+
+function formatProbeMS(value) {
+    return value ? Math.round(value) + 'ms' : '-';
+}
+
+// renderProbe 显示一次测试的结果
+function renderProbe(result) {
+    const rows = [
+        ['请求', (result.stream ? '流式' : '非流式') + '，' + result.request_id],
+        ['URL', result.url + (result.proxy ? '（代理 ' + result.proxy + '）' : '')],
+        ['模型', result.requested_model + ' → ' + result.model + (result.served_model ? '，响应 ' + result.served_model : '')],
+        ['连接', (result.remote_addr || '-') + (result.tls_version ? '，' + result.tls_version : '')],
+        ['耗时', 'DNS ' + formatProbeMS(result.dns_ms) + '，连接 ' + formatProbeMS(result.connect_ms) + '，TLS ' + formatProbeMS(result.tls_ms) +
+            '，响应头 ' + formatProbeMS(result.headers_ms) + (result.stream ? '，首 token ' + formatProbeMS(result.ttft_ms) : '') + '，总计 ' + formatProbeMS(result.total_ms)],
+        ['状态码', result.status ? String(result.status) + (result.upstream_request_id ? '，上游请求 ID ' + result.upstream_request_id : '') : '-'],
+        ['Token', '输入 ' + result.usage.input_tokens + '，输出 ' + result.usage.output_tokens + (result.stop_reason ? '，stop_reason ' + result.stop_reason : '')],
+    ];
+    if (result.reply) {
+        rows.push(['回复', result.reply]);
+    }
+    if (result.error) {
+        rows.push(['错误', result.error]);
+    }
+    if (result.error_body) {
+        rows.push(['错误响应', result.error_body]);
+    }
+    return '<h3>' + (result.error ? '<span class="badge error">失败</span> ' : '<span class="badge ok">成功</span> ') +
+        esc(result.provider) + (result.stream ? ' 流式' : ' 非流式') + '</h3>' +
+        '<table class="kv">' + rows.map(function (row) {
+            return '<tr><th>' + row[0] + '</th><td class="mono">' + esc(row[1]) + '</td></tr>';
+        }).join('') + '</table>';
+}
+
+async function probe(name) {
+    const results = document.getElementById('probe-results');
+    results.className = 'muted';
+    results.textContent = '正在测试 ' + name + '...';
+    try {
+        const data = await api('POST', '/api/providers/' + encodeURIComponent(name) + '/test', {
+            model: document.getElementById('probe-model').value.trim(),
+            mode: document.getElementById('probe-mode').value,
+        });
+        results.className = '';
+        results.innerHTML = data.map(renderProbe).join('');
+    } catch (err) {
+        results.className = '';
+        results.textContent = '';
+        showMessage('error', '测试 ' + name + ' 失败: ' + err.message);
+    }
+    document.getElementById('probe').scrollIntoView({ behavior: 'smooth' });
+}
+
+function addEnvRow(key, value) {
+    const row = document.createElement('div');
+    row.className = 'env-row';
+    row.innerHTML = '<input class="key mono" placeholder="变量名"><input class="value mono" placeholder="值">' +
+        '<button class="secondary small" type="button">删除</button>';
+    row.querySelector('.key').value = key || '';
+    row.querySelector('.value').value = value || '';
+    if (SENSITIVE.test(key || '')) {
+        row.querySelector('.value').title = '密钥以打码形式显示，不修改时保存后保持原值';
+    }
+    row.querySelector('button').onclick = function () { row.remove(); };
+    document.getElementById('edit-env').appendChild(row);
+}
+
+function openEditor(index) {
+    editing = index;
+    const p = index >= 0 ? providers[index] : {
+        name: '', state: 'on',
+        env: { ANTHROPIC_BASE_URL: '', ANTHROPIC_AUTH_TOKEN: '', ANTHROPIC_MODEL: '' }
+    };
+
+    document.getElementById('editor-title').textContent = index >= 0 ? '编辑 provider ' + p.name : '新增 provider';
+    document.getElementById('edit-name').value = p.name;
+    document.getElementById('edit-state').value = p.state === 'off' ? 'off' : 'on';
+
+    document.getElementById('edit-env').innerHTML = '';
+    for (const key of Object.keys(p.env || {})) {
+        addEnvRow(key, p.env[key]);
+    }
+
+    const extra = {};
+    for (const key of Object.keys(p)) {
+        if (BASE_FIELDS.indexOf(key) < 0) {
+            extra[key] = p[key];
+        }
+    }
+    document.getElementById('edit-extra').value = Object.keys(extra).length ? JSON.stringify(extra, null, 2) : '{}';
+
+    document.getElementById('editor').hidden = false;
+    document.getElementById('edit-name').focus();
+}
+
+function closeEditor() {
+    document.getElementById('editor').hidden = true;
+    editing = -1;
+}
+
+// applyEditor 将表单内容写回列表（尚未保存到配置文件）
+function applyEditor() {
+    const name = document.getElementById('edit-name').value.trim();
+    if (!name) {
+        showMessage('error', '名称不能为空');
+        return;
+    }
+    for (let i = 0; i < providers.length; i++) {
+        if (i !== editing && providers[i].name === name) {
+            showMessage('error', '名称 ' + name + ' 已存在');
+            return;
+        }
+    }
+
+    let extra;
+    try {
+        extra = JSON.parse(document.getElementById('edit-extra').value || '{}');
+        if (typeof extra !== 'object' || extra === null || Array.isArray(extra)) {
+            throw new Error('应为 JSON 对象');
+        }
+    } catch (err) {
+        showMessage('error', '其他配置不是有效的 JSON 对象: ' + err.message);
+        return;
+    }
+
+    const env = {};
+    for (const row of document.querySelectorAll('#edit-env .env-row')) {
+        const key = row.querySelector('.key').value.trim();
+        if (key) {
+            env[key] = row.querySelector('.value').value;
+        }
+    }
+
+    const p = Object.assign({}, extra, {
+        name: name,
+        state: document.getElementById('edit-state').value,
+        env: env
+    });
+    if (editing >= 0) {
+        p.original_name = providers[editing].original_name;
+        providers[editing] = p;
+    } else {
+        providers.push(p);
+    }
+
+    hideMessage();
+    setDirty(true);
+    closeEditor();
+    render();
+}
+
+async function save() {
+    const button = document.getElementById('save');
+    button.disabled = true;
+    try {
+        const result = await api('PUT', '/api/config/providers', { hash: hash, providers: providers });
+        let text = '已保存到 settings.json，代理服务将自动重载配置';
+        if (result.warnings && result.warnings.length) {
+            text += '\n注意:\n' + result.warnings.join('\n');
+        }
+        hash = result.hash;
+        for (const p of providers) {
+            p.original_name = p.name;
+        }
+        setDirty(false);
+        render();
+        showMessage(result.warnings && result.warnings.length ? 'info' : 'success', text);
+        // 等待代理服务重载后重新读取配置和运行状态
+        setTimeout(function () { if (!dirty) { load(); } }, 2000);
+    } catch (err) {
+        button.disabled = false;
+        if (err.status === 409) {
+            showMessage('error', '', esc(err.message) +
+                ' <button class="secondary small" onclick="load()">放弃修改并重新读取</button>');
+        } else {
+            showMessage('error', '保存失败: ' + err.message);
+        }
+    }
+}
+
+document.getElementById('add').onclick = function () { openEditor(-1); };
+document.getElementById('add-env').onclick = function () { addEnvRow('', ''); };
+document.getElementById('apply').onclick = applyEditor;
+document.getElementById('cancel').onclick = closeEditor;
+document.getElementById('save').onclick = save;
+document.getElementById('reload').onclick = function () {
+    if (!dirty || confirm('放弃未保存的修改？')) {
+        hideMessage();
+        load();
+    }
+};
+window.addEventListener('beforeunload', function (e) {
+    if (dirty) {
+        e.preventDefault();
+        e.returnValue = '';
+    }
+});
+
+load();
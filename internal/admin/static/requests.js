@@ -0,0 +1,162 @@
+// 最近请求列表和详情
+
+const REFRESH_INTERVAL = 5000;
+
+let requests = [];      // 最近一次读取的请求列表
+let selected = '';      // 正在查看详情的请求ID
+
+function formatTime(value) {
+    const date = new Date(value);
+    return date.toLocaleTimeString() + '.' + String(date.getMilliseconds()).padStart(3, '0');
+}
+
+function formatDuration(ms) {
+    return ms >= 1000 ? (ms / 1000).toFixed(ms >= 10000 ? 0 : 1) + 's' : ms + 'ms';
+}
+
+function statusBadge(request) {
+    if (!request.finished_at) {
+        return '<span class="badge warn">处理中</span>';
+    }
+    return '<span class="badge ' + (request.status >= 400 ? 'error' : 'ok') + '">' + request.status + '</span>';
+}
+
+// modelText 显示请求模型，实际服务的模型不同时一并显示
+function modelText(request) {
+    if (request.served_model && request.served_model !== request.requested_model) {
+        return esc(request.requested_model) + ' → ' + esc(request.served_model);
+    }
+    return esc(request.requested_model || '-');
+}
+
+function render() {
+    const tbody = document.getElementById('requests');
+    if (requests.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="8" class="muted">没有符合条件的请求</td></tr>';
+        return;
+    }
+    tbody.innerHTML = requests.map(function (r) {
+        const fallbacks = r.attempts.length > 1 ? ' <span class="badge warn">' + r.attempts.length + '</span>' : String(r.attempts.length);
+        return '<tr class="clickable' + (r.id === selected ? ' selected' : '') + '" data-id="' + esc(r.id) + '">' +
+            '<td>' + formatTime(r.started_at) + '</td>' +
+            '<td class="mono">' + esc(r.id) + '</td>' +
+            '<td class="mono">' + modelText(r) + (r.stream ? '' : ' <span class="muted">非流式</span>') + '</td>' +
+            '<td>' + esc(r.provider || '-') + '</td>' +
+            '<td>' + fallbacks + '</td>' +
+            '<td>' + statusBadge(r) + '</td>' +
+            '<td>' + formatDuration(r.duration_ms) + (r.ttft_ms ? ' / ' + formatDuration(r.ttft_ms) : '') + '</td>' +
+            '<td>' + r.usage.input_tokens + ' / ' + r.usage.output_tokens + '</td>' +
+        '</tr>';
+    }).join('');
+}
+
+function renderDetail(r) {
+    document.getElementById('detail-title').textContent = '请求 ' + r.id;
+    document.getElementById('detail-logs').href = '/logs?request_id=' + encodeURIComponent(r.id) + '&level=DEBUG';
+
+    const usage = r.usage;
+    const fields = [
+        ['开始时间', new Date(r.started_at).toLocaleString()],
+        ['状态', r.finished_at ? String(r.status) : '处理中'],
+        ['耗时', formatDuration(r.duration_ms) + (r.ttft_ms ? '，首 token ' + formatDuration(r.ttft_ms) : '')],
+        ['请求模型', (r.requested_model || '-') + (r.stream ? '（流式）' : '（非流式）')],
+        ['实际服务', r.provider ? r.provider + ' / ' + r.served_model : '-'],
+        ['上游请求ID', r.upstream_request_id || '-'],
+        ['Token', '输入 ' + usage.input_tokens + '，输出 ' + usage.output_tokens +
+            (usage.cache_read_input_tokens ? '，缓存读取 ' + usage.cache_read_input_tokens : '') +
+            (usage.cache_creation_input_tokens ? '，缓存写入 ' + usage.cache_creation_input_tokens : '')],
+        ['会话', r.session || '-'],
+        ['User-Agent', r.user_agent || '-'],
+    ];
+    document.getElementById('detail-fields').innerHTML = fields.map(function (f) {
+        return '<tr><th>' + f[0] + '</th><td class="mono">' + esc(f[1]) + '</td></tr>';
+    }).join('');
+
+    document.getElementById('detail-attempts').innerHTML = r.attempts.length === 0
+        ? '<tr><td colspan="8" class="muted">没有发送到上游</td></tr>'
+        : r.attempts.map(function (a, i) {
+            let status = a.status ? String(a.status) : '-';
+            if (a.overloaded) {
+                status += ' 限流/过载';
+            }
+            return '<tr>' +
+                '<td class="muted">' + (i + 1) + '</td>' +
+                '<td>' + formatTime(a.started_at) + '</td>' +
+                '<td>' + esc(a.provider) + '</td>' +
+                '<td class="mono">' + esc(a.model) + '</td>' +
+                '<td>' + esc(status) + '</td>' +
+                '<td>' + (a.status || a.error ? formatDuration(a.latency_ms) : '-') + '</td>' +
+                '<td class="mono">' + esc(a.upstream_request_id || '-') + '</td>' +
+                '<td class="muted">' + esc(a.error || '') + '</td>' +
+            '</tr>';
+        }).join('');
+
+    document.getElementById('detail-error').hidden = !r.error_body;
+    document.getElementById('detail-error-body').textContent = r.error_body || '';
+    document.getElementById('detail').hidden = false;
+}
+
+async function showDetail(id) {
+    selected = id;
+    render();
+    try {
+        renderDetail(await api('GET', '/api/requests/' + encodeURIComponent(id)));
+    } catch (err) {
+        showMessage('error', '读取请求详情失败: ' + err.message);
+    }
+}
+
+async function refresh() {
+    const params = new URLSearchParams();
+    const provider = document.getElementById('provider').value.trim();
+    const status = document.getElementById('status').value;
+    if (provider) {
+        params.set('provider', provider);
+    }
+    if (status) {
+        params.set('status', status);
+    }
+    try {
+        requests = await api('GET', '/api/requests?' + params.toString());
+        hideMessage();
+    } catch (err) {
+        showMessage('error', '读取最近请求失败: ' + err.message);
+        return;
+    }
+    render();
+
+    // 正在查看的请求仍在处理时同步更新详情
+    const current = requests.find(function (r) { return r.id === selected; });
+    if (current && !document.getElementById('detail').hidden) {
+        renderDetail(current);
+    }
+}
+
+document.getElementById('requests').addEventListener('click', function (e) {
+    const row = e.target.closest('tr[data-id]');
+    if (row) {
+        showDetail(row.dataset.id);
+    }
+});
+document.getElementById('detail-close').onclick = function () {
+    selected = '';
+    document.getElementById('detail').hidden = true;
+    render();
+};
+document.getElementById('refresh').onclick = refresh;
+document.getElementById('provider').addEventListener('change', refresh);
+document.getElementById('status').addEventListener('change', refresh);
+
+setInterval(function () {
+    if (!document.hidden && document.getElementById('auto').checked) {
+        refresh();
+    }
+}, REFRESH_INTERVAL);
+
+// 支持通过 /requests?id=xxx 直接打开某个请求的详情
+const initial = new URLSearchParams(location.search).get('id');
+refresh().then(function () {
+    if (initial) {
+        showDetail(initial);
+    }
+});
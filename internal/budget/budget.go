@@ -0,0 +1,317 @@
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/usage"
+)
+
+// globalScope 全局预算在计数器中的键
+const globalScope = "*"
+
+// flushInterval 用量状态写入文件的间隔，避免每个请求都写文件
+const flushInterval = 5 * time.Second
+
+// Counter 表示一个周期内的用量累计
+type Counter struct {
+	Tokens int64   `json:"tokens"`
+	Cost   float64 `json:"cost"`
+}
+
+// state 表示持久化的预算用量状态
+type state struct {
+	Day     string              `json:"day"`     // 当前统计日 (2006-01-02)
+	Month   string              `json:"month"`   // 当前统计月 (2006-01)
+	Daily   map[string]*Counter `json:"daily"`   // 按 provider 的当日用量，全局用量键为 "*"
+	Monthly map[string]*Counter `json:"monthly"` // 按 provider 的当月用量，全局用量键为 "*"
+	Warned  map[string]bool     `json:"warned"`  // 本周期内已发出的告警，避免重复告警
+}
+
+// Tracker 预算追踪器，记录用量并判断预算是否耗尽，状态定期持久化到 ~/.claude-code-env/budget.json
+type Tracker struct {
+	path       string
+	global     config.BudgetLimit
+	providers  map[string]config.BudgetLimit
+	thresholds []float64
+	state      state
+	dirty      bool             // 用量状态是否有未写入文件的修改
+	now        func() time.Time // 当前时间，测试时可替换
+	mutex      sync.Mutex
+
+	stop      chan struct{} // 关闭时通知定期写入的 goroutine 退出
+	done      chan struct{} // 定期写入的 goroutine 已退出
+	closeOnce sync.Once
+}
+
+// NewTracker 根据配置创建预算追踪器，未配置任何预算时返回 nil
+func NewTracker(cfg *config.Config) *Tracker {
+	providers := make(map[string]config.BudgetLimit)
+	for _, provider := range cfg.Providers {
+		if !provider.Budget.IsZero() {
+			providers[provider.Name] = *provider.Budget
+		}
+	}
+	if cfg.Budget.IsZero() && len(providers) == 0 {
+		return nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		logger.Error(logger.ModuleBudget, "获取用户主目录失败，预算用量不会持久化: %v", err)
+	}
+
+	t := &Tracker{
+		path:       filepath.Join(homeDir, ".claude-code-env", "budget.json"),
+		global:     cfg.Budget.BudgetLimit,
+		providers:  providers,
+		thresholds: cfg.Budget.WarnThresholds,
+		now:        time.Now,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	t.load()
+	go t.flushLoop()
+
+	logger.Info(logger.ModuleBudget, "预算追踪已启用，全局预算: [%s]，provider 预算数量: %d", t.global.Describe(), len(providers))
+	return t
+}
+
+// load 从文件加载用量状态，文件不存在或损坏时从零开始
+func (t *Tracker) load() {
+	t.state = state{}
+	if data, err := os.ReadFile(t.path); err == nil {
+		if err := json.Unmarshal(data, &t.state); err != nil {
+			logger.Warn(logger.ModuleBudget, "解析预算用量文件失败，重新开始统计: %v", err)
+			t.state = state{}
+		}
+	}
+	t.rollover(t.now())
+}
+
+// flushLoop 定期将有修改的用量状态写入文件，直到 Close
+func (t *Tracker) flushLoop() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// Close 停止定期写入并立即写入未保存的用量，可重复调用
+func (t *Tracker) Close() {
+	if t == nil {
+		return
+	}
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		<-t.done
+		t.flush()
+	})
+}
+
+// flush 在用量状态有修改时原子写入文件，序列化在锁内完成，写文件不持有锁
+func (t *Tracker) flush() {
+	t.mutex.Lock()
+	if !t.dirty {
+		t.mutex.Unlock()
+		return
+	}
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	t.dirty = false
+	t.mutex.Unlock()
+	if err != nil {
+		logger.Error(logger.ModuleBudget, "序列化预算用量失败: %v", err)
+		return
+	}
+
+	tmpPath := t.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		logger.Error(logger.ModuleBudget, "写入预算用量文件失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, t.path); err != nil {
+		logger.Error(logger.ModuleBudget, "保存预算用量文件失败: %v", err)
+	}
+}
+
+// rollover 跨日或跨月时重置对应周期的计数器
+func (t *Tracker) rollover(now time.Time) {
+	day := now.Format("2006-01-02")
+	month := now.Format("2006-01")
+
+	if t.state.Day != day || t.state.Daily == nil {
+		t.state.Day = day
+		t.state.Daily = make(map[string]*Counter)
+		t.resetWarned("daily")
+	}
+	if t.state.Month != month || t.state.Monthly == nil {
+		t.state.Month = month
+		t.state.Monthly = make(map[string]*Counter)
+		t.resetWarned("monthly")
+	}
+}
+
+// resetWarned 清除指定周期的告警记录
+func (t *Tracker) resetWarned(period string) {
+	if t.state.Warned == nil {
+		t.state.Warned = make(map[string]bool)
+	}
+	for key := range t.state.Warned {
+		if len(key) > len(period) && key[:len(period)] == period {
+			delete(t.state.Warned, key)
+		}
+	}
+}
+
+// counter 获取指定周期和范围的计数器
+func counter(counters map[string]*Counter, scope string) *Counter {
+	c, exists := counters[scope]
+	if !exists {
+		c = &Counter{}
+		counters[scope] = c
+	}
+	return c
+}
+
+// Record 记录一次请求的用量并检查告警阈值
+func (t *Tracker) Record(providerName string, pricing *config.Pricing, u usage.Usage) {
+	if t == nil || u.IsZero() {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.rollover(t.now())
+
+	tokens := int64(u.Total())
+	cost := usage.Cost(pricing, u)
+	for _, scope := range []string{globalScope, providerName} {
+		for _, counters := range []map[string]*Counter{t.state.Daily, t.state.Monthly} {
+			c := counter(counters, scope)
+			c.Tokens += tokens
+			c.Cost += cost
+		}
+	}
+
+	t.checkThresholds(globalScope, t.global)
+	if limit, exists := t.providers[providerName]; exists {
+		t.checkThresholds(providerName, limit)
+	}
+
+	t.dirty = true
+}
+
+// checkThresholds 检查用量是否达到告警阈值或耗尽预算，每个阈值每个周期只告警一次
+func (t *Tracker) checkThresholds(scope string, limit config.BudgetLimit) {
+	name := "全局"
+	if scope != globalScope {
+		name = "Provider " + scope
+	}
+
+	for _, check := range t.checks(scope, limit) {
+		ratio := check.used / check.limit
+		if ratio >= 1 {
+			key := fmt.Sprintf("%s|%s|exhausted", check.period, scope+"|"+check.metric)
+			if !t.state.Warned[key] {
+				t.state.Warned[key] = true
+				logger.Error(logger.ModuleBudget, "%s%s已耗尽: %.2f / %.2f", name, check.label, check.used, check.limit)
+			}
+			continue
+		}
+
+		for i := len(t.thresholds) - 1; i >= 0; i-- {
+			threshold := t.thresholds[i]
+			if ratio < threshold {
+				continue
+			}
+			key := fmt.Sprintf("%s|%s|%g", check.period, scope+"|"+check.metric, threshold)
+			if !t.state.Warned[key] {
+				t.state.Warned[key] = true
+				logger.Warn(logger.ModuleBudget, "%s%s已达 %.0f%%: %.2f / %.2f", name, check.label, ratio*100, check.used, check.limit)
+			}
+			break
+		}
+	}
+}
+
+// budgetCheck 表示一项需要检查的预算
+type budgetCheck struct {
+	period string // daily 或 monthly
+	metric string // tokens 或 cost
+	label  string
+	used   float64
+	limit  float64
+}
+
+// checks 返回指定范围内所有已配置的预算检查项
+func (t *Tracker) checks(scope string, limit config.BudgetLimit) []budgetCheck {
+	daily := counter(t.state.Daily, scope)
+	monthly := counter(t.state.Monthly, scope)
+
+	var checks []budgetCheck
+	if limit.DailyTokens > 0 {
+		checks = append(checks, budgetCheck{"daily", "tokens", "今日 token 预算", float64(daily.Tokens), float64(limit.DailyTokens)})
+	}
+	if limit.MonthlyTokens > 0 {
+		checks = append(checks, budgetCheck{"monthly", "tokens", "本月 token 预算", float64(monthly.Tokens), float64(limit.MonthlyTokens)})
+	}
+	if limit.DailyCost > 0 {
+		checks = append(checks, budgetCheck{"daily", "cost", "今日费用预算", daily.Cost, limit.DailyCost})
+	}
+	if limit.MonthlyCost > 0 {
+		checks = append(checks, budgetCheck{"monthly", "cost", "本月费用预算", monthly.Cost, limit.MonthlyCost})
+	}
+	return checks
+}
+
+// exhausted 返回第一项已耗尽的预算描述，未耗尽时返回空字符串
+func (t *Tracker) exhausted(scope string, limit config.BudgetLimit) string {
+	t.rollover(t.now())
+	for _, check := range t.checks(scope, limit) {
+		if check.used >= check.limit {
+			return fmt.Sprintf("%s已耗尽 (%.2f / %.2f)", check.label, check.used, check.limit)
+		}
+	}
+	return ""
+}
+
+// ProviderExhausted 判断 provider 的预算是否已耗尽
+func (t *Tracker) ProviderExhausted(providerName string) bool {
+	if t == nil {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	limit, exists := t.providers[providerName]
+	return exists && t.exhausted(providerName, limit) != ""
+}
+
+// GlobalExhausted 判断全局预算是否已耗尽，返回耗尽原因
+func (t *Tracker) GlobalExhausted() (bool, string) {
+	if t == nil {
+		return false, ""
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	reason := t.exhausted(globalScope, t.global)
+	return reason != "", reason
+}
@@ -0,0 +1,102 @@
+package budget
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/usage"
+)
+
+// newTestTracker 创建使用临时文件和可控时钟的预算追踪器，不启动定期写入
+func newTestTracker(t *testing.T, now *time.Time) *Tracker {
+	tracker := &Tracker{
+		path:      filepath.Join(t.TempDir(), "budget.json"),
+		global:    config.BudgetLimit{DailyTokens: 1000, MonthlyTokens: 5000},
+		providers: map[string]config.BudgetLimit{"a": {DailyCost: 1}},
+		now:       func() time.Time { return *now },
+	}
+	tracker.load()
+	return tracker
+}
+
+func TestTrackerAccounting(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	tracker := newTestTracker(t, &now)
+	pricing := &config.Pricing{InputPerMTok: 100000, OutputPerMTok: 500000}
+
+	tracker.Record("a", pricing, usage.Usage{InputTokens: 4, OutputTokens: 1})
+	if tracker.ProviderExhausted("a") {
+		t.Fatal("provider a exhausted too early")
+	}
+	tracker.Record("a", pricing, usage.Usage{InputTokens: 10})
+	if !tracker.ProviderExhausted("a") {
+		t.Error("provider a should be exhausted after cost 1.9")
+	}
+	if tracker.ProviderExhausted("b") {
+		t.Error("provider without budget should never be exhausted")
+	}
+
+	tracker.Record("b", nil, usage.Usage{InputTokens: 985})
+	if exhausted, reason := tracker.GlobalExhausted(); !exhausted || reason == "" {
+		t.Errorf("global exhausted = %v, reason = %q", exhausted, reason)
+	}
+	if c := tracker.state.Daily["b"]; c == nil || c.Tokens != 985 {
+		t.Errorf("daily counter for b = %+v", c)
+	}
+
+	// 用量只在 flush 时写入文件
+	if _, err := os.Stat(tracker.path); !os.IsNotExist(err) {
+		t.Fatalf("budget file written before flush: %v", err)
+	}
+	tracker.flush()
+	data, err := os.ReadFile(tracker.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved state
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Daily[globalScope].Tokens != 1000 || saved.Monthly[globalScope].Tokens != 1000 {
+		t.Errorf("saved global counters = %+v / %+v", saved.Daily[globalScope], saved.Monthly[globalScope])
+	}
+
+	// 重新加载后继续累计
+	reloaded := newTestTracker(t, &now)
+	reloaded.path = tracker.path
+	reloaded.load()
+	if exhausted, _ := reloaded.GlobalExhausted(); !exhausted {
+		t.Error("reloaded tracker lost global usage")
+	}
+}
+
+func TestTrackerRollover(t *testing.T) {
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.Local)
+	tracker := newTestTracker(t, &now)
+
+	tracker.Record("b", nil, usage.Usage{InputTokens: 1000})
+	if exhausted, _ := tracker.GlobalExhausted(); !exhausted {
+		t.Fatal("daily token budget should be exhausted")
+	}
+
+	// 跨日跨月后当日和当月用量都重新统计
+	now = now.Add(2 * time.Hour)
+	if exhausted, reason := tracker.GlobalExhausted(); exhausted {
+		t.Errorf("still exhausted after rollover: %s", reason)
+	}
+	if tracker.state.Day != "2026-04-01" || tracker.state.Month != "2026-04" {
+		t.Errorf("period = %s / %s", tracker.state.Day, tracker.state.Month)
+	}
+
+	// 同月跨日只重置当日用量
+	tracker.Record("b", nil, usage.Usage{InputTokens: 600})
+	now = now.Add(24 * time.Hour)
+	tracker.Record("b", nil, usage.Usage{InputTokens: 600})
+	if daily, monthly := tracker.state.Daily[globalScope].Tokens, tracker.state.Monthly[globalScope].Tokens; daily != 600 || monthly != 1200 {
+		t.Errorf("daily = %d, monthly = %d", daily, monthly)
+	}
+}
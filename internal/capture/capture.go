@@ -0,0 +1,315 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+// cleanupEvery 每创建多少个抓包文件执行一次清理
+const cleanupEvery = 20
+
+// captureFilePattern 匹配抓包文件名 <请求ID>.log，清理时只处理这些文件，抓包目录与其他日志共用时不会误删
+var captureFilePattern = regexp.MustCompile(`^[0-9a-f]{8}\.log$`)
+
+// global 当前的抓包配置和运行时开关，配置重载时保留运行时开关
+var global struct {
+	cfg     config.DebugWire
+	dir     string
+	enabled bool
+	created int // 自上次清理后创建的文件数
+	mutex   sync.RWMutex
+}
+
+// Configure 应用抓包配置，配置未变化时保持运行时通过 SetEnabled 设置的开关
+func Configure(cfg config.DebugWire) {
+	global.mutex.Lock()
+	if reflect.DeepEqual(global.cfg, cfg) && global.dir != "" {
+		global.mutex.Unlock()
+		return
+	}
+	dir := expandHome(cfg.Dir)
+	global.cfg = cfg
+	global.dir = dir
+	global.enabled = cfg.Enabled
+	global.mutex.Unlock()
+
+	if cfg.Enabled {
+		logger.Info(logger.ModuleProxy, "请求抓包已启用，目录: %s", dir)
+	}
+	go cleanup()
+}
+
+// SetEnabled 在运行时开启或关闭抓包
+func SetEnabled(enabled bool) {
+	global.mutex.Lock()
+	changed := global.enabled != enabled
+	global.enabled = enabled
+	dir := global.dir
+	global.mutex.Unlock()
+
+	if changed && enabled {
+		logger.Info(logger.ModuleProxy, "请求抓包已开启，目录: %s", dir)
+	} else if changed {
+		logger.Info(logger.ModuleProxy, "请求抓包已关闭")
+	}
+}
+
+// Status 返回抓包是否开启和抓包目录
+func Status() (bool, string) {
+	global.mutex.RLock()
+	defer global.mutex.RUnlock()
+	return global.enabled, global.dir
+}
+
+// Capture 单个请求的抓包文件，未开启抓包时为 nil，所有方法都可以在 nil 上安全调用
+type Capture struct {
+	file      *os.File
+	start     time.Time
+	written   int64
+	limit     int64
+	truncated bool
+	mutex     sync.Mutex
+}
+
+// Start 为请求创建抓包文件 <目录>/<请求ID>.log，未开启抓包或创建失败时返回 nil
+func Start(requestID string) *Capture {
+	global.mutex.Lock()
+	if !global.enabled {
+		global.mutex.Unlock()
+		return nil
+	}
+	dir, limit := global.dir, int64(global.cfg.MaxFileMB)*1024*1024
+	global.created++
+	needCleanup := global.created >= cleanupEvery
+	if needCleanup {
+		global.created = 0
+	}
+	global.mutex.Unlock()
+
+	if needCleanup {
+		go cleanup()
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "创建抓包目录失败: %v", err)
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(dir, requestID+".log"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "创建抓包文件失败: %v", err)
+		return nil
+	}
+
+	c := &Capture{file: file, start: time.Now(), limit: limit}
+	c.write(fmt.Sprintf("=== 请求 %s  %s ===\n", requestID, c.start.Format("2006-01-02 15:04:05.000")))
+	return c
+}
+
+// Inbound 记录客户端发来的原始请求
+func (c *Capture) Inbound(r *http.Request, body []byte) {
+	if c == nil {
+		return
+	}
+	c.section("入站请求")
+	c.write(fmt.Sprintf("%s %s\n", r.Method, r.URL.RequestURI()))
+	c.writeHeaders(r.Header)
+	c.writeBody(body)
+}
+
+// Outbound 记录改写后发往上游的请求
+func (c *Capture) Outbound(providerName string, req *http.Request, body []byte) {
+	if c == nil {
+		return
+	}
+	c.section("出站请求 [%s]", providerName)
+	c.write(fmt.Sprintf("%s %s\n", req.Method, req.URL.String()))
+	c.writeHeaders(req.Header)
+	c.writeBody(body)
+}
+
+// Response 记录上游响应的状态和响应头
+func (c *Capture) Response(resp *http.Response) {
+	if c == nil {
+		return
+	}
+	c.section("上游响应 (%s)", time.Since(c.start).Round(time.Millisecond))
+	c.write(resp.Proto + " " + resp.Status + "\n")
+	c.writeHeaders(resp.Header)
+}
+
+// Error 记录请求过程中的错误
+func (c *Capture) Error(err error) {
+	if c == nil || err == nil {
+		return
+	}
+	c.section("错误 (%s)", time.Since(c.start).Round(time.Millisecond))
+	c.write(err.Error() + "\n")
+}
+
+// WrapBody 包装上游响应体，读取时同时记录原始内容（包括 SSE 流）
+func (c *Capture) WrapBody(body io.ReadCloser) io.ReadCloser {
+	if c == nil {
+		return body
+	}
+	c.section("响应体")
+	return &teeBody{ReadCloser: body, capture: c}
+}
+
+// Close 记录总耗时并关闭抓包文件
+func (c *Capture) Close() {
+	if c == nil {
+		return
+	}
+	c.section("结束 (%s)", time.Since(c.start).Round(time.Millisecond))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.file.Close()
+}
+
+// section 写入分段标题
+func (c *Capture) section(format string, args ...interface{}) {
+	c.write("\n=== " + fmt.Sprintf(format, args...) + " ===\n")
+}
+
+// writeHeaders 按名称排序写入请求头或响应头
+func (c *Capture) writeHeaders(header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(&sb, "%s: %s\n", key, value)
+		}
+	}
+	sb.WriteString("\n")
+	c.write(sb.String())
+}
+
+// writeBody 写入请求体
+func (c *Capture) writeBody(body []byte) {
+	c.write(string(body))
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		c.write("\n")
+	}
+}
+
+// write 脱敏后写入文件，超过大小上限后只写入一次截断提示
+func (c *Capture) write(data string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.truncated {
+		return
+	}
+	data = logger.Redact(data)
+	if c.limit > 0 && c.written+int64(len(data)) > c.limit {
+		data = data[:c.limit-c.written]
+		c.truncated = true
+		data += fmt.Sprintf("\n\n=== 已达到抓包文件大小上限 %dMB，后续内容未记录 ===\n", c.limit/1024/1024)
+	}
+	n, _ := c.file.WriteString(data)
+	c.written += int64(n)
+}
+
+// teeBody 读取响应体时同时写入抓包文件
+// 按整行写入，避免密钥被分块截断后逃过脱敏，最后不完整的一行在读到结尾或关闭时写入
+type teeBody struct {
+	io.ReadCloser
+	capture *Capture
+	pending []byte
+}
+
+// Read 读取并记录响应体
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.pending = append(t.pending, p[:n]...)
+		if i := bytes.LastIndexByte(t.pending, '\n'); i >= 0 {
+			t.capture.write(string(t.pending[:i+1]))
+			t.pending = append(t.pending[:0], t.pending[i+1:]...)
+		}
+	}
+	if err != nil {
+		t.flush()
+	}
+	return n, err
+}
+
+// Close 写入剩余内容并关闭响应体
+func (t *teeBody) Close() error {
+	t.flush()
+	return t.ReadCloser.Close()
+}
+
+// flush 写入尚未记录的不完整行
+func (t *teeBody) flush() {
+	if len(t.pending) > 0 {
+		t.capture.write(string(t.pending))
+		t.pending = nil
+	}
+}
+
+// cleanup 按保留数量和时长清理旧的抓包文件，目录中的其他文件保持不变
+func cleanup() {
+	global.mutex.RLock()
+	dir, maxFiles := global.dir, global.cfg.MaxFiles
+	maxAge := time.Duration(global.cfg.MaxAgeHours) * time.Hour
+	global.mutex.RUnlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type captureFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []captureFile
+	for _, entry := range entries {
+		if entry.IsDir() || !captureFilePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, captureFile{path: filepath.Join(dir, entry.Name()), modTime: info.ModTime()})
+	}
+
+	// 从新到旧排序，超过数量或时长的文件被删除
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for i, file := range files {
+		if (maxFiles > 0 && i >= maxFiles) || (maxAge > 0 && time.Since(file.modTime) > maxAge) {
+			os.Remove(file.path)
+		}
+	}
+}
+
+// expandHome 展开 ~ 开头的路径
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
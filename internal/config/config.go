@@ -2,10 +2,14 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,28 +21,249 @@ type ServiceConfig map[string]string
 
 // Provider 表示单个服务提供商配置
 type Provider struct {
-	Name  string            `json:"name"`
-	State string            `json:"state"`
-	Env   map[string]string `json:"env"`
+	Name            string                `json:"name"`
+	State           string                `json:"state"`
+	Env             map[string]string     `json:"env"`
+	ContextWindow   int                   `json:"context_window,omitempty"`    // 上下文窗口大小（token），0 表示不限制
+	MaxOutputTokens int                   `json:"max_output_tokens,omitempty"` // 最大输出 token 数，0 表示不限制
+	ModelLimits     map[string]ModelLimit `json:"model_limits,omitempty"`      // 按模型覆盖的限制
+	FallbackModels  []string              `json:"fallback_models,omitempty"`   // 限流或过载时依次尝试的备用模型
+	ImagePolicy     *ImagePolicy          `json:"image_policy,omitempty"`      // 图片处理策略，未配置时原样透传
+	SystemPrefix    string                `json:"system_prefix,omitempty"`     // 插入到 system 提示词之前的文本
+	SystemSuffix    string                `json:"system_suffix,omitempty"`     // 追加到 system 提示词之后的文本
+	Pricing         *Pricing              `json:"pricing,omitempty"`           // 计费价格，用于费用统计和预算
+	Budget          *BudgetLimit          `json:"budget,omitempty"`            // provider 预算，耗尽后停止路由到该 provider
+
+	TracePropagation bool `json:"trace_propagation,omitempty"` // 是否向该 provider 传递 W3C traceparent 请求头
+}
+
+// Tracing 表示 OpenTelemetry 链路追踪配置
+type Tracing struct {
+	Enabled     bool              `json:"enabled"`           // 是否启用，默认关闭
+	Protocol    string            `json:"protocol"`          // 导出协议：http/json（默认）或 grpc
+	Endpoint    string            `json:"endpoint"`          // OTLP 接收地址，默认 http://127.0.0.1:4318，grpc 默认 http://127.0.0.1:4317
+	ServiceName string            `json:"service_name"`      // 上报的 service.name，默认 ccenv
+	Headers     map[string]string `json:"headers,omitempty"` // 上报时附加的请求头，如认证信息
+}
+
+// Validate 检查链路追踪配置，支持 OTLP/HTTP（JSON 编码）和 OTLP/gRPC 导出
+func (t Tracing) Validate() error {
+	switch strings.ToLower(t.Protocol) {
+	case "", "http/json", "grpc":
+		return nil
+	default:
+		return fmt.Errorf("tracing.protocol 不支持 %q，只支持 http/json 和 grpc", t.Protocol)
+	}
+}
+
+// DebugWire 表示请求抓包配置，按请求ID记录原始请求、改写后的上游请求和上游响应
+type DebugWire struct {
+	Enabled     bool   `json:"enabled"`       // 是否启用，默认关闭，也可以通过 ccenv start --debug-wire 或管理接口开启
+	Dir         string `json:"dir"`           // 抓包文件目录，默认 ~/.claude-code-env/wire
+	MaxFileMB   int    `json:"max_file_mb"`   // 单个抓包文件的大小上限（MB），超过后截断，默认 10
+	MaxFiles    int    `json:"max_files"`     // 保留的抓包文件数，默认 200
+	MaxAgeHours int    `json:"max_age_hours"` // 抓包文件保留时长（小时），默认 24
+}
+
+// 管理服务的角色
+const (
+	AdminRoleAdmin = "admin" // 可以执行所有操作
+	AdminRoleRead  = "read"  // 只能查看，不能修改配置或控制 provider
+)
+
+// AdminAuth 表示管理服务的访问控制配置，未配置令牌和用户时不需要认证，但只允许本机访问
+type AdminAuth struct {
+	Tokens          []AdminToken `json:"tokens,omitempty"`           // API 令牌，通过 Authorization: Bearer 请求头或登录页面使用
+	Users           []AdminUser  `json:"users,omitempty"`            // 用户，通过 Basic 认证或登录页面使用
+	AllowedNetworks []string     `json:"allowed_networks,omitempty"` // 允许访问的非本机地址（IP 或 CIDR），需要同时配置令牌或用户
+	SessionHours    int          `json:"session_hours"`              // 登录会话有效期（小时），默认 12
+}
+
+// AdminToken 表示管理服务的 API 令牌
+type AdminToken struct {
+	Name  string `json:"name"`  // 名称，用于日志
+	Token string `json:"token"` // 令牌内容
+	Role  string `json:"role"`  // admin 或 read，默认 admin
+}
+
+// AdminUser 表示管理服务的用户
+type AdminUser struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"` // bcrypt 哈希，可以用 ccenv admin hash-password 生成
+	Role         string `json:"role"`          // admin 或 read，默认 admin
+}
+
+// Enabled 是否配置了认证
+func (a *AdminAuth) Enabled() bool {
+	return len(a.Tokens) > 0 || len(a.Users) > 0
+}
+
+// normalizeAdminRole 规范化角色，未配置时为 admin，无法识别的角色按只读处理
+func normalizeAdminRole(role string) string {
+	switch strings.ToLower(role) {
+	case "", AdminRoleAdmin:
+		return AdminRoleAdmin
+	default:
+		return AdminRoleRead
+	}
+}
+
+// Pricing 表示每百万 token 的价格
+type Pricing struct {
+	InputPerMTok      float64 `json:"input_per_mtok"`
+	OutputPerMTok     float64 `json:"output_per_mtok"`
+	CacheWritePerMTok float64 `json:"cache_write_per_mtok,omitempty"`
+	CacheReadPerMTok  float64 `json:"cache_read_per_mtok,omitempty"`
+}
+
+// BudgetLimit 表示按日和按月的预算上限，0 表示不限制
+type BudgetLimit struct {
+	DailyTokens   int64   `json:"daily_tokens,omitempty"`
+	MonthlyTokens int64   `json:"monthly_tokens,omitempty"`
+	DailyCost     float64 `json:"daily_cost,omitempty"`
+	MonthlyCost   float64 `json:"monthly_cost,omitempty"`
+}
+
+// IsZero 判断是否未设置任何预算上限
+func (b *BudgetLimit) IsZero() bool {
+	return b == nil || (b.DailyTokens == 0 && b.MonthlyTokens == 0 && b.DailyCost == 0 && b.MonthlyCost == 0)
+}
+
+// Describe 返回预算上限的可读描述
+func (b *BudgetLimit) Describe() string {
+	var parts []string
+	if b.DailyTokens > 0 {
+		parts = append(parts, fmt.Sprintf("每日 %d tokens", b.DailyTokens))
+	}
+	if b.MonthlyTokens > 0 {
+		parts = append(parts, fmt.Sprintf("每月 %d tokens", b.MonthlyTokens))
+	}
+	if b.DailyCost > 0 {
+		parts = append(parts, fmt.Sprintf("每日费用 %.2f", b.DailyCost))
+	}
+	if b.MonthlyCost > 0 {
+		parts = append(parts, fmt.Sprintf("每月费用 %.2f", b.MonthlyCost))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Budget 表示全局预算配置
+type Budget struct {
+	BudgetLimit
+	Currency       string    `json:"currency,omitempty"`        // 费用单位，仅用于显示
+	WarnThresholds []float64 `json:"warn_thresholds,omitempty"` // 用量告警阈值（比例），如 [0.8, 0.95]
+}
+
+// ImagePolicy 表示 provider 的图片处理策略
+type ImagePolicy struct {
+	Mode         string `json:"mode"`                    // pass（原样透传）、downscale（缩放重编码）、strip（替换为文本占位）
+	MaxDimension int    `json:"max_dimension,omitempty"` // downscale 模式下图片最大边长（像素）
+	MaxBytes     int    `json:"max_bytes,omitempty"`     // downscale 模式下单张图片最大字节数
+}
+
+// ModelLimit 表示单个模型的上下文和输出限制
+type ModelLimit struct {
+	ContextWindow   int `json:"context_window,omitempty"`
+	MaxOutputTokens int `json:"max_output_tokens,omitempty"`
+}
+
+// TargetModel 返回 provider 实际使用的模型：配置了 ANTHROPIC_MODEL 时为映射后的模型，否则为请求模型
+func (p Provider) TargetModel(requestedModel string) string {
+	if targetModel := p.Env["ANTHROPIC_MODEL"]; targetModel != "" {
+		return targetModel
+	}
+	return requestedModel
+}
+
+// CandidateModels 返回 provider 处理请求时依次尝试的模型：目标模型在前，备用模型在后
+func (p Provider) CandidateModels(requestedModel string) []string {
+	models := []string{p.TargetModel(requestedModel)}
+	for _, model := range p.FallbackModels {
+		if model != "" && model != models[0] {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// LimitsFor 返回指定模型的上下文窗口和最大输出 token 数，模型未单独配置时使用 provider 级别的限制
+func (p Provider) LimitsFor(model string) (contextWindow, maxOutputTokens int) {
+	contextWindow = p.ContextWindow
+	maxOutputTokens = p.MaxOutputTokens
+	if limit, exists := p.ModelLimits[model]; exists {
+		if limit.ContextWindow > 0 {
+			contextWindow = limit.ContextWindow
+		}
+		if limit.MaxOutputTokens > 0 {
+			maxOutputTokens = limit.MaxOutputTokens
+		}
+	}
+	return contextWindow, maxOutputTokens
 }
 
 // Routing 表示路由策略配置
 type Routing struct {
-	Strategy string `json:"strategy"`
+	Strategy  string              `json:"strategy"`
+	Groups    map[string][]string `json:"groups,omitempty"`    // provider 组：组名 -> provider 名称列表
+	Rules     []RoutingRule       `json:"rules,omitempty"`     // 内容路由规则，在路由策略之前按顺序匹配
+	Downgrade []DowngradeStep     `json:"downgrade,omitempty"` // 全局模型降级链，所有 provider 均限流或过载时使用
+}
+
+// DowngradeStep 表示降级链中的一步：请求模型匹配 From 时降级为 To
+type DowngradeStep struct {
+	From   string            `json:"from"`             // 请求模型，支持 * 通配
+	To     string            `json:"to"`               // 降级后的请求模型
+	Models map[string]string `json:"models,omitempty"` // provider 名称 -> 降级后该 provider 使用的上游模型，配置了 ANTHROPIC_MODEL 的 provider 未指定时降级后跳过
+}
+
+// RoutingRule 表示一条基于请求内容的路由规则
+type RoutingRule struct {
+	Name   string    `json:"name"`
+	Match  RuleMatch `json:"match"`
+	Target string    `json:"target"` // provider 名称或 provider 组名称
+}
+
+// RuleMatch 表示路由规则的匹配条件，所有已设置的条件都满足才算命中
+type RuleMatch struct {
+	Model     string            `json:"model,omitempty"`      // 请求模型，支持 * 通配，不区分大小写
+	HasTools  *bool             `json:"has_tools,omitempty"`  // 是否携带 tools
+	HasImages *bool             `json:"has_images,omitempty"` // 是否包含图片
+	Thinking  *bool             `json:"thinking,omitempty"`   // 是否开启 thinking
+	MinTokens int               `json:"min_tokens,omitempty"` // 估算输入 token 数下限
+	MaxTokens int               `json:"max_tokens,omitempty"` // 估算输入 token 数上限
+	Headers   map[string]string `json:"headers,omitempty"`    // 请求头匹配，值支持 * 通配
 }
 
 // Config 表示配置文件结构
 type Config struct {
-	Version      string     `json:"version"`
-	APIKey       string     `json:"APIKEY"`
-	CCEnvHost    string     `json:"CCENV_HOST"`
-	LLMProxyPort int        `json:"LLM_PROXY_PORT"` // LLM API代理端口
-	AdminPort    int        `json:"ADMIN_PORT"`     // 管理端口
-	APIProxy     string     `json:"API_PROXY"`
-	LoggingLevel string     `json:"LOGGING_LEVEL"`
-	APITimeoutMS int        `json:"API_TIMEOUT_MS"`
-	Providers    []Provider `json:"providers"`
-	Routing      Routing    `json:"routing"`
+	Version      string `json:"version"`
+	APIKey       string `json:"APIKEY"`
+	CCEnvHost    string `json:"CCENV_HOST"`
+	LLMProxyPort int    `json:"LLM_PROXY_PORT"` // LLM API代理端口
+	AdminPort    int    `json:"ADMIN_PORT"`     // 管理端口
+	APIProxy     string `json:"API_PROXY"`
+	LoggingLevel string `json:"LOGGING_LEVEL"`
+	LogFormat    string `json:"LOG_FORMAT"` // 日志格式：text 或 json
+	LogPath      string `json:"LOG_PATH"`   // 日志文件路径，默认 ~/.claude-code-env/ccenv.log
+
+	LogMaxSizeMB   int        `json:"LOG_MAX_SIZE_MB"`  // 单个日志文件超过该大小（MB）时轮转，默认 100，-1 表示不按大小轮转
+	LogRotateDaily bool       `json:"LOG_ROTATE_DAILY"` // 是否每天轮转
+	LogMaxBackups  int        `json:"LOG_MAX_BACKUPS"`  // 保留的轮转文件数，默认 5，-1 表示不限制
+	LogMaxAgeDays  int        `json:"LOG_MAX_AGE_DAYS"` // 轮转文件保留天数，0 表示不限制
+	LogCompress    bool       `json:"LOG_COMPRESS"`     // 是否 gzip 压缩轮转文件
+	APITimeoutMS   int        `json:"API_TIMEOUT_MS"`
+	Providers      []Provider `json:"providers"`
+	Routing        Routing    `json:"routing"`
+	Budget         Budget     `json:"budget"`
+	Tracing        Tracing    `json:"tracing"`
+	DebugWire      DebugWire  `json:"debug_wire"`
+	AdminAuth      AdminAuth  `json:"admin_auth"`
+
+	RewriteResponseModel bool `json:"REWRITE_RESPONSE_MODEL"` // 将响应中的模型名改写回客户端请求的模型，并规范化 stop_reason
+
+	RequestIDHeader string   `json:"REQUEST_ID_HEADER"` // 向上游传递代理请求ID的请求头，默认 x-ccenv-request-id，设置为 none 时不传递
+	RedactPatterns  []string `json:"REDACT_PATTERNS"`   // 日志中额外需要脱敏的正则表达式
+	RecentRequests  int      `json:"RECENT_REQUESTS"`   // 管理界面保留的最近请求数，默认 200，-1 表示不记录
 }
 
 // ExampleConfig 硬编码的示例配置
@@ -106,6 +331,11 @@ func LoadConfig() (*Config, error) {
 	// 设置默认值
 	config.SetDefaults()
 
+	// 检查无法自动修正的配置
+	if err := config.Tracing.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
@@ -166,15 +396,154 @@ func (c *Config) SetDefaults() {
 	if c.LoggingLevel == "" {
 		c.LoggingLevel = "INFO"
 	}
+	c.LogFormat = strings.ToLower(c.LogFormat)
+	if c.LogFormat != "json" {
+		c.LogFormat = "text"
+	}
+
+	// 设置日志轮转默认值，负数表示不限制
+	if c.LogMaxSizeMB == 0 {
+		c.LogMaxSizeMB = 100
+	} else if c.LogMaxSizeMB < 0 {
+		c.LogMaxSizeMB = 0
+	}
+	if c.LogMaxBackups == 0 {
+		c.LogMaxBackups = 5
+	} else if c.LogMaxBackups < 0 {
+		c.LogMaxBackups = 0
+	}
+	if c.LogMaxAgeDays < 0 {
+		c.LogMaxAgeDays = 0
+	}
 	if c.APITimeoutMS == 0 {
 		c.APITimeoutMS = 600000 // 10 分钟
 	}
+	if c.RequestIDHeader == "" {
+		c.RequestIDHeader = "x-ccenv-request-id"
+	}
+	if c.RecentRequests == 0 {
+		c.RecentRequests = 200
+	} else if c.RecentRequests < 0 {
+		c.RecentRequests = 0
+	}
 
 	// 验证并设置路由策略
 	if c.Routing.Strategy != "default" && c.Routing.Strategy != "robin" {
 		c.Routing.Strategy = "default"
 	}
 
+	// 过滤缺少目标的路由规则
+	var rules []RoutingRule
+	for _, rule := range c.Routing.Rules {
+		if rule.Target != "" {
+			rules = append(rules, rule)
+		}
+	}
+	c.Routing.Rules = rules
+
+	// 验证图片处理策略
+	for i := range c.Providers {
+		policy := c.Providers[i].ImagePolicy
+		if policy == nil {
+			continue
+		}
+		if policy.Mode != "pass" && policy.Mode != "downscale" && policy.Mode != "strip" {
+			policy.Mode = "pass"
+		}
+		if policy.MaxDimension <= 0 {
+			policy.MaxDimension = 1568
+		}
+		if policy.MaxBytes <= 0 {
+			policy.MaxBytes = 5 * 1024 * 1024
+		}
+	}
+
+	// 验证预算告警阈值
+	var thresholds []float64
+	for _, threshold := range c.Budget.WarnThresholds {
+		if threshold > 0 && threshold < 1 {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	if len(thresholds) == 0 {
+		thresholds = []float64{0.8}
+	}
+	sort.Float64s(thresholds)
+	c.Budget.WarnThresholds = thresholds
+
+	// 设置链路追踪默认值
+	c.Tracing.Protocol = strings.ToLower(c.Tracing.Protocol)
+	if c.Tracing.Protocol == "" {
+		c.Tracing.Protocol = "http/json"
+	}
+	if c.Tracing.Endpoint == "" {
+		c.Tracing.Endpoint = "http://127.0.0.1:4318"
+		if c.Tracing.Protocol == "grpc" {
+			c.Tracing.Endpoint = "http://127.0.0.1:4317"
+		}
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "ccenv"
+	}
+
+	// 设置请求抓包默认值
+	if c.DebugWire.Dir == "" {
+		c.DebugWire.Dir = "~/.claude-code-env/wire"
+	}
+	if c.DebugWire.MaxFileMB <= 0 {
+		c.DebugWire.MaxFileMB = 10
+	}
+	if c.DebugWire.MaxFiles <= 0 {
+		c.DebugWire.MaxFiles = 200
+	}
+	if c.DebugWire.MaxAgeHours <= 0 {
+		c.DebugWire.MaxAgeHours = 24
+	}
+
+	// 验证管理服务访问控制配置：忽略空令牌和不完整的用户，无效的地址段不生效
+	var tokens []AdminToken
+	for _, token := range c.AdminAuth.Tokens {
+		if token.Token != "" {
+			token.Role = normalizeAdminRole(token.Role)
+			tokens = append(tokens, token)
+		}
+	}
+	c.AdminAuth.Tokens = tokens
+	var users []AdminUser
+	for _, user := range c.AdminAuth.Users {
+		if user.Username != "" && user.PasswordHash != "" {
+			user.Role = normalizeAdminRole(user.Role)
+			users = append(users, user)
+		}
+	}
+	c.AdminAuth.Users = users
+	var networks []string
+	for _, network := range c.AdminAuth.AllowedNetworks {
+		if ip := net.ParseIP(network); ip != nil {
+			if ip.To4() != nil {
+				network += "/32"
+			} else {
+				network += "/128"
+			}
+		}
+		if _, _, err := net.ParseCIDR(network); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	c.AdminAuth.AllowedNetworks = networks
+	if c.AdminAuth.SessionHours <= 0 {
+		c.AdminAuth.SessionHours = 12
+	}
+
+	// 过滤无效的脱敏模式
+	var patterns []string
+	for _, pattern := range c.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err == nil && pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	c.RedactPatterns = patterns
+
 	// 验证 API_PROXY 格式
 	if c.APIProxy != "" {
 		if !strings.HasPrefix(c.APIProxy, "http://") && !strings.HasPrefix(c.APIProxy, "https://") {
@@ -259,15 +628,21 @@ func (cw *ConfigWatcher) watchLoop() {
 				if time.Since(lastReloadTime) < 1*time.Second {
 					continue
 				}
-				lastReloadTime = time.Now()
 
 				// 稍等片刻确保文件写入完成
 				time.Sleep(100 * time.Millisecond)
 
+				// 管理接口写回的修改已在运行时生效，无需重载，同一次写回的后续事件也一并跳过
+				if data, err := os.ReadFile(cw.configPath); err == nil && consumeRuntimeApplied(data) {
+					lastReloadTime = time.Now()
+					continue
+				}
+				lastReloadTime = time.Now()
+
 				// 尝试重新加载配置
 				newConfig, err := LoadConfig()
 				if err != nil {
-					cw.errorChan <- fmt.Errorf("重新加载配置失败: %v", err)
+					cw.errorChan <- fmt.Errorf("%w: %v", ErrConfigReload, err)
 					continue
 				}
 
@@ -297,6 +672,9 @@ func (cw *ConfigWatcher) GetReloadChan() <-chan *Config {
 	return cw.reloadChan
 }
 
+// ErrConfigReload 表示配置文件变化后重新加载失败，错误通道中的其他错误为文件监控错误
+var ErrConfigReload = errors.New("重新加载配置失败")
+
 // GetErrorChan 获取错误通道
 func (cw *ConfigWatcher) GetErrorChan() <-chan error {
 	return cw.errorChan
@@ -323,6 +701,78 @@ func maskSensitiveValue(value string) string {
 	return value[:4] + strings.Repeat("*", len(value)-8) + value[len(value)-4:]
 }
 
+// isSensitiveKey 判断环境变量或请求头名称是否为敏感信息
+func isSensitiveKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, word := range []string{"TOKEN", "KEY", "SECRET", "PASSWORD", "AUTHORIZATION"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets 返回配置中的敏感值，用于日志等输出的脱敏
+func (c *Config) Secrets() []string {
+	var secrets []string
+	if c.APIKey != "" {
+		secrets = append(secrets, c.APIKey)
+	}
+	for _, provider := range c.Providers {
+		for key, value := range provider.Env {
+			if value != "" && isSensitiveKey(key) {
+				secrets = append(secrets, value)
+			}
+		}
+	}
+	for key, value := range c.Tracing.Headers {
+		if value != "" && isSensitiveKey(key) {
+			secrets = append(secrets, value)
+		}
+	}
+	for _, token := range c.AdminAuth.Tokens {
+		secrets = append(secrets, token.Token)
+	}
+	if proxyURL, err := url.Parse(c.APIProxy); err == nil && proxyURL.User != nil {
+		if password, ok := proxyURL.User.Password(); ok && password != "" {
+			secrets = append(secrets, password)
+		}
+	}
+	return secrets
+}
+
+// describeLogRotation 返回日志轮转配置的可读描述
+func (c *Config) describeLogRotation() string {
+	var parts []string
+	if c.LogPath != "" {
+		parts = append(parts, "路径 "+c.LogPath)
+	}
+	if c.LogMaxSizeMB > 0 {
+		parts = append(parts, fmt.Sprintf("超过 %dMB", c.LogMaxSizeMB))
+	}
+	if c.LogRotateDaily {
+		parts = append(parts, "每天")
+	}
+	if c.LogMaxBackups > 0 {
+		parts = append(parts, fmt.Sprintf("保留 %d 个", c.LogMaxBackups))
+	}
+	if c.LogMaxAgeDays > 0 {
+		parts = append(parts, fmt.Sprintf("保留 %d 天", c.LogMaxAgeDays))
+	}
+	if c.LogCompress {
+		parts = append(parts, "gzip 压缩")
+	}
+	if len(parts) == 0 {
+		return "不轮转"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ForwardsRequestID 是否向上游传递代理请求ID
+func (c *Config) ForwardsRequestID() bool {
+	return c.RequestIDHeader != "" && !strings.EqualFold(c.RequestIDHeader, "none")
+}
+
 // DisplayConfig 显示配置信息（敏感信息打码）
 func (c *Config) DisplayConfig() {
 	fmt.Println("=== Claude Code Env 配置信息 ===")
@@ -331,6 +781,8 @@ func (c *Config) DisplayConfig() {
 	fmt.Printf("LLM代理端口: %d\n", c.LLMProxyPort)
 	fmt.Printf("管理端口: %d\n", c.AdminPort)
 	fmt.Printf("日志级别: %s\n", c.LoggingLevel)
+	fmt.Printf("日志格式: %s\n", c.LogFormat)
+	fmt.Printf("日志轮转: %s\n", c.describeLogRotation())
 	fmt.Printf("API超时: %dms\n", c.APITimeoutMS)
 
 	if c.APIProxy != "" {
@@ -339,12 +791,94 @@ func (c *Config) DisplayConfig() {
 		fmt.Printf("API代理: 未配置\n")
 	}
 
+	if !c.Budget.IsZero() {
+		fmt.Printf("全局预算: %s (货币: %s)\n", c.Budget.Describe(), c.Budget.Currency)
+	}
+	fmt.Printf("响应模型改写: %v\n", c.RewriteResponseModel)
+	if c.ForwardsRequestID() {
+		fmt.Printf("上游请求ID头: %s\n", c.RequestIDHeader)
+	} else {
+		fmt.Printf("上游请求ID头: 不传递\n")
+	}
+	if c.RecentRequests > 0 {
+		fmt.Printf("最近请求记录: %d 条\n", c.RecentRequests)
+	} else {
+		fmt.Printf("最近请求记录: 不记录\n")
+	}
+	if c.Tracing.Enabled {
+		fmt.Printf("链路追踪: %s %s (service.name: %s)\n", c.Tracing.Protocol, c.Tracing.Endpoint, c.Tracing.ServiceName)
+	} else {
+		fmt.Printf("链路追踪: 未启用\n")
+	}
+	if c.DebugWire.Enabled {
+		fmt.Printf("请求抓包: %s (单文件上限 %dMB, 保留 %d 个/%d 小时)\n", c.DebugWire.Dir, c.DebugWire.MaxFileMB, c.DebugWire.MaxFiles, c.DebugWire.MaxAgeHours)
+	} else {
+		fmt.Printf("请求抓包: 未启用\n")
+	}
+	if c.AdminAuth.Enabled() {
+		fmt.Printf("管理认证: %d 个令牌, %d 个用户, 会话有效期 %d 小时\n", len(c.AdminAuth.Tokens), len(c.AdminAuth.Users), c.AdminAuth.SessionHours)
+	} else {
+		fmt.Printf("管理认证: 未配置\n")
+	}
+	if len(c.AdminAuth.AllowedNetworks) > 0 {
+		fmt.Printf("管理服务允许的远程地址: %s\n", strings.Join(c.AdminAuth.AllowedNetworks, ", "))
+	} else {
+		fmt.Printf("管理服务允许的远程地址: 无（仅本机）\n")
+	}
 	fmt.Printf("路由策略: %s\n", c.Routing.Strategy)
 
+	if len(c.Routing.Groups) > 0 {
+		fmt.Printf("Provider 组:\n")
+		for name, members := range c.Routing.Groups {
+			fmt.Printf("  %s: %s\n", name, strings.Join(members, ", "))
+		}
+	}
+
+	if len(c.Routing.Downgrade) > 0 {
+		fmt.Printf("降级链:\n")
+		for _, step := range c.Routing.Downgrade {
+			fmt.Printf("  %s -> %s\n", step.From, step.To)
+			for name, model := range step.Models {
+				fmt.Printf("    %s: %s\n", name, model)
+			}
+		}
+	}
+
+	if len(c.Routing.Rules) > 0 {
+		fmt.Printf("路由规则 (%d条):\n", len(c.Routing.Rules))
+		for i, rule := range c.Routing.Rules {
+			fmt.Printf("  [%d] %s -> %s\n", i+1, rule.Name, rule.Target)
+		}
+	}
+
 	fmt.Printf("\n=== Provider 配置 (%d个) ===\n", len(c.Providers))
 	for i, provider := range c.Providers {
 		fmt.Printf("\n[%d] %s\n", i+1, provider.Name)
 		fmt.Printf("  状态: %s\n", provider.State)
+		if provider.ContextWindow > 0 || provider.MaxOutputTokens > 0 {
+			fmt.Printf("  上下文窗口: %d, 最大输出: %d\n", provider.ContextWindow, provider.MaxOutputTokens)
+		}
+		if provider.ImagePolicy != nil && provider.ImagePolicy.Mode != "pass" {
+			fmt.Printf("  图片策略: %s (最大边长 %d, 最大 %d 字节)\n", provider.ImagePolicy.Mode, provider.ImagePolicy.MaxDimension, provider.ImagePolicy.MaxBytes)
+		}
+		if provider.SystemPrefix != "" || provider.SystemSuffix != "" {
+			fmt.Printf("  System 注入: 前缀 %d 字符, 后缀 %d 字符\n", len([]rune(provider.SystemPrefix)), len([]rune(provider.SystemSuffix)))
+		}
+		if provider.TracePropagation {
+			fmt.Printf("  传递 traceparent: 是\n")
+		}
+		if provider.Pricing != nil {
+			fmt.Printf("  价格(每百万token): 输入 %.4g, 输出 %.4g\n", provider.Pricing.InputPerMTok, provider.Pricing.OutputPerMTok)
+		}
+		if !provider.Budget.IsZero() {
+			fmt.Printf("  预算: %s\n", provider.Budget.Describe())
+		}
+		if len(provider.FallbackModels) > 0 {
+			fmt.Printf("  备用模型: %s\n", strings.Join(provider.FallbackModels, " -> "))
+		}
+		for model, limit := range provider.ModelLimits {
+			fmt.Printf("  模型 %s: 上下文窗口 %d, 最大输出 %d\n", model, limit.ContextWindow, limit.MaxOutputTokens)
+		}
 
 		// 显示环境变量
 		fmt.Printf("  环境变量:\n")
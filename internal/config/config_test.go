@@ -15,3 +15,16 @@ func TestExampleConfig(t *testing.T) {
 		t.Error("Example config seems too short")
 	}
 }
+
+func TestTracingValidate(t *testing.T) {
+	for _, protocol := range []string{"", "http/json", "HTTP/JSON", "grpc"} {
+		if err := (Tracing{Protocol: protocol}).Validate(); err != nil {
+			t.Errorf("protocol %q: %v", protocol, err)
+		}
+	}
+	for _, protocol := range []string{"http/protobuf", "grpc/json"} {
+		if err := (Tracing{Protocol: protocol}).Validate(); err == nil {
+			t.Errorf("protocol %q should be rejected", protocol)
+		}
+	}
+}
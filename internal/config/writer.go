@@ -0,0 +1,380 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrConfigConflict 配置文件在读取之后已被修改
+var ErrConfigConflict = errors.New("配置文件已被其他人修改，请刷新后重试")
+
+// writeMutex 串行化进程内对配置文件的修改
+var writeMutex sync.Mutex
+
+// runtimeApplied 本进程最近一次写回、且修改已在运行时生效的配置文件内容哈希
+// ConfigWatcher 检测到文件内容与之相同时跳过这一次重载，避免重建 ProviderManager 丢失运行时状态
+var runtimeApplied struct {
+	hash  string
+	mutex sync.Mutex
+}
+
+// setRuntimeApplied 记录已在运行时生效的配置文件内容哈希，为空时清除
+func setRuntimeApplied(hash string) {
+	runtimeApplied.mutex.Lock()
+	defer runtimeApplied.mutex.Unlock()
+	runtimeApplied.hash = hash
+}
+
+// consumeRuntimeApplied 判断配置文件内容是否为本进程写回且已在运行时生效的内容，并清除记录的哈希
+// 记录只用于跳过写回引起的那一次文件变化，之后的变化（包括手动改回相同的内容）都正常重载
+func consumeRuntimeApplied(data []byte) bool {
+	runtimeApplied.mutex.Lock()
+	defer runtimeApplied.mutex.Unlock()
+	applied := runtimeApplied.hash != "" && runtimeApplied.hash == contentHash(data)
+	runtimeApplied.hash = ""
+	return applied
+}
+
+// ConfigPath 返回配置文件路径 ~/.claude-code-env/settings.json
+func ConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户主目录失败: %v", err)
+	}
+	return filepath.Join(homeDir, ".claude-code-env", "settings.json"), nil
+}
+
+// jsonObject 保留字段顺序的 JSON 对象，用于修改配置文件时不打乱用户的字段顺序
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// parseJSONObject 解析 JSON 对象，保留字段顺序
+func parseJSONObject(data []byte) (*jsonObject, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("不是 JSON 对象")
+	}
+
+	obj := &jsonObject{values: make(map[string]json.RawMessage)}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		if _, exists := obj.values[key]; !exists {
+			obj.keys = append(obj.keys, key)
+		}
+		obj.values[key] = value
+	}
+	return obj, nil
+}
+
+// set 设置字段值，字段不存在时追加到末尾
+func (o *jsonObject) set(key string, value interface{}) error {
+	data, err := marshalNoEscape(value)
+	if err != nil {
+		return err
+	}
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = data
+	return nil
+}
+
+// bytes 按原有字段顺序序列化为紧凑的 JSON
+func (o *jsonObject) bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := marshalNoEscape(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// marshalNoEscape 序列化 JSON，不转义 <、>、& 等 HTML 字符
+func marshalNoEscape(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// contentHash 返回配置文件内容的哈希，用于检测并发修改
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// updateConfigFile 读取配置文件，调用 update 修改后校验并原子写回（写临时文件后重命名）
+// expectedHash 不为空且与当前文件内容不一致时返回 ErrConfigConflict
+// 写回前将原文件备份为 settings.json.bak，写回后 ConfigWatcher 会检测到变化并热重载配置
+// appliedAtRuntime 为 true 表示修改已在运行时生效，ConfigWatcher 不会因这次写回重载配置
+func updateConfigFile(expectedHash string, appliedAtRuntime bool, update func(doc *jsonObject) error) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	if expectedHash != "" && expectedHash != contentHash(data) {
+		return ErrConfigConflict
+	}
+	doc, err := parseJSONObject(data)
+	if err != nil {
+		return fmt.Errorf("解析配置文件失败: %v", err)
+	}
+
+	if err := update(doc); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, doc.bytes(), "", "    "); err != nil {
+		return fmt.Errorf("格式化配置失败: %v", err)
+	}
+	out.WriteByte('\n')
+
+	// 确认修改后的配置仍然可以被正常加载
+	var check Config
+	if err := json.Unmarshal(out.Bytes(), &check); err != nil {
+		return fmt.Errorf("修改后的配置无效: %v", err)
+	}
+
+	if err := writeFileAtomic(configPath+".bak", data); err != nil {
+		return fmt.Errorf("备份配置文件失败: %v", err)
+	}
+
+	// 在写回前记录，确保 ConfigWatcher 收到文件变化时已能识别
+	if appliedAtRuntime {
+		setRuntimeApplied(contentHash(out.Bytes()))
+	} else {
+		setRuntimeApplied("")
+	}
+	if err := writeFileAtomic(configPath, out.Bytes()); err != nil {
+		setRuntimeApplied("")
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，避免写入中途被读取到不完整的内容
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入临时文件失败: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入临时文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入临时文件失败: %v", err)
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return fmt.Errorf("设置文件权限失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("替换配置文件失败: %v", err)
+	}
+	return nil
+}
+
+// SaveProviderState 将已在运行时生效的 provider state（on/off）写回配置文件，不会触发配置重载
+func SaveProviderState(name, state string) error {
+	return updateConfigFile("", true, func(doc *jsonObject) error {
+		var providers []json.RawMessage
+		if err := json.Unmarshal(doc.values["providers"], &providers); err != nil {
+			return fmt.Errorf("解析 providers 失败: %v", err)
+		}
+
+		for i, raw := range providers {
+			provider, err := parseJSONObject(raw)
+			if err != nil {
+				return fmt.Errorf("解析 providers 失败: %v", err)
+			}
+			var providerName string
+			json.Unmarshal(provider.values["name"], &providerName)
+			if providerName != name {
+				continue
+			}
+			if err := provider.set("state", state); err != nil {
+				return err
+			}
+			providers[i] = provider.bytes()
+			return doc.set("providers", providers)
+		}
+		return fmt.Errorf("配置文件中不存在 provider %s", name)
+	})
+}
+
+// SaveRoutingStrategy 将已在运行时生效的路由策略写回配置文件，不会触发配置重载
+func SaveRoutingStrategy(strategy string) error {
+	return updateConfigFile("", true, func(doc *jsonObject) error {
+		routing := &jsonObject{values: make(map[string]json.RawMessage)}
+		if raw, exists := doc.values["routing"]; exists && string(raw) != "null" {
+			var err error
+			if routing, err = parseJSONObject(raw); err != nil {
+				return fmt.Errorf("解析 routing 失败: %v", err)
+			}
+		}
+		if err := routing.set("strategy", strategy); err != nil {
+			return err
+		}
+		return doc.set("routing", json.RawMessage(routing.bytes()))
+	})
+}
+
+// ReadProviders 读取配置文件中的 providers（不应用默认值）和文件内容的哈希
+func ReadProviders() ([]Provider, string, error) {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, "", fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return cfg.Providers, contentHash(data), nil
+}
+
+// SaveProviders 校验并用 providers 替换配置文件中的 providers，其他配置保持不变
+// hash 为读取时的文件哈希，文件已被修改时返回 ErrConfigConflict
+func SaveProviders(providers []Provider, hash string) error {
+	if err := ValidateProviders(providers); err != nil {
+		return err
+	}
+	if providers == nil {
+		providers = []Provider{}
+	}
+	return updateConfigFile(hash, false, func(doc *jsonObject) error {
+		return doc.set("providers", providers)
+	})
+}
+
+// ValidateProviders 校验 providers 配置，返回所有问题
+func ValidateProviders(providers []Provider) error {
+	var problems []string
+	names := make(map[string]bool)
+	for i, p := range providers {
+		label := fmt.Sprintf("第 %d 个 provider", i+1)
+		if p.Name != "" {
+			label = "provider " + p.Name
+		}
+
+		switch {
+		case strings.TrimSpace(p.Name) == "":
+			problems = append(problems, label+" 缺少名称")
+		case names[p.Name]:
+			problems = append(problems, label+" 名称重复")
+		}
+		names[p.Name] = true
+
+		if p.State != "on" && p.State != "off" {
+			problems = append(problems, fmt.Sprintf("%s 的 state 应为 on 或 off", label))
+		}
+		baseURL, err := url.Parse(p.Env["ANTHROPIC_BASE_URL"])
+		if p.Env["ANTHROPIC_BASE_URL"] == "" {
+			problems = append(problems, label+" 缺少 ANTHROPIC_BASE_URL")
+		} else if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s 的 ANTHROPIC_BASE_URL 不是有效的 http(s) 地址", label))
+		}
+		if p.State == "on" && p.Env["ANTHROPIC_AUTH_TOKEN"] == "" && p.Env["ANTHROPIC_API_KEY"] == "" {
+			problems = append(problems, label+" 已启用但缺少 ANTHROPIC_AUTH_TOKEN 或 ANTHROPIC_API_KEY")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// MaskProviderSecrets 返回 env 中敏感值打码后的 providers 副本，用于在管理界面展示
+func MaskProviderSecrets(providers []Provider) []Provider {
+	masked := make([]Provider, len(providers))
+	for i, p := range providers {
+		env := make(map[string]string, len(p.Env))
+		for key, value := range p.Env {
+			if isSensitiveKey(key) {
+				value = maskSensitiveValue(value)
+			}
+			env[key] = value
+		}
+		p.Env = env
+		masked[i] = p
+	}
+	return masked
+}
+
+// RestoreProviderSecrets 将仍为打码值（未被编辑）的敏感 env 还原为 original 中的原值
+// original 为 nil（新增的 provider）或原值不存在时返回错误
+func RestoreProviderSecrets(p *Provider, original *Provider) error {
+	for key, value := range p.Env {
+		if !isSensitiveKey(key) || value == "" {
+			continue
+		}
+		if original != nil {
+			if originalValue, exists := original.Env[key]; exists && value == maskSensitiveValue(originalValue) {
+				p.Env[key] = originalValue
+				continue
+			}
+		}
+		if strings.Trim(value, "*") == "" || (len(value) > 8 && strings.Contains(value, "****")) {
+			return fmt.Errorf("provider %s 的 %s 是打码后的值，请重新填写", p.Name, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveProviderState(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".claude-code-env", "settings.json")
+	os.MkdirAll(filepath.Dir(configPath), 0755)
+	os.WriteFile(configPath, []byte(`{"version": "2.0", "providers": [
+		{"name": "a", "state": "on", "env": {"ANTHROPIC_AUTH_TOKEN": "a<&>b"}},
+		{"name": "b", "state": "on", "env": {}}
+	], "LOGGING_LEVEL": "INFO"}`), 0600)
+
+	if err := SaveProviderState("b", "off"); err != nil {
+		t.Fatalf("SaveProviderState() error = %v", err)
+	}
+	if err := SaveRoutingStrategy("robin"); err != nil {
+		t.Fatalf("SaveRoutingStrategy() error = %v", err)
+	}
+	if err := SaveProviderState("missing", "off"); err == nil {
+		t.Error("SaveProviderState(missing) should fail")
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Providers[0].State != "on" || cfg.Providers[1].State != "off" || cfg.Routing.Strategy != "robin" {
+		t.Errorf("providers = %+v, routing = %+v", cfg.Providers, cfg.Routing)
+	}
+
+	data, _ := os.ReadFile(configPath)
+	content := string(data)
+	// 运行时已生效的写回不应触发配置重载，但只跳过一次：之后手动改回相同的内容需要重载
+	if !consumeRuntimeApplied(data) {
+		t.Error("runtime-applied write should be skipped by the config watcher")
+	}
+	if consumeRuntimeApplied(data) {
+		t.Error("runtime-applied hash should be cleared after the first match")
+	}
+	// 字段保持原有顺序，新字段追加到末尾，不转义 HTML 字符
+	order := []string{`"version"`, `"providers"`, `"LOGGING_LEVEL"`, `"routing"`}
+	for i := 1; i < len(order); i++ {
+		if strings.Index(content, order[i-1]) > strings.Index(content, order[i]) {
+			t.Errorf("field %s should come before %s:\n%s", order[i-1], order[i], content)
+		}
+	}
+	if !strings.Contains(content, `"a<&>b"`) {
+		t.Errorf("secret should not be escaped:\n%s", content)
+	}
+	if info, _ := os.Stat(configPath); info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestSaveProviders(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".claude-code-env", "settings.json")
+	os.MkdirAll(filepath.Dir(configPath), 0755)
+	original := `{"providers": [{"name": "a", "state": "on", "env": {"ANTHROPIC_BASE_URL": "https://a.example.com", "ANTHROPIC_AUTH_TOKEN": "sk-original-token"}}], "ADMIN_PORT": 9000}`
+	os.WriteFile(configPath, []byte(original), 0644)
+
+	providers, hash, err := ReadProviders()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未修改的打码密钥还原为原值
+	masked := MaskProviderSecrets(providers)[0]
+	if masked.Env["ANTHROPIC_AUTH_TOKEN"] == "sk-original-token" || providers[0].Env["ANTHROPIC_AUTH_TOKEN"] != "sk-original-token" {
+		t.Fatalf("MaskProviderSecrets() = %v, original = %v", masked.Env, providers[0].Env)
+	}
+	masked.Name = "renamed"
+	if err := RestoreProviderSecrets(&masked, &providers[0]); err != nil || masked.Env["ANTHROPIC_AUTH_TOKEN"] != "sk-original-token" {
+		t.Fatalf("RestoreProviderSecrets() = %v, %v", masked.Env, err)
+	}
+	added := MaskProviderSecrets(providers)[0]
+	if err := RestoreProviderSecrets(&added, nil); err == nil {
+		t.Error("masked secret without original should fail")
+	}
+
+	if err := SaveProviders([]Provider{masked, {Name: "b", State: "on", Env: map[string]string{"ANTHROPIC_BASE_URL": "https://b"}}}, hash); err == nil {
+		t.Error("provider without auth should fail validation")
+	}
+	if err := SaveProviders([]Provider{masked}, hash); err != nil {
+		t.Fatalf("SaveProviders() error = %v", err)
+	}
+	if err := SaveProviders([]Provider{masked}, hash); err != ErrConfigConflict {
+		t.Errorf("SaveProviders() with stale hash error = %v, want ErrConfigConflict", err)
+	}
+
+	// 编辑 providers 需要重载配置才能生效
+	if data, _ := os.ReadFile(configPath); consumeRuntimeApplied(data) {
+		t.Error("saved providers should trigger a config reload")
+	}
+	if backup, _ := os.ReadFile(configPath + ".bak"); string(backup) != original {
+		t.Errorf("backup = %s", backup)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Providers) != 1 || cfg.Providers[0].Name != "renamed" || cfg.AdminPort != 9000 {
+		t.Errorf("config after save = %+v", cfg)
+	}
+}
@@ -0,0 +1,63 @@
+package executor
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// HashPassword 读取密码并输出 bcrypt 哈希，用于 admin_auth.users 的 password_hash
+// 在终端中运行时不回显输入并要求确认，否则从标准输入读取第一行
+func HashPassword() error {
+	var password string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "密码: ")
+		first, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return fmt.Errorf("读取密码失败: %v", err)
+		}
+		fmt.Fprint(os.Stderr, "确认密码: ")
+		second, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return fmt.Errorf("读取密码失败: %v", err)
+		}
+		if string(first) != string(second) {
+			return fmt.Errorf("两次输入的密码不一致")
+		}
+		password = string(first)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("读取密码失败: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		return fmt.Errorf("密码不能为空")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("生成密码哈希失败: %v", err)
+	}
+	fmt.Println(string(hash))
+	return nil
+}
+
+// GenerateAdminToken 输出随机生成的管理服务令牌，用于 admin_auth.tokens
+func GenerateAdminToken() error {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("生成令牌失败: %v", err)
+	}
+	fmt.Println("ccenv_" + hex.EncodeToString(buf))
+	return nil
+}
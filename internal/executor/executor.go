@@ -1,8 +1,10 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -10,14 +12,19 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/imty42/claude-code-env/internal/capture"
 	"github.com/imty42/claude-code-env/internal/config"
 	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/logview"
+	"github.com/imty42/claude-code-env/internal/metrics"
 	"github.com/imty42/claude-code-env/internal/provider"
 	"github.com/imty42/claude-code-env/internal/server_routing_manager"
+	"github.com/imty42/claude-code-env/internal/timeparse"
+	"github.com/imty42/claude-code-env/internal/usage"
 )
 
-// StartProxyService 启动代理服务（前台运行）
-func StartProxyService() error {
+// StartProxyService 启动代理服务（前台运行），debugWire 为 true 时开启请求抓包
+func StartProxyService(debugWire bool) error {
 	// 1. 加载配置
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -25,7 +32,7 @@ func StartProxyService() error {
 	}
 
 	// 2. 初始化日志系统
-	err = logger.InitLogger(cfg.LoggingLevel)
+	err = logger.InitLogger(loggerOptions(cfg))
 	if err != nil {
 		return fmt.Errorf("初始化日志系统失败: %v", err)
 	}
@@ -69,14 +76,10 @@ func StartProxyService() error {
 
 	// 5. 创建 ProviderManager 和服务路由管理器
 	providerManager := provider.NewProviderManager(cfg)
-	routingManager := server_routing_manager.NewServerRoutingManager(
-		providerManager,
-		cfg.CCEnvHost,
-		cfg.LLMProxyPort,
-		cfg.AdminPort,
-		cfg.APIProxy,
-		time.Duration(cfg.APITimeoutMS)*time.Millisecond,
-	)
+	routingManager := server_routing_manager.NewServerRoutingManager(providerManager, cfg)
+	if debugWire {
+		capture.SetEnabled(true)
+	}
 
 	err = routingManager.Start()
 	if err != nil {
@@ -111,32 +114,33 @@ func StartProxyService() error {
 
 			// 重新初始化日志（可能日志级别改了）
 			logger.CloseLogger()
-			err = logger.InitLogger(newConfig.LoggingLevel)
+			err = logger.InitLogger(loggerOptions(newConfig))
 			if err != nil {
 				logger.Error(logger.ModuleExecutor, "重新初始化日志系统失败: %v", err)
+				metrics.ConfigReloads.Inc("failure")
 				continue
 			}
 
-			// 创建新的 ProviderManager 和服务路由管理器
+			// 创建新的 ProviderManager，继承熔断、强制使用等运行时状态，再创建服务路由管理器
+			previousManager := providerManager
 			providerManager = provider.NewProviderManager(newConfig)
-			routingManager = server_routing_manager.NewServerRoutingManager(
-				providerManager,
-				newConfig.CCEnvHost,
-				newConfig.LLMProxyPort,
-				newConfig.AdminPort,
-				newConfig.APIProxy,
-				time.Duration(newConfig.APITimeoutMS)*time.Millisecond,
-			)
+			providerManager.InheritRuntimeState(previousManager)
+			routingManager = server_routing_manager.NewServerRoutingManager(providerManager, newConfig)
 
 			err = routingManager.Start()
 			if err != nil {
 				logger.Error(logger.ModuleExecutor, "重启代理服务器失败: %v", err)
+				metrics.ConfigReloads.Inc("failure")
 				continue
 			}
 
+			metrics.ConfigReloads.Inc("success")
 			logger.Info(logger.ModuleExecutor, "代理服务已重启完成")
 
 		case err := <-configWatcher.GetErrorChan():
+			if errors.Is(err, config.ErrConfigReload) {
+				metrics.ConfigReloads.Inc("failure")
+			}
 			logger.Error(logger.ModuleExecutor, "配置监控错误: %v", err)
 		}
 	}
@@ -161,7 +165,7 @@ func ExecuteClaudeWithProxy(args []string) error {
 	}
 
 	// 2. 初始化日志系统
-	err = logger.InitLogger(cfg.LoggingLevel)
+	err = logger.InitLogger(loggerOptions(cfg))
 	if err != nil {
 		return fmt.Errorf("初始化日志系统失败: %v", err)
 	}
@@ -198,22 +202,15 @@ func ExecuteClaudeWithProxy(args []string) error {
 
 		// 5. 创建 ProviderManager 和服务路由管理器
 		providerManager := provider.NewProviderManager(cfg)
-		routingManager = server_routing_manager.NewServerRoutingManager(
-			providerManager,
-			cfg.CCEnvHost,
-			cfg.LLMProxyPort,
-			cfg.AdminPort,
-			cfg.APIProxy,
-			time.Duration(cfg.APITimeoutMS)*time.Millisecond,
-		)
+		routingManager = server_routing_manager.NewServerRoutingManager(providerManager, cfg)
 
 		err = routingManager.Start()
 		if err != nil {
 			return fmt.Errorf("启动代理服务器失败: %v", err)
 		}
 
-		// 确保代理服务器在程序退出时关闭
-		defer routingManager.Shutdown()
+		// 确保代理服务器在程序退出时关闭，配置重载会替换 routingManager，退出时关闭当前的实例
+		defer func() { routingManager.Shutdown() }()
 
 		logger.Info(logger.ModuleExecutor, "透明代理服务已启动")
 
@@ -232,32 +229,33 @@ func ExecuteClaudeWithProxy(args []string) error {
 
 					// 重新初始化日志（可能日志级别改了）
 					logger.CloseLogger()
-					err = logger.InitLogger(newConfig.LoggingLevel)
+					err = logger.InitLogger(loggerOptions(newConfig))
 					if err != nil {
 						logger.Error(logger.ModuleExecutor, "重新初始化日志系统失败: %v", err)
+						metrics.ConfigReloads.Inc("failure")
 						continue
 					}
 
-					// 创建新的 ProviderManager 和服务路由管理器
+					// 创建新的 ProviderManager，继承熔断、强制使用等运行时状态，再创建服务路由管理器
+					previousManager := providerManager
 					providerManager = provider.NewProviderManager(newConfig)
-					routingManager = server_routing_manager.NewServerRoutingManager(
-						providerManager,
-						newConfig.CCEnvHost,
-						newConfig.LLMProxyPort,
-						newConfig.AdminPort,
-						newConfig.APIProxy,
-						time.Duration(newConfig.APITimeoutMS)*time.Millisecond,
-					)
+					providerManager.InheritRuntimeState(previousManager)
+					routingManager = server_routing_manager.NewServerRoutingManager(providerManager, newConfig)
 
 					err = routingManager.Start()
 					if err != nil {
 						logger.Error(logger.ModuleExecutor, "重启代理服务器失败: %v", err)
+						metrics.ConfigReloads.Inc("failure")
 						continue
 					}
 
+					metrics.ConfigReloads.Inc("success")
 					logger.Info(logger.ModuleExecutor, "代理服务已重启完成")
 
 				case err := <-configWatcher.GetErrorChan():
+					if errors.Is(err, config.ErrConfigReload) {
+						metrics.ConfigReloads.Inc("failure")
+					}
 					logger.Error(logger.ModuleExecutor, "配置监控错误: %v", err)
 				}
 			}
@@ -320,17 +318,51 @@ func ExecuteClaudeWithProxy(args []string) error {
 	return err
 }
 
+// ConfigOptions 显示配置时路由预览使用的示例请求，Sample 为 false 时预览内置的示例请求
+type ConfigOptions struct {
+	Sample   bool     // 是否指定了示例请求
+	Model    string   // 请求的模型
+	Headers  []string // 请求头，格式为 key=value
+	Tokens   int      // 估算的输入 token 数
+	Tools    bool     // 是否携带 tools
+	Images   bool     // 是否包含图片
+	Thinking bool     // 是否开启 thinking
+}
+
 // ShowConfig 显示当前配置信息
-func ShowConfig() error {
+func ShowConfig(options ConfigOptions) error {
 	// 加载配置
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		return fmt.Errorf("加载配置失败: %v", err)
 	}
 
+	var sample *provider.RequestInfo
+	if options.Sample {
+		info := provider.RequestInfo{
+			Model:           options.Model,
+			HasTools:        options.Tools,
+			HasImages:       options.Images,
+			Thinking:        options.Thinking,
+			EstimatedTokens: options.Tokens,
+			Headers:         http.Header{},
+		}
+		for _, header := range options.Headers {
+			key, value, ok := strings.Cut(header, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return fmt.Errorf("无效的请求头 %q，格式应为 key=value", header)
+			}
+			info.Headers.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+		sample = &info
+	}
+
 	// 显示配置信息
 	cfg.DisplayConfig()
 
+	// 显示示例请求的路由结果
+	provider.DisplayRoutingPreview(cfg, sample)
+
 	return nil
 }
 
@@ -395,31 +427,140 @@ func ExecuteClaudeWithConfig(serviceConfig config.ServiceConfig, verbose bool) e
 	return err
 }
 
-// ShowLogs 显示日志文件，支持所有 tail 参数
-func ShowLogs(args []string) error {
-	// 1. 获取日志文件路径
-	// 使用与其他函数相同的路径获取方式
-	homeDir, err := os.UserHomeDir()
+// loggerOptions 根据配置生成日志系统选项
+func loggerOptions(cfg *config.Config) logger.Options {
+	return logger.Options{
+		Level:       cfg.LoggingLevel,
+		Format:      cfg.LogFormat,
+		Path:        cfg.LogPath,
+		MaxSizeMB:   cfg.LogMaxSizeMB,
+		RotateDaily: cfg.LogRotateDaily,
+		MaxBackups:  cfg.LogMaxBackups,
+		MaxAgeDays:  cfg.LogMaxAgeDays,
+		Compress:    cfg.LogCompress,
+
+		Secrets:        cfg.Secrets(),
+		RedactPatterns: cfg.RedactPatterns,
+	}
+}
+
+// LogsOptions 日志查看选项
+type LogsOptions struct {
+	Lines    int      // 显示最后多少条匹配的日志，0 表示全部
+	Follow   bool     // 是否持续跟踪新日志
+	Level    string   // 最低日志级别
+	Modules  []string // 模块名
+	Provider string   // provider 名称
+	Request  string   // 请求ID
+	Since    string   // 起始时间，如 30m、2h、7d、2006-01-02
+	Until    string   // 结束时间，格式同 Since
+	Grep     string   // 匹配日志行的正则表达式
+	Color    string   // 着色：auto、always、never
+	Stats    bool     // 输出请求统计而不是日志内容
+}
+
+// ShowLogs 按条件显示日志，按时间顺序读取包括轮转文件（含 .gz）在内的全部日志
+func ShowLogs(options LogsOptions) error {
+	// 1. 获取日志文件路径，配置加载失败时使用默认路径
+	logPath, err := logger.DefaultLogPath()
+	if err != nil {
+		return err
+	}
+	if cfg, err := config.LoadConfig(); err == nil {
+		if logPath, err = logger.ResolveLogPath(cfg.LogPath); err != nil {
+			return err
+		}
+	}
+
+	// 2. 构建过滤条件
+	filter, err := logview.NewFilter(options.Level, options.Modules, options.Provider, options.Request, options.Since, options.Until, options.Grep)
+	if err != nil {
+		return err
+	}
+
+	// 3. 输出统计信息
+	if options.Stats {
+		stats, err := logview.CollectStats(logPath, filter)
+		if err != nil {
+			return err
+		}
+		return stats.WriteTable(os.Stdout)
+	}
+
+	// 4. 输出日志
+	color, err := useColor(options.Color)
 	if err != nil {
-		return fmt.Errorf("获取用户主目录失败: %v", err)
+		return err
 	}
+	return logview.Show(logPath, logview.Options{
+		Lines:  options.Lines,
+		Follow: options.Follow,
+		Color:  color,
+		Filter: filter,
+	}, os.Stdout)
+}
 
-	logPath := fmt.Sprintf("%s/.claude-code-env/ccenv.log", homeDir)
+// useColor 判断是否着色输出，auto 时仅在标准输出为终端且未设置 NO_COLOR 时着色
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("不支持的 --color 取值 %q，可选: auto, always, never", mode)
+}
+
+// UsageOptions 用量报表选项
+type UsageOptions struct {
+	Since  string // 起始时间，如 24h、7d、2006-01-02
+	By     string // 分组维度：day、provider、model、session
+	Format string // 输出格式：table、json、csv
+}
 
-	// 2. 检查文件是否存在
-	if _, err := os.Stat(logPath); os.IsNotExist(err) {
-		return fmt.Errorf("日志文件不存在: %s\n提示：请先运行 'ccenv start' 或 'ccenv code' 生成日志", logPath)
+// ShowUsage 汇总并输出请求用量报表
+func ShowUsage(options UsageOptions) error {
+	since, err := timeparse.Parse(options.Since, time.Now())
+	if err != nil {
+		return err
 	}
 
-	// 3. 构建命令：tail [用户参数...] 日志文件路径
-	cmdArgs := append(args, logPath)
-	cmd := exec.Command("tail", cmdArgs...)
+	storePath, err := usage.DefaultStorePath()
+	if err != nil {
+		return err
+	}
+	records, err := usage.NewStore(storePath).Load(since)
+	if err != nil {
+		return err
+	}
 
-	// 4. 设置标准输入、输出和错误
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	report, err := usage.Summarize(records, options.By)
+	if err != nil {
+		return err
+	}
+	if !since.IsZero() {
+		report.Since = since.Format(time.RFC3339)
+	}
+
+	switch options.Format {
+	case "json":
+		return report.WriteJSON(os.Stdout)
+	case "csv":
+		return report.WriteCSV(os.Stdout)
+	}
 
-	// 5. 执行命令
-	return cmd.Run()
+	if len(records) == 0 {
+		fmt.Printf("暂无用量记录: %s\n", storePath)
+		return nil
+	}
+	if !since.IsZero() {
+		fmt.Printf("统计范围: %s 至今\n\n", since.Format("2006-01-02 15:04:05"))
+	}
+	return report.WriteTable(os.Stdout)
 }
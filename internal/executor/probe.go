@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/llm_proxy"
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/provider"
+)
+
+// probeRequestTimeout 通过管理服务测试时等待响应的时间，上游请求本身的超时由代理服务的配置决定
+const probeRequestTimeout = 10 * time.Minute
+
+// ProbeOptions 连通性测试选项
+type ProbeOptions struct {
+	Model string // 请求的模型，为空时使用默认模型
+	Mode  string // both、stream、non-stream
+}
+
+// TestProviders 向 provider 发送测试请求并输出结果，未指定 provider 时测试所有启用的 provider
+// 代理服务运行时通过管理服务测试（与真实请求共享运行时状态），否则根据配置文件在本地发送请求
+// 有测试失败时返回错误
+func TestProviders(names []string, options ProbeOptions) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %v", err)
+	}
+	modes, err := probeStreamModes(options.Mode)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		for _, p := range cfg.Providers {
+			if p.State == "on" {
+				names = append(names, p.Name)
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("没有启用的 provider")
+		}
+	}
+
+	var probe func(name string) ([]*llm_proxy.ProbeResult, error)
+	if isPortInUse(cfg.CCEnvHost, cfg.AdminPort) {
+		probe = func(name string) ([]*llm_proxy.ProbeResult, error) {
+			var results []*llm_proxy.ProbeResult
+			body := map[string]string{"model": options.Model, "mode": options.Mode}
+			err := adminRequestWithTimeout(http.MethodPost, "/api/providers/"+url.PathEscape(name)+"/test", body, &results, probeRequestTimeout)
+			return results, err
+		}
+	} else {
+		fmt.Println("代理服务未运行，根据配置文件在本地发送测试请求")
+		fmt.Println()
+		if err := logger.InitLogger(loggerOptions(cfg)); err != nil {
+			return fmt.Errorf("初始化日志系统失败: %v", err)
+		}
+		defer logger.CloseLogger()
+
+		providerManager := provider.NewProviderManager(cfg)
+		defer providerManager.Close()
+		server := llm_proxy.NewLLMProxyServer(providerManager, cfg)
+		probe = func(name string) ([]*llm_proxy.ProbeResult, error) {
+			var results []*llm_proxy.ProbeResult
+			for _, stream := range modes {
+				result, err := server.Probe(context.Background(), name, llm_proxy.ProbeOptions{Model: options.Model, Stream: stream})
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, result)
+			}
+			return results, nil
+		}
+	}
+
+	failed := 0
+	for _, name := range names {
+		results, err := probe(name)
+		if err != nil {
+			fmt.Printf("✗ %s: %v\n\n", name, err)
+			failed++
+			continue
+		}
+		for _, result := range results {
+			printProbeResult(result)
+			if !result.OK() {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 项测试失败", failed)
+	}
+	return nil
+}
+
+// probeStreamModes 返回测试模式对应的是否流式，与管理服务的 mode 参数一致
+func probeStreamModes(mode string) ([]bool, error) {
+	switch mode {
+	case "", "both":
+		return []bool{false, true}, nil
+	case "stream":
+		return []bool{true}, nil
+	case "non-stream":
+		return []bool{false}, nil
+	default:
+		return nil, fmt.Errorf("不支持的测试模式 %q，可选: both, stream, non-stream", mode)
+	}
+}
+
+// printProbeResult 输出一次测试的结果
+func printProbeResult(result *llm_proxy.ProbeResult) {
+	mark, kind := "✓", "非流式"
+	if !result.OK() {
+		mark = "✗"
+	}
+	if result.Stream {
+		kind = "流式"
+	}
+	fmt.Printf("%s %s (%s) 请求ID: %s\n", mark, result.Provider, kind, result.RequestID)
+	fmt.Printf("  URL:     %s\n", result.URL)
+	if result.Proxy != "" {
+		fmt.Printf("  代理:    %s\n", result.Proxy)
+	}
+	model := result.RequestedModel + " -> " + result.Model
+	if result.ServedModel != "" {
+		model += " (响应: " + result.ServedModel + ")"
+	}
+	fmt.Printf("  模型:    %s\n", model)
+	if result.RemoteAddr != "" {
+		fmt.Printf("  连接:    %s %s\n", result.RemoteAddr, result.TLSVersion)
+	}
+
+	timings := []string{
+		"DNS " + formatProbeMS(result.DNSMS),
+		"连接 " + formatProbeMS(result.ConnectMS),
+		"TLS " + formatProbeMS(result.TLSMS),
+		"响应头 " + formatProbeMS(result.HeadersMS),
+	}
+	if result.Stream {
+		timings = append(timings, "首 token "+formatProbeMS(result.TTFTMS))
+	}
+	timings = append(timings, "总计 "+formatProbeMS(result.TotalMS))
+	fmt.Printf("  耗时:    %s\n", strings.Join(timings, ", "))
+
+	if result.Status != 0 {
+		status := fmt.Sprintf("%d", result.Status)
+		if result.UpstreamRequestID != "" {
+			status += " (上游请求ID: " + result.UpstreamRequestID + ")"
+		}
+		fmt.Printf("  状态码:  %s\n", status)
+	}
+	if result.OK() {
+		fmt.Printf("  Token:   输入 %d, 输出 %d, stop_reason %s\n", result.Usage.InputTokens, result.Usage.OutputTokens, result.StopReason)
+		fmt.Printf("  回复:    %q\n", result.Reply)
+	} else {
+		fmt.Printf("  错误:    %s\n", result.Error)
+		if result.ErrorBody != "" {
+			fmt.Printf("  响应:    %s\n", result.ErrorBody)
+		}
+	}
+	fmt.Println()
+}
+
+// formatProbeMS 格式化毫秒耗时，未记录时显示 -
+func formatProbeMS(ms float64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0fms", ms)
+}
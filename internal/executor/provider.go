@@ -0,0 +1,200 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/provider"
+)
+
+// adminRequest 向运行中的管理服务发送请求，将 JSON 响应解析到 result
+func adminRequest(method, path string, body interface{}, result interface{}) error {
+	return adminRequestWithTimeout(method, path, body, result, 10*time.Second)
+}
+
+// adminRequestWithTimeout 与 adminRequest 相同，用于需要等待上游响应的较慢请求
+func adminRequestWithTimeout(method, path string, body interface{}, result interface{}, timeout time.Duration) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %v", err)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := fmt.Sprintf("http://%s:%d%s", cfg.CCEnvHost, cfg.AdminPort, path)
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := adminToken(cfg); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接管理服务失败，代理服务是否在运行？(%v)", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取管理服务响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errorResp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &errorResp) == nil && errorResp.Error != "" {
+			return fmt.Errorf("%s", errorResp.Error)
+		}
+		return fmt.Errorf("管理服务返回 %s", resp.Status)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("解析管理服务响应失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// adminToken 返回访问管理服务使用的令牌：优先使用环境变量 CCENV_ADMIN_TOKEN，其次使用配置中第一个 admin 角色的令牌
+func adminToken(cfg *config.Config) string {
+	if token := os.Getenv("CCENV_ADMIN_TOKEN"); token != "" {
+		return token
+	}
+	for _, token := range cfg.AdminAuth.Tokens {
+		if token.Role == config.AdminRoleAdmin {
+			return token.Token
+		}
+	}
+	return ""
+}
+
+// ListProviders 输出运行中代理服务的 provider 状态
+func ListProviders() error {
+	var providers []provider.ProviderStatus
+	if err := adminRequest(http.MethodGet, "/api/providers", nil, &providers); err != nil {
+		return err
+	}
+	var routing struct {
+		Strategy       string `json:"strategy"`
+		ForcedProvider string `json:"forced_provider"`
+		ForcedUntil    string `json:"forced_until"`
+	}
+	if err := adminRequest(http.MethodGet, "/api/routing", nil, &routing); err != nil {
+		return err
+	}
+
+	fmt.Printf("路由策略: %s\n", routing.Strategy)
+	if routing.ForcedProvider != "" {
+		fmt.Printf("强制使用: %s (到期时间: %s)\n", routing.ForcedProvider, routing.ForcedUntil)
+	}
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\t状态\t可用\t熔断\t失败次数\tP50\t最后错误")
+	for _, ps := range providers {
+		available := "是"
+		if !ps.Available {
+			available = "否"
+		}
+		if ps.Forced {
+			available += " (强制)"
+		}
+		breaker := ps.Breaker
+		if ps.Breaker == provider.BreakerOpen && ps.DisabledUntil != nil {
+			breaker += " 至 " + ps.DisabledUntil.Local().Format("15:04:05")
+		}
+		latency := "-"
+		if ps.Latency.Samples > 0 {
+			latency = fmt.Sprintf("%dms", ps.Latency.P50MS)
+		}
+		lastError := ps.LastError
+		if lastError == "" {
+			lastError = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", ps.Name, ps.State, available, breaker, ps.FailureCount, latency, lastError)
+	}
+	return tw.Flush()
+}
+
+// ProviderAction 对运行中代理服务的 provider 执行控制操作：enable、disable、reset、force、unforce
+// persist 为 true 时将启用/禁用写回配置文件，duration 为强制使用时长
+func ProviderAction(action, name string, persist bool, duration time.Duration) error {
+	path := "/api/providers/" + url.PathEscape(name) + "/" + action
+	if persist {
+		path += "?persist=true"
+	}
+
+	var status provider.ProviderStatus
+	var err error
+	switch action {
+	case "force":
+		body := map[string]string{}
+		if duration > 0 {
+			body["duration"] = duration.String()
+		}
+		err = adminRequest(http.MethodPost, path, body, &status)
+	case "unforce":
+		err = adminRequest(http.MethodDelete, "/api/providers/"+url.PathEscape(name)+"/force", nil, &status)
+	default:
+		err = adminRequest(http.MethodPost, path, nil, &status)
+	}
+	if err != nil {
+		return err
+	}
+
+	messages := map[string]string{
+		"enable":  "已启用",
+		"disable": "已禁用",
+		"reset":   "已重置失败计数和熔断状态",
+		"force":   "已设为唯一目标",
+		"unforce": "已取消强制使用，恢复正常路由",
+	}
+	fmt.Printf("provider %s %s\n", name, messages[action])
+	if action == "force" {
+		fmt.Println("到期后自动恢复正常路由，可使用 ccenv provider unforce 提前取消")
+	}
+	if persist {
+		fmt.Println("已写回配置文件，代理服务将自动重载配置")
+	} else if action == "enable" || action == "disable" {
+		fmt.Println("仅在运行时生效，配置重载或重启后恢复为配置文件中的状态（使用 --persist 写回配置文件）")
+	}
+	return nil
+}
+
+// SetRoutingStrategy 切换运行中代理服务的路由策略，persist 为 true 时写回配置文件
+func SetRoutingStrategy(strategy string, persist bool) error {
+	path := "/api/routing"
+	if persist {
+		path += "?persist=true"
+	}
+	if err := adminRequest(http.MethodPost, path, map[string]string{"strategy": strings.ToLower(strategy)}, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("路由策略已切换为 %s\n", strategy)
+	if persist {
+		fmt.Println("已写回配置文件，代理服务将自动重载配置")
+	}
+	return nil
+}
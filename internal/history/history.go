@@ -0,0 +1,231 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/usage"
+)
+
+// ErrorBodyLimit 错误响应体最多保留的字节数，超出部分截断并以 ... 结尾
+const ErrorBodyLimit = 2048
+
+// Attempt 一次上游尝试
+type Attempt struct {
+	Provider          string    `json:"provider"`
+	Model             string    `json:"model"` // 映射后发送给上游的模型
+	StartedAt         time.Time `json:"started_at"`
+	LatencyMS         int64     `json:"latency_ms"` // 发送请求到收到响应头的耗时
+	Status            int       `json:"status,omitempty"`
+	UpstreamRequestID string    `json:"upstream_request_id,omitempty"`
+	Overloaded        bool      `json:"overloaded,omitempty"` // 限流或过载，继续尝试下一个备选
+	Error             string    `json:"error,omitempty"`
+}
+
+// Request 一个 /v1/messages 请求的处理记录
+type Request struct {
+	ID                string      `json:"id"`
+	StartedAt         time.Time   `json:"started_at"`
+	FinishedAt        *time.Time  `json:"finished_at,omitempty"` // 为空表示仍在处理
+	DurationMS        int64       `json:"duration_ms"`
+	TTFTMS            int64       `json:"ttft_ms,omitempty"`
+	Session           string      `json:"session,omitempty"`
+	UserAgent         string      `json:"user_agent,omitempty"`
+	RequestedModel    string      `json:"requested_model"`
+	Stream            bool        `json:"stream"`
+	Provider          string      `json:"provider,omitempty"`     // 实际服务的 provider
+	ServedModel       string      `json:"served_model,omitempty"` // 实际服务的模型
+	UpstreamRequestID string      `json:"upstream_request_id,omitempty"`
+	Status            int         `json:"status"` // 返回给客户端的状态码
+	Attempts          []Attempt   `json:"attempts"`
+	Usage             usage.Usage `json:"usage"`
+	ErrorBody         string      `json:"error_body,omitempty"` // 返回给客户端的错误响应体，脱敏并截断
+}
+
+// Entry 正在记录的请求，未开启记录时为 nil，所有方法都可以在 nil 上安全调用
+type Entry struct {
+	request Request
+}
+
+// global 最近请求的环形缓冲，与监控指标一样全局共享，配置重载时保留已有记录
+var global struct {
+	entries []*Entry // 按写入顺序循环使用，长度为容量
+	next    int      // 下一个写入位置
+	count   int      // 已写入的记录数，不超过容量
+	mutex   sync.RWMutex
+}
+
+// Configure 设置保留的请求数，size 为 0 时不记录；调整容量时保留最近的记录
+func Configure(size int) {
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+
+	if size < 0 {
+		size = 0
+	}
+	if size == len(global.entries) {
+		return
+	}
+	recent := recentLocked(size)
+	global.entries = make([]*Entry, size)
+	for i, e := range recent {
+		global.entries[len(recent)-1-i] = e
+	}
+	global.count = len(recent)
+	global.next = 0
+	if size > 0 {
+		global.next = len(recent) % size
+	}
+}
+
+// recentLocked 返回最近的 limit 条记录，最新的在前，调用方需持有锁
+func recentLocked(limit int) []*Entry {
+	if limit > global.count {
+		limit = global.count
+	}
+	result := make([]*Entry, 0, limit)
+	for i := 1; i <= limit; i++ {
+		index := (global.next - i + len(global.entries)) % len(global.entries)
+		result = append(result, global.entries[index])
+	}
+	return result
+}
+
+// Begin 开始记录一个请求，未开启记录时返回 nil
+func Begin(id string, startTime time.Time, userAgent string) *Entry {
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+
+	if len(global.entries) == 0 {
+		return nil
+	}
+	e := &Entry{request: Request{ID: id, StartedAt: startTime, UserAgent: userAgent}}
+	global.entries[global.next] = e
+	global.next = (global.next + 1) % len(global.entries)
+	if global.count < len(global.entries) {
+		global.count++
+	}
+	return e
+}
+
+// SetRequest 记录客户端请求的模型、是否流式和会话
+func (e *Entry) SetRequest(model string, stream bool, session string) {
+	if e == nil {
+		return
+	}
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+	e.request.RequestedModel, e.request.Stream, e.request.Session = model, stream, session
+}
+
+// AddAttempt 记录一次上游尝试，错误信息可能包含上游地址等敏感信息，记录前脱敏
+func (e *Entry) AddAttempt(attempt Attempt) {
+	if e == nil {
+		return
+	}
+	attempt.Error = logger.Redact(attempt.Error)
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+	e.request.Attempts = append(e.request.Attempts, attempt)
+}
+
+// MarkOverloaded 将最近一次尝试标记为限流或过载
+func (e *Entry) MarkOverloaded() {
+	if e == nil {
+		return
+	}
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+	if n := len(e.request.Attempts); n > 0 {
+		e.request.Attempts[n-1].Overloaded = true
+	}
+}
+
+// SetServed 记录实际服务的 provider、模型和上游请求ID
+func (e *Entry) SetServed(provider, model, upstreamRequestID string) {
+	if e == nil {
+		return
+	}
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+	e.request.Provider, e.request.ServedModel, e.request.UpstreamRequestID = provider, model, upstreamRequestID
+}
+
+// SetTTFT 记录流式响应收到第一个 content_block_delta 的耗时
+func (e *Entry) SetTTFT(ttft time.Duration) {
+	if e == nil {
+		return
+	}
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+	e.request.TTFTMS = ttft.Milliseconds()
+}
+
+// SetUsage 记录 token 用量
+func (e *Entry) SetUsage(u usage.Usage) {
+	if e == nil {
+		return
+	}
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+	e.request.Usage = u
+}
+
+// Finish 结束记录，status 为返回给客户端的状态码，errorBody 为错误响应体（成功时为空）
+func (e *Entry) Finish(status int, errorBody []byte) {
+	if e == nil {
+		return
+	}
+	// 先脱敏再截断，避免密钥被截断后不再匹配脱敏规则
+	redacted := logger.Redact(string(errorBody))
+	if len(redacted) > ErrorBodyLimit {
+		redacted = redacted[:ErrorBodyLimit] + "..."
+	}
+
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+	now := time.Now()
+	e.request.FinishedAt = &now
+	e.request.DurationMS = now.Sub(e.request.StartedAt).Milliseconds()
+	e.request.Status = status
+	e.request.ErrorBody = redacted
+}
+
+// snapshot 返回记录的副本，调用方需持有锁；仍在处理的请求按当前时间计算耗时
+func (e *Entry) snapshot() Request {
+	request := e.request
+	request.Attempts = append([]Attempt{}, e.request.Attempts...)
+	if request.FinishedAt == nil {
+		request.DurationMS = time.Since(request.StartedAt).Milliseconds()
+	}
+	return request
+}
+
+// List 返回最近的 limit 个请求，最新的在前，limit 不大于 0 时返回全部
+func List(limit int) []Request {
+	global.mutex.RLock()
+	defer global.mutex.RUnlock()
+
+	if limit <= 0 {
+		limit = global.count
+	}
+	requests := []Request{}
+	for _, e := range recentLocked(limit) {
+		requests = append(requests, e.snapshot())
+	}
+	return requests
+}
+
+// Get 按代理请求ID或上游请求ID查找请求
+func Get(id string) (Request, bool) {
+	global.mutex.RLock()
+	defer global.mutex.RUnlock()
+
+	for _, e := range recentLocked(global.count) {
+		if e.request.ID == id || (e.request.UpstreamRequestID != "" && e.request.UpstreamRequestID == id) {
+			return e.snapshot(), true
+		}
+	}
+	return Request{}, false
+}
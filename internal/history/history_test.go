@@ -0,0 +1,77 @@
+package history
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/usage"
+)
+
+func TestRing(t *testing.T) {
+	Configure(3)
+	defer Configure(0)
+
+	start := time.Now()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		e := Begin(id, start, "test")
+		e.AddAttempt(Attempt{Provider: "p1", Model: "m", Status: 529})
+		e.MarkOverloaded()
+		e.AddAttempt(Attempt{Provider: "p2", Model: "m", Status: 200})
+		e.SetServed("p2", "m", "req_"+id)
+		e.SetUsage(usage.Usage{InputTokens: 1, OutputTokens: 2})
+		if id != "d" {
+			e.Finish(200, nil)
+		}
+	}
+
+	list := List(0)
+	if len(list) != 3 || list[0].ID != "d" || list[2].ID != "b" {
+		t.Fatalf("List = %+v", list)
+	}
+	if list[0].FinishedAt != nil || list[1].FinishedAt == nil {
+		t.Errorf("finished_at: d = %v, c = %v", list[0].FinishedAt, list[1].FinishedAt)
+	}
+	if got := list[1].Attempts; len(got) != 2 || !got[0].Overloaded || got[1].Overloaded {
+		t.Errorf("attempts = %+v", got)
+	}
+	if _, ok := Get("a"); ok {
+		t.Error("evicted request a still found")
+	}
+	if r, ok := Get("req_c"); !ok || r.ID != "c" {
+		t.Errorf("Get by upstream id = %+v, %v", r, ok)
+	}
+
+	// 缩小容量时保留最近的记录
+	Configure(2)
+	if list := List(0); len(list) != 2 || list[0].ID != "d" || list[1].ID != "c" {
+		t.Errorf("after resize = %+v", list)
+	}
+	Begin("e", start, "").Finish(502, []byte(strings.Repeat("x", ErrorBodyLimit+10)))
+	if r, _ := Get("e"); r.Status != 502 || len(r.ErrorBody) != ErrorBodyLimit+3 {
+		t.Errorf("error body length = %d", len(r.ErrorBody))
+	}
+
+	// 尝试的错误信息和错误响应体都会脱敏，截断位置上的密钥也不会残留
+	secret := "sk-ant-REDACTED"
+	h := Begin("h", start, "")
+	h.AddAttempt(Attempt{Provider: "p1", Error: "修改请求体失败: Post \"https://upstream/v1/messages?key=" + secret + "\""})
+	h.Finish(502, []byte(strings.Repeat("x", ErrorBodyLimit-10)+secret))
+	if r, _ := Get("h"); strings.Contains(r.Attempts[0].Error, "abcdefgh") || strings.Contains(r.ErrorBody, "sk-ant") {
+		t.Errorf("not redacted: attempt error = %q, error body = %q", r.Attempts[0].Error, r.ErrorBody)
+	}
+
+	// 没有上游尝试的请求（如本地拒绝）输出空数组而不是 null
+	Begin("g", start, "").Finish(402, nil)
+	r, _ := Get("g")
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil || !strings.Contains(string(data), `"attempts": []`) {
+		t.Errorf("request without attempts = %s, %v", data, err)
+	}
+
+	Configure(0)
+	if Begin("f", start, "") != nil || len(List(0)) != 0 {
+		t.Error("recording should be disabled")
+	}
+}
@@ -0,0 +1,240 @@
+package llm_proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+
+	"github.com/imty42/claude-code-env/internal/config"
+)
+
+// applyImagePolicy 按 provider 的图片策略处理请求中的图片块，返回是否修改了请求体以及修改的图片数
+// messages 会被深拷贝后替换，不影响原始请求体（同一请求可能依次发往多个 provider）
+func applyImagePolicy(body map[string]interface{}, policy *config.ImagePolicy) (bool, int) {
+	if policy == nil || policy.Mode == "pass" || !containsImage(body["messages"]) {
+		return false, 0
+	}
+
+	messages := deepCopyJSON(body["messages"])
+	modified := processImageBlocks(messages, func(block map[string]interface{}) (map[string]interface{}, bool) {
+		if policy.Mode == "strip" {
+			return imagePlaceholder(block, "当前模型不支持图片输入"), true
+		}
+		return downscaleImageBlock(block, policy)
+	})
+	if modified == 0 {
+		return false, 0
+	}
+	body["messages"] = messages
+
+	return true, modified
+}
+
+// processImageBlocks 递归遍历内容，用 replace 的返回值替换每个图片块（包括 tool_result 中嵌套的图片）
+// replace 返回是否修改了图片块，函数返回修改的图片块数
+func processImageBlocks(value interface{}, replace func(map[string]interface{}) (map[string]interface{}, bool)) int {
+	modified := 0
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if block, ok := child.(map[string]interface{}); ok && isImageBlock(block) {
+				if replaced, changed := replace(block); changed {
+					v[key] = replaced
+					modified++
+				}
+				continue
+			}
+			modified += processImageBlocks(child, replace)
+		}
+	case []interface{}:
+		for i, child := range v {
+			if block, ok := child.(map[string]interface{}); ok && isImageBlock(block) {
+				if replaced, changed := replace(block); changed {
+					v[i] = replaced
+					modified++
+				}
+				continue
+			}
+			modified += processImageBlocks(child, replace)
+		}
+	}
+	return modified
+}
+
+// isImageBlock 判断是否为图片内容块
+func isImageBlock(block map[string]interface{}) bool {
+	blockType, _ := block["type"].(string)
+	return blockType == "image"
+}
+
+// maxDecodePixels 允许解码缩放的最大像素数，防止体积很小但尺寸巨大的图片（解压炸弹）耗尽内存
+const maxDecodePixels = 40 * 1000 * 1000
+
+// downscaleImageBlock 将超过尺寸或大小限制的 base64 图片缩放并重新编码，无法处理时替换为文本占位
+// 缩放时直接修改 source，保留 cache_control 等其他字段，返回处理后的块以及是否修改
+func downscaleImageBlock(block map[string]interface{}, policy *config.ImagePolicy) (map[string]interface{}, bool) {
+	source, _ := block["source"].(map[string]interface{})
+	sourceType, _ := source["type"].(string)
+	if sourceType != "base64" {
+		// URL 等其他来源的图片无法在代理中处理，原样透传
+		return block, false
+	}
+
+	encoded, _ := source["data"].(string)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return imagePlaceholder(block, "图片数据无法解码"), true
+	}
+
+	// 先只读取图片头获取尺寸，符合限制时无需完整解码
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// 无法解码的格式（如 WebP）在大小符合限制时原样透传
+		if len(data) <= policy.MaxBytes {
+			return block, false
+		}
+		return imagePlaceholder(block, "图片格式不支持缩放且超过大小限制"), true
+	}
+	if len(data) <= policy.MaxBytes && imageConfig.Width <= policy.MaxDimension && imageConfig.Height <= policy.MaxDimension {
+		return block, false
+	}
+	if imageConfig.Width*imageConfig.Height > maxDecodePixels {
+		return imagePlaceholder(block, fmt.Sprintf("图片尺寸 %dx%d 过大，无法缩放", imageConfig.Width, imageConfig.Height)), true
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return imagePlaceholder(block, "图片数据无法解码"), true
+	}
+
+	// 逐步缩小尺寸直到满足大小限制
+	bounds := img.Bounds()
+	width, height := fitDimensions(bounds.Dx(), bounds.Dy(), policy.MaxDimension)
+	for width >= 16 && height >= 16 {
+		encodedImage, mediaType, err := encodeImage(resizeImage(img, width, height), policy.MaxBytes)
+		if err == nil {
+			source["media_type"] = mediaType
+			source["data"] = base64.StdEncoding.EncodeToString(encodedImage)
+			return block, true
+		}
+		width, height = width/2, height/2
+	}
+
+	return imagePlaceholder(block, "图片缩放后仍超过大小限制"), true
+}
+
+// fitDimensions 计算等比缩放到最大边长以内的尺寸
+func fitDimensions(width, height, maxDimension int) (int, int) {
+	if width <= maxDimension && height <= maxDimension {
+		return width, height
+	}
+	if width >= height {
+		return maxDimension, max(1, height*maxDimension/width)
+	}
+	return max(1, width*maxDimension/height), maxDimension
+}
+
+// resizeImage 使用区域平均算法缩放图片
+func resizeImage(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy0 := bounds.Min.Y + y*srcHeight/height
+		sy1 := max(bounds.Min.Y+(y+1)*srcHeight/height, sy0+1)
+		for x := 0; x < width; x++ {
+			sx0 := bounds.Min.X + x*srcWidth/width
+			sx1 := max(bounds.Min.X+(x+1)*srcWidth/width, sx0+1)
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+
+	return dst
+}
+
+// encodeImage 将图片编码为不超过 maxBytes 的 JPEG（透明图片优先尝试 PNG），逐步降低 JPEG 质量
+func encodeImage(img *image.RGBA, maxBytes int) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if !img.Opaque() {
+		if err := png.Encode(&buf, img); err == nil && buf.Len() <= maxBytes {
+			return buf.Bytes(), "image/png", nil
+		}
+	}
+
+	// JPEG 不支持透明通道，先合成到白色背景上
+	flattened := image.NewRGBA(img.Bounds())
+	draw.Draw(flattened, flattened.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flattened, flattened.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	for _, quality := range []int{85, 70, 55} {
+		buf.Reset()
+		if err := jpeg.Encode(&buf, flattened, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", err
+		}
+		if buf.Len() <= maxBytes {
+			return buf.Bytes(), "image/jpeg", nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("编码后 %d 字节，超过限制 %d 字节", buf.Len(), maxBytes)
+}
+
+// imagePlaceholder 生成替换图片的文本占位块，说明图片已被移除
+func imagePlaceholder(block map[string]interface{}, reason string) map[string]interface{} {
+	description := "图片"
+	if source, ok := block["source"].(map[string]interface{}); ok {
+		if mediaType, _ := source["media_type"].(string); mediaType != "" {
+			description = mediaType
+		}
+		if data, _ := source["data"].(string); data != "" {
+			description += fmt.Sprintf(", 约 %d KB", base64.StdEncoding.DecodedLen(len(data))/1024)
+		}
+	}
+
+	placeholder := map[string]interface{}{
+		"type": "text",
+		"text": fmt.Sprintf("[此处的图片已被 ccenv 代理移除（%s）：%s。如需图片内容，请让用户改用文字描述。]", description, reason),
+	}
+	// 保留缓存断点，避免改变客户端的 prompt 缓存布局
+	if cacheControl, ok := block["cache_control"]; ok {
+		placeholder["cache_control"] = cacheControl
+	}
+	return placeholder
+}
+
+// deepCopyJSON 深拷贝 JSON 解析得到的数据结构
+func deepCopyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			copied[key] = deepCopyJSON(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, child := range v {
+			copied[i] = deepCopyJSON(child)
+		}
+		return copied
+	default:
+		return v
+	}
+}
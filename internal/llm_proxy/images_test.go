@@ -0,0 +1,115 @@
+package llm_proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/imty42/claude-code-env/internal/config"
+)
+
+// pngBase64 生成指定尺寸的纯色 PNG 图片的 base64 数据
+func pngBase64(t *testing.T, width, height int) string {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// imageRequest 构造包含一个带缓存断点的图片块的请求体
+func imageRequest(data string) map[string]interface{} {
+	return map[string]interface{}{
+		"messages": []interface{}{
+			map[string]interface{}{
+				"role": "user",
+				"content": []interface{}{
+					map[string]interface{}{
+						"type":          "image",
+						"source":        map[string]interface{}{"type": "base64", "media_type": "image/png", "data": data},
+						"cache_control": map[string]interface{}{"type": "ephemeral"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// firstBlock 返回请求体中第一条消息的第一个内容块
+func firstBlock(body map[string]interface{}) map[string]interface{} {
+	message := body["messages"].([]interface{})[0].(map[string]interface{})
+	return message["content"].([]interface{})[0].(map[string]interface{})
+}
+
+func TestApplyImagePolicyDownscale(t *testing.T) {
+	policy := &config.ImagePolicy{Mode: "downscale", MaxDimension: 100, MaxBytes: 1 << 20}
+	original := pngBase64(t, 400, 200)
+	body := imageRequest(original)
+
+	changed, count := applyImagePolicy(body, policy)
+	if !changed || count != 1 {
+		t.Fatalf("changed = %v, count = %d", changed, count)
+	}
+
+	block := firstBlock(body)
+	if _, ok := block["cache_control"]; !ok {
+		t.Error("cache_control dropped after downscale")
+	}
+	source := block["source"].(map[string]interface{})
+	data, err := base64.StdEncoding.DecodeString(source["data"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 100 || cfg.Height != 50 {
+		t.Errorf("downscaled to %dx%d, want 100x50", cfg.Width, cfg.Height)
+	}
+
+	if source["data"] == original {
+		t.Error("image data not replaced")
+	}
+}
+
+func TestApplyImagePolicyPassthrough(t *testing.T) {
+	policy := &config.ImagePolicy{Mode: "downscale", MaxDimension: 1000, MaxBytes: 1 << 20}
+	body := imageRequest(pngBase64(t, 64, 64))
+	messages := body["messages"]
+
+	if changed, count := applyImagePolicy(body, policy); changed || count != 0 {
+		t.Errorf("small image: changed = %v, count = %d", changed, count)
+	}
+	if &body["messages"].([]interface{})[0] != &messages.([]interface{})[0] {
+		t.Error("messages replaced although no image was modified")
+	}
+
+	if changed, _ := applyImagePolicy(body, &config.ImagePolicy{Mode: "pass"}); changed {
+		t.Error("pass mode modified the request")
+	}
+}
+
+func TestApplyImagePolicyStrip(t *testing.T) {
+	body := imageRequest(pngBase64(t, 64, 64))
+
+	if changed, count := applyImagePolicy(body, &config.ImagePolicy{Mode: "strip"}); !changed || count != 1 {
+		t.Fatalf("changed = %v, count = %d", changed, count)
+	}
+	block := firstBlock(body)
+	if block["type"] != "text" {
+		t.Errorf("block type = %v, want text", block["type"])
+	}
+	if _, ok := block["cache_control"]; !ok {
+		t.Error("cache_control dropped after strip")
+	}
+}
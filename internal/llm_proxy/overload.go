@@ -0,0 +1,45 @@
+package llm_proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// servedModelHeader 返回给客户端的实际服务模型响应头
+const servedModelHeader = "x-ccenv-served-model"
+
+// maxErrorBodySize 判断过载时读取的错误响应体上限
+const maxErrorBodySize = 1 << 20
+
+// isOverloaded 判断上游响应是否为限流或过载：429、529，或错误类型为 rate_limit_error / overloaded_error
+// 对错误响应会读取并缓存响应体（抓包随之记录被跳过的响应体），之后仍可正常复制给客户端
+func isOverloaded(resp *http.Response) bool {
+	if resp.StatusCode < 400 {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == 529 {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+
+	var errorResp AnthropicErrorResponse
+	if json.Unmarshal(body, &errorResp) != nil {
+		return false
+	}
+	return errorResp.Error.Type == "overloaded_error" || errorResp.Error.Type == "rate_limit_error"
+}
+
+// closeResponse 关闭不再使用的响应
+func closeResponse(resp *http.Response) {
+	if resp != nil {
+		resp.Body.Close()
+	}
+}
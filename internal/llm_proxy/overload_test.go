@@ -0,0 +1,90 @@
+package llm_proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/provider"
+)
+
+func TestIsOverloaded(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   bool
+	}{
+		{"ok", 200, `{"type":"message"}`, false},
+		{"rate limited", 429, ``, true},
+		{"overloaded status", 529, ``, true},
+		{"overloaded error type", 503, `{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`, true},
+		{"rate limit error type", 400, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`, true},
+		{"invalid request", 400, `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`, false},
+		{"server error", 500, `upstream crashed`, false},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+		if got := isOverloaded(resp); got != tt.want {
+			t.Errorf("%s: isOverloaded = %v, want %v", tt.name, got, tt.want)
+		}
+		// 判断后响应体仍可完整读取，用于返回给客户端
+		if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+			t.Errorf("%s: body after check = %q", tt.name, body)
+		}
+	}
+}
+
+func TestHandleMessagesFallbackAndDowngrade(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// 只有 a-small 正常响应，其他上游模型均过载
+	var attempts []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		model, _ := body["model"].(string)
+		attempts = append(attempts, model)
+
+		w.Header().Set("Content-Type", "application/json")
+		if model != "a-small" {
+			w.WriteHeader(529)
+			io.WriteString(w, `{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`)
+			return
+		}
+		io.WriteString(w, `{"model":"a-small","stop_reason":"end_turn","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`)
+	}))
+	defer upstream.Close()
+
+	env := func(model string) map[string]string {
+		return map[string]string{"ANTHROPIC_BASE_URL": upstream.URL, "ANTHROPIC_AUTH_TOKEN": "token", "ANTHROPIC_MODEL": model}
+	}
+	cfg := &config.Config{
+		Providers: []config.Provider{
+			{Name: "a", State: "on", Env: env("a-large"), FallbackModels: []string{"a-medium"}},
+			{Name: "b", State: "on", Env: env("b-large")},
+		},
+		Routing: config.Routing{Downgrade: []config.DowngradeStep{
+			{From: "claude-opus-*", To: "claude-sonnet-4-20250514", Models: map[string]string{"a": "a-small"}},
+		}},
+	}
+	cfg.SetDefaults()
+	s := NewLLMProxyServer(provider.NewProviderManager(cfg), cfg)
+
+	r := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model":"claude-opus-4-20250514","max_tokens":16,"messages":[{"role":"user","content":"ping"}]}`))
+	w := httptest.NewRecorder()
+	s.ServeMessages(w, r)
+
+	// 先尝试 a 的备用模型，再尝试 b，降级后 b 没有指定模型被跳过，a 使用降级步骤指定的模型
+	if got := strings.Join(attempts, ","); got != "a-large,a-medium,b-large,a-small" {
+		t.Errorf("upstream attempts = %s", got)
+	}
+	if w.Code != http.StatusOK || w.Header().Get(servedModelHeader) != "a-small" {
+		t.Errorf("status = %d, served model = %q, body = %s", w.Code, w.Header().Get(servedModelHeader), w.Body)
+	}
+}
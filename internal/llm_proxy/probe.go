@@ -0,0 +1,350 @@
+package llm_proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/usage"
+)
+
+const (
+	// DefaultProbeModel 未指定模型时测试请求使用的模型，provider 配置了 ANTHROPIC_MODEL 时与真实请求一样被映射
+	DefaultProbeModel = "claude-sonnet-4-20250514"
+	// probeMaxTokens 测试请求的 max_tokens，只需要很少的输出
+	probeMaxTokens = 16
+	// probeBodyLimit 错误响应体最多保留的字节数
+	probeBodyLimit = 4096
+)
+
+// ProbeOptions 连通性测试的参数
+type ProbeOptions struct {
+	Model  string // 请求的模型，为空时使用 DefaultProbeModel
+	Stream bool   // 是否使用流式响应
+}
+
+// ProbeResult 连通性测试的结果，耗时单位为毫秒，均从开始发送请求计算
+// 配置了 API_PROXY 时 DNS 和连接耗时对应代理服务器
+type ProbeResult struct {
+	Provider          string      `json:"provider"`
+	Stream            bool        `json:"stream"`
+	RequestID         string      `json:"request_id"`
+	URL               string      `json:"url"`
+	Proxy             string      `json:"proxy,omitempty"`
+	RequestedModel    string      `json:"requested_model"`
+	Model             string      `json:"model"`                  // 映射后发送给上游的模型
+	ServedModel       string      `json:"served_model,omitempty"` // 响应中的模型
+	RemoteAddr        string      `json:"remote_addr,omitempty"`
+	TLSVersion        string      `json:"tls_version,omitempty"`
+	DNSMS             float64     `json:"dns_ms,omitempty"`
+	ConnectMS         float64     `json:"connect_ms,omitempty"`
+	TLSMS             float64     `json:"tls_ms,omitempty"`
+	HeadersMS         float64     `json:"headers_ms,omitempty"` // 收到响应头
+	TTFTMS            float64     `json:"ttft_ms,omitempty"`    // 收到第一个 content_block_delta
+	TotalMS           float64     `json:"total_ms"`
+	Status            int         `json:"status,omitempty"`
+	UpstreamRequestID string      `json:"upstream_request_id,omitempty"`
+	StopReason        string      `json:"stop_reason,omitempty"`
+	Reply             string      `json:"reply,omitempty"`
+	Usage             usage.Usage `json:"usage"`
+	Error             string      `json:"error,omitempty"`
+	ErrorBody         string      `json:"error_body,omitempty"`
+}
+
+// OK 测试是否成功
+func (r *ProbeResult) OK() bool {
+	return r.Error == ""
+}
+
+// probeTimings 通过 httptrace 记录的连接过程，回调可能并发执行
+type probeTimings struct {
+	start                    time.Time
+	dnsStart, dnsDone        time.Time
+	connectStart, connectEnd time.Time
+	tlsStart, tlsDone        time.Time
+	firstByte                time.Time
+	remoteAddr               string
+	tlsVersion               uint16
+	mutex                    sync.Mutex
+}
+
+// clientTrace 返回记录各阶段时间的 httptrace 回调
+func (t *probeTimings) clientTrace() *httptrace.ClientTrace {
+	record := func(at *time.Time) {
+		t.mutex.Lock()
+		if at.IsZero() {
+			*at = time.Now()
+		}
+		t.mutex.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { record(&t.dnsStart) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { record(&t.dnsDone) },
+		ConnectStart: func(string, string) { record(&t.connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				record(&t.connectEnd)
+			}
+		},
+		TLSHandshakeStart: func() { record(&t.tlsStart) },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				record(&t.tlsDone)
+				t.mutex.Lock()
+				t.tlsVersion = state.Version
+				t.mutex.Unlock()
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mutex.Lock()
+			t.remoteAddr = info.Conn.RemoteAddr().String()
+			t.mutex.Unlock()
+		},
+		GotFirstResponseByte: func() { record(&t.firstByte) },
+	}
+}
+
+// fill 将连接过程的耗时写入测试结果
+func (t *probeTimings) fill(result *ProbeResult) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result.RemoteAddr = t.remoteAddr
+	if t.tlsVersion != 0 {
+		result.TLSVersion = tls.VersionName(t.tlsVersion)
+	}
+	result.DNSMS = between(t.dnsStart, t.dnsDone)
+	result.ConnectMS = between(t.connectStart, t.connectEnd)
+	result.TLSMS = between(t.tlsStart, t.tlsDone)
+	result.HeadersMS = between(t.start, t.firstByte)
+}
+
+// between 返回两个时间点之间的毫秒数，任一时间点未记录时返回 0
+func between(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return milliseconds(to.Sub(from))
+}
+
+// milliseconds 将耗时转换为毫秒，保留 1 位小数
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()/100) / 10
+}
+
+// Probe 绕过路由，向指定 provider 发送一个最小的 /v1/messages 请求并报告各阶段耗时、状态码、实际模型、token 用量和错误响应
+// 请求经过与真实请求相同的请求体改写（模型映射、max_tokens 限制、system 注入）和请求头规则，使用相同的代理和超时设置
+// 为了测量 DNS、连接和 TLS 耗时，每次测试都建立新的连接；测试结果不计入 provider 的失败次数和监控指标，token 用量计入预算
+// provider 不存在时返回错误，请求失败记录在结果的 Error 中
+func (s *LLMProxyServer) Probe(ctx context.Context, providerName string, opts ProbeOptions) (*ProbeResult, error) {
+	providerState, exists := s.providerManager.LookupProvider(providerName)
+	if !exists {
+		return nil, fmt.Errorf("provider %s 不存在", providerName)
+	}
+
+	requestedModel := opts.Model
+	if requestedModel == "" {
+		requestedModel = DefaultProbeModel
+	}
+	result := &ProbeResult{
+		Provider:       providerName,
+		Stream:         opts.Stream,
+		RequestID:      logger.GenerateRequestID(),
+		RequestedModel: requestedModel,
+		Model:          providerState.Provider.TargetModel(requestedModel),
+	}
+
+	requestBody := map[string]interface{}{
+		"model":      requestedModel,
+		"max_tokens": probeMaxTokens,
+		"messages": []interface{}{
+			map[string]interface{}{"role": "user", "content": "Reply with the single word: pong"},
+		},
+	}
+	if opts.Stream {
+		requestBody["stream"] = true
+	}
+	bodyBytes, _ := json.Marshal(requestBody)
+	body, err := s.rewriteRequestBody(bodyBytes, requestBody, providerState, result.Model, result.RequestID)
+	if err != nil {
+		result.Error = logger.Redact(err.Error())
+		return result, nil
+	}
+
+	// 模拟 Claude Code 发出的请求头
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Anthropic-Version", "2023-06-01")
+	header.Set("User-Agent", "ccenv-test")
+	req, err := s.newMessagesRequest(header, providerState, body, result.RequestID)
+	if err != nil {
+		result.Error = logger.Redact(err.Error())
+		return result, nil
+	}
+	// 上游地址中可能包含密钥（如 URL 参数），与错误信息一样脱敏后返回
+	result.URL = logger.Redact(req.URL.String())
+
+	// 复制代理使用的 Transport（代理、TLS 设置），使用独立的连接池保证建立新连接
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if t, ok := s.httpClient.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+	}
+	transport.DisableKeepAlives = true
+	defer transport.CloseIdleConnections()
+	if transport.Proxy != nil {
+		if proxyURL, err := transport.Proxy(req); err == nil && proxyURL != nil {
+			result.Proxy = proxyURL.Redacted()
+		}
+	}
+	client := &http.Client{Transport: transport, Timeout: s.httpClient.Timeout}
+
+	timings := &probeTimings{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, timings.clientTrace()))
+	resp, err := client.Do(req)
+	if err != nil {
+		timings.fill(result)
+		result.TotalMS = milliseconds(time.Since(timings.start))
+		result.Error = logger.Redact(err.Error())
+		logProbe(result)
+		return result, nil
+	}
+	defer resp.Body.Close()
+
+	result.Status = resp.StatusCode
+	result.UpstreamRequestID = upstreamRequestID(resp)
+	switch {
+	case resp.StatusCode >= 400:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+		result.Error = resp.Status
+		result.ErrorBody = logger.Redact(string(data))
+	case isEventStream(resp):
+		readProbeStream(resp.Body, timings.start, result)
+	default:
+		readProbeMessage(resp.Body, result)
+	}
+	timings.fill(result)
+	result.TotalMS = milliseconds(time.Since(timings.start))
+
+	if !result.Usage.IsZero() {
+		s.providerManager.RecordUsage(providerName, result.Usage)
+	}
+	logProbe(result)
+	return result, nil
+}
+
+// readProbeMessage 解析非流式响应
+func readProbeMessage(body io.Reader, result *ProbeResult) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		result.Error = logger.Redact(fmt.Sprintf("读取响应失败: %v", err))
+		return
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		result.Error = fmt.Sprintf("解析响应失败: %v", err)
+		result.ErrorBody = logger.Redact(truncate(string(data), probeBodyLimit))
+		return
+	}
+	applyProbeMessage(message, result)
+}
+
+// readProbeStream 解析流式响应，记录收到第一个 content_block_delta 的耗时（TTFT），与代理统计的 TTFT 口径一致
+func readProbeStream(body io.Reader, start time.Time, result *ProbeResult) {
+	reader := bufio.NewReader(body)
+	var reply strings.Builder
+	for {
+		line, err := reader.ReadBytes('\n')
+		if payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+			var event map[string]interface{}
+			if json.Unmarshal(bytes.TrimSpace(payload), &event) == nil {
+				switch event["type"] {
+				case "message_start":
+					if message, ok := event["message"].(map[string]interface{}); ok {
+						applyProbeMessage(message, result)
+					}
+				case "content_block_delta":
+					if result.TTFTMS == 0 {
+						result.TTFTMS = milliseconds(time.Since(start))
+					}
+					if delta, ok := event["delta"].(map[string]interface{}); ok {
+						text, _ := delta["text"].(string)
+						reply.WriteString(text)
+					}
+				case "message_delta":
+					if delta, ok := event["delta"].(map[string]interface{}); ok {
+						if stopReason, ok := delta["stop_reason"].(string); ok {
+							result.StopReason = stopReason
+						}
+					}
+					if fields, ok := event["usage"].(map[string]interface{}); ok {
+						result.Usage.Merge(fields)
+					}
+				case "error":
+					data, _ := json.Marshal(event)
+					result.Error = "流式响应返回错误事件"
+					result.ErrorBody = logger.Redact(truncate(string(data), probeBodyLimit))
+				}
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				result.Error = logger.Redact(fmt.Sprintf("读取流式响应失败: %v", err))
+			}
+			break
+		}
+	}
+	if reply.Len() > 0 {
+		result.Reply = reply.String()
+	}
+}
+
+// applyProbeMessage 从 message 对象中提取模型、回复、stop_reason 和 token 用量
+func applyProbeMessage(message map[string]interface{}, result *ProbeResult) {
+	if model, ok := message["model"].(string); ok {
+		result.ServedModel = model
+	}
+	if stopReason, ok := message["stop_reason"].(string); ok {
+		result.StopReason = stopReason
+	}
+	if fields, ok := message["usage"].(map[string]interface{}); ok {
+		result.Usage.Merge(fields)
+	}
+	if content, ok := message["content"].([]interface{}); ok {
+		var reply strings.Builder
+		for _, block := range content {
+			if block, ok := block.(map[string]interface{}); ok {
+				text, _ := block["text"].(string)
+				reply.WriteString(text)
+			}
+		}
+		result.Reply = reply.String()
+	}
+}
+
+// truncate 截断过长的内容
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "..."
+}
+
+// logProbe 记录测试结果
+func logProbe(result *ProbeResult) {
+	fields := logger.Fields{RequestID: result.RequestID, Provider: result.Provider, Model: result.Model, Status: result.Status}
+	if result.OK() {
+		logger.InfoWithFields(logger.ModuleProxy, fields, "连通性测试成功 (stream=%v): 耗时 %.0fms", result.Stream, result.TotalMS)
+	} else {
+		logger.WarnWithFields(logger.ModuleProxy, fields, "连通性测试失败 (stream=%v): %s", result.Stream, result.Error)
+	}
+}
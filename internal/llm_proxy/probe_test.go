@@ -0,0 +1,112 @@
+package llm_proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/provider"
+)
+
+func TestProbe(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var requests []map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":{"message":"invalid token secret"}}`)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+
+		w.Header().Set("request-id", "req_upstream")
+		if body["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"glm-4.6\",\"usage\":{\"input_tokens\":12}}}\n\n"+
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"po\"}}\n\n"+
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"ng\"}}\n\n"+
+				"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":2}}\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"glm-4.6","stop_reason":"end_turn","content":[{"type":"text","text":"pong"}],"usage":{"input_tokens":12,"output_tokens":2}}`)
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{Providers: []config.Provider{
+		{Name: "ok", State: "on", Env: map[string]string{"ANTHROPIC_BASE_URL": upstream.URL, "ANTHROPIC_AUTH_TOKEN": "secret", "ANTHROPIC_MODEL": "glm-4.6"}},
+		{Name: "bad", State: "off", Env: map[string]string{"ANTHROPIC_BASE_URL": upstream.URL, "ANTHROPIC_AUTH_TOKEN": "wrong"}},
+		{Name: "down", State: "off", Env: map[string]string{"ANTHROPIC_BASE_URL": "http://127.0.0.1:1/api_key=topsecret123", "ANTHROPIC_AUTH_TOKEN": "wrong"}},
+	}}
+	cfg.SetDefaults()
+	s := NewLLMProxyServer(provider.NewProviderManager(cfg), cfg)
+
+	for _, stream := range []bool{false, true} {
+		result, err := s.Probe(context.Background(), "ok", ProbeOptions{Stream: stream})
+		if err != nil {
+			t.Fatalf("Probe(stream=%v): %v", stream, err)
+		}
+		if !result.OK() || result.Status != http.StatusOK || result.Reply != "pong" || result.StopReason != "end_turn" {
+			t.Errorf("stream=%v: result = %+v", stream, result)
+		}
+		if result.Model != "glm-4.6" || result.ServedModel != "glm-4.6" || result.UpstreamRequestID != "req_upstream" {
+			t.Errorf("stream=%v: model = %q, served = %q, upstream id = %q", stream, result.Model, result.ServedModel, result.UpstreamRequestID)
+		}
+		if result.Usage.InputTokens != 12 || result.Usage.OutputTokens != 2 {
+			t.Errorf("stream=%v: usage = %+v", stream, result.Usage)
+		}
+		if stream && result.TTFTMS == 0 {
+			t.Errorf("stream=%v: TTFT not recorded", stream)
+		}
+	}
+	if len(requests) != 2 || requests[0]["model"] != "glm-4.6" {
+		t.Errorf("upstream requests = %v", requests)
+	}
+
+	// 禁用的 provider 也可以测试，错误响应体脱敏后返回
+	result, err := s.Probe(context.Background(), "bad", ProbeOptions{})
+	if err != nil {
+		t.Fatalf("Probe(bad): %v", err)
+	}
+	if result.OK() || result.Status != http.StatusUnauthorized || !strings.Contains(result.ErrorBody, "invalid token") {
+		t.Errorf("bad: result = %+v", result)
+	}
+
+	// 连接失败时错误信息中的上游地址同样脱敏
+	result, err = s.Probe(context.Background(), "down", ProbeOptions{})
+	if err != nil {
+		t.Fatalf("Probe(down): %v", err)
+	}
+	if result.OK() || result.Error == "" || strings.Contains(result.Error, "topsecret123") || strings.Contains(result.URL, "topsecret123") {
+		t.Errorf("down: url = %q, error = %q", result.URL, result.Error)
+	}
+
+	if _, err := s.Probe(context.Background(), "missing", ProbeOptions{}); err == nil {
+		t.Error("Probe(missing) should fail")
+	}
+}
+
+func TestReadProbeStreamTTFT(t *testing.T) {
+	// TTFT 从第一个 content_block_delta 开始计算，message_start 和 ping 不计入
+	var result ProbeResult
+	readProbeStream(strings.NewReader("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{}}\n\n"+
+		"event: ping\ndata: {\"type\":\"ping\"}\n\n"), time.Now(), &result)
+	if result.TTFTMS != 0 {
+		t.Errorf("TTFT = %v before any content_block_delta, want 0", result.TTFTMS)
+	}
+
+	start := time.Now().Add(-time.Second)
+	readProbeStream(strings.NewReader("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"po\"}}\n\n"), start, &result)
+	if result.TTFTMS < 1000 {
+		t.Errorf("TTFT = %v, want at least 1000ms", result.TTFTMS)
+	}
+}
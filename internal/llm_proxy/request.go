@@ -0,0 +1,256 @@
+package llm_proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/provider"
+)
+
+// imageTokenEstimate 单张图片的估算 token 数
+const imageTokenEstimate = 1600
+
+// buildRequestInfo 从请求体中提取用于路由匹配的请求特征
+func buildRequestInfo(requestBody map[string]interface{}, header http.Header) provider.RequestInfo {
+	info := provider.RequestInfo{Headers: header}
+	if requestBody == nil {
+		return info
+	}
+
+	if model, ok := requestBody["model"].(string); ok {
+		info.Model = model
+	}
+
+	if maxTokens, ok := requestBody["max_tokens"].(float64); ok {
+		info.MaxTokens = int(maxTokens)
+	}
+
+	if tools, ok := requestBody["tools"].([]interface{}); ok && len(tools) > 0 {
+		info.HasTools = true
+	}
+
+	if thinking, ok := requestBody["thinking"].(map[string]interface{}); ok {
+		if thinkingType, _ := thinking["type"].(string); thinkingType == "enabled" {
+			info.Thinking = true
+		}
+	}
+
+	info.HasImages = containsImage(requestBody["messages"])
+	info.EstimatedTokens = estimateTokens(requestBody)
+
+	return info
+}
+
+// PinProviderHeader 管理界面 playground 指定 provider 的请求头，只在 playground 中通过请求上下文生效，代理端口忽略该请求头，也不会转发给上游
+const PinProviderHeader = "X-Ccenv-Provider"
+
+// sessionIDHeader Claude Code 在每个请求中携带的会话 ID 请求头
+const sessionIDHeader = "X-Claude-Code-Session-Id"
+
+// sessionID 获取请求所属的会话：优先使用会话请求头，其次使用 metadata.user_id 中的会话部分
+func sessionID(header http.Header, requestBody map[string]interface{}) string {
+	if session := header.Get(sessionIDHeader); session != "" {
+		return session
+	}
+
+	metadata, _ := requestBody["metadata"].(map[string]interface{})
+	userID, _ := metadata["user_id"].(string)
+	// Claude Code 的 user_id 形如 user_<hash>_account_<uuid>_session_<uuid>
+	if _, session, found := strings.Cut(userID, "_session_"); found {
+		return session
+	}
+	return userID
+}
+
+// containsImage 递归检查内容中是否包含图片块（包括 tool_result 中嵌套的图片）
+func containsImage(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if blockType, _ := v["type"].(string); blockType == "image" {
+			return true
+		}
+		for _, child := range v {
+			if containsImage(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if containsImage(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// estimateTokens 粗略估算请求的输入 token 数
+// ASCII 字符按 4 个字符 1 个 token 计算，其他字符（如中文）按 1 个字符 1 个 token 计算，
+// 图片按固定值计算，不计入 base64 数据长度
+func estimateTokens(requestBody map[string]interface{}) int {
+	var asciiChars, otherChars, images int
+	for _, key := range []string{"system", "messages", "tools"} {
+		countContent(requestBody[key], &asciiChars, &otherChars, &images)
+	}
+	return asciiChars/4 + otherChars + images*imageTokenEstimate
+}
+
+// countContent 递归统计内容中的字符数和图片数
+func countContent(value interface{}, asciiChars, otherChars, images *int) {
+	switch v := value.(type) {
+	case string:
+		for _, r := range v {
+			if r < 128 {
+				*asciiChars++
+			} else {
+				*otherChars++
+			}
+		}
+	case map[string]interface{}:
+		if blockType, _ := v["type"].(string); blockType == "image" {
+			*images++
+			return
+		}
+		for key, child := range v {
+			*asciiChars += len(key)
+			countContent(child, asciiChars, otherChars, images)
+		}
+	case []interface{}:
+		for _, child := range v {
+			countContent(child, asciiChars, otherChars, images)
+		}
+	}
+}
+
+// rewriteRequestBody 按 provider 配置修改请求体：将模型替换为 model（映射、备用或降级后的模型）、限制 max_tokens、注入 system 提示词、处理图片
+// 请求体无需修改时原样返回，保证未配置映射的 provider 收到与客户端完全一致的请求
+func (s *LLMProxyServer) rewriteRequestBody(bodyBytes []byte, requestBody map[string]interface{}, providerState *provider.ProviderState, model, requestID string) ([]byte, error) {
+	providerName := providerState.Provider.Name
+
+	if requestBody == nil {
+		if model != "" {
+			return nil, fmt.Errorf("解析JSON失败，无法映射模型")
+		}
+		return bodyBytes, nil
+	}
+
+	// 浅拷贝顶层字段，避免修改原始请求体
+	body := make(map[string]interface{}, len(requestBody))
+	for key, value := range requestBody {
+		body[key] = value
+	}
+	modified := false
+
+	// 获取原始模型
+	originalModel, _ := body["model"].(string)
+
+	// 替换为目标模型
+	if model != "" && model != originalModel {
+		body["model"] = model
+		modified = true
+		logger.InfoWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerName, Model: model}, "模型映射: %s -> %s", originalModel, model)
+	} else if originalModel != "" {
+		logger.InfoWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerName, Model: originalModel}, "请求模型: %s", originalModel)
+	}
+
+	// 请求的 max_tokens 超过 provider 输出上限时进行限制
+	_, maxOutputTokens := providerState.Provider.LimitsFor(model)
+	if clampMaxTokens(body, maxOutputTokens) {
+		modified = true
+		logger.InfoWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerName, Model: model}, "max_tokens 超过 provider 输出上限，已限制为 %d", maxOutputTokens)
+	}
+
+	// 注入 provider 专属的 system 提示词
+	if injectSystemPrompt(body, providerState.Provider.SystemPrefix, providerState.Provider.SystemSuffix) {
+		modified = true
+		logger.DebugWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerName}, "已注入 system 前缀/后缀")
+	}
+
+	// 按 provider 的图片策略缩放或移除图片
+	if changed, count := applyImagePolicy(body, providerState.Provider.ImagePolicy); changed {
+		modified = true
+		logger.InfoWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerName}, "按图片策略 %s 处理了 %d 张图片", providerState.Provider.ImagePolicy.Mode, count)
+	}
+
+	if !modified {
+		return bodyBytes, nil
+	}
+
+	// 重新序列化
+	modifiedBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("序列化JSON失败: %v", err)
+	}
+
+	return modifiedBytes, nil
+}
+
+// clampMaxTokens 将 max_tokens 限制在输出上限内，同时保证 thinking.budget_tokens 小于 max_tokens
+// 返回是否修改了请求体
+func clampMaxTokens(body map[string]interface{}, maxOutputTokens int) bool {
+	if maxOutputTokens <= 0 {
+		return false
+	}
+
+	maxTokens, ok := body["max_tokens"].(float64)
+	if !ok || int(maxTokens) <= maxOutputTokens {
+		return false
+	}
+	body["max_tokens"] = maxOutputTokens
+
+	// thinking 的预算必须小于 max_tokens
+	if thinking, ok := body["thinking"].(map[string]interface{}); ok {
+		if budget, ok := thinking["budget_tokens"].(float64); ok && int(budget) >= maxOutputTokens {
+			clamped := make(map[string]interface{}, len(thinking))
+			for key, value := range thinking {
+				clamped[key] = value
+			}
+			clamped["budget_tokens"] = maxOutputTokens - 1
+			body["thinking"] = clamped
+		}
+	}
+
+	return true
+}
+
+// injectSystemPrompt 将前缀和后缀合并到 system 字段，兼容字符串和内容块数组两种形式，返回是否修改了请求体
+func injectSystemPrompt(body map[string]interface{}, prefix, suffix string) bool {
+	if prefix == "" && suffix == "" {
+		return false
+	}
+
+	switch system := body["system"].(type) {
+	case []interface{}:
+		// 内容块数组：在首尾分别插入文本块，不改动原有块（保留 cache_control 等字段）
+		blocks := make([]interface{}, 0, len(system)+2)
+		if prefix != "" {
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": prefix})
+		}
+		blocks = append(blocks, system...)
+		if suffix != "" {
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": suffix})
+		}
+		body["system"] = blocks
+	case string:
+		body["system"] = joinNonEmpty(prefix, system, suffix)
+	default:
+		// 未设置 system（或格式无法识别时）直接使用前缀和后缀
+		body["system"] = joinNonEmpty(prefix, suffix)
+	}
+
+	return true
+}
+
+// joinNonEmpty 用空行连接非空文本
+func joinNonEmpty(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
@@ -0,0 +1,48 @@
+package llm_proxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClampMaxTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		limit     int
+		want      bool
+		maxTokens float64
+		budget    float64 // 0 表示请求中没有 thinking
+	}{
+		{"no limit", `{"max_tokens":64000}`, 0, false, 64000, 0},
+		{"within limit", `{"max_tokens":4000}`, 8192, false, 4000, 0},
+		{"equal to limit", `{"max_tokens":8192}`, 8192, false, 8192, 0},
+		{"exceeds limit", `{"max_tokens":64000}`, 8192, true, 8192, 0},
+		{"missing max_tokens", `{}`, 8192, false, 0, 0},
+		{"thinking budget clamped", `{"max_tokens":64000,"thinking":{"type":"enabled","budget_tokens":32000}}`, 8192, true, 8192, 8191},
+		{"thinking budget kept", `{"max_tokens":64000,"thinking":{"type":"enabled","budget_tokens":4000}}`, 8192, true, 8192, 4000},
+	}
+
+	for _, tt := range tests {
+		var body map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := clampMaxTokens(body, tt.limit); got != tt.want {
+			t.Errorf("%s: changed = %v, want %v", tt.name, got, tt.want)
+		}
+
+		// 重新序列化后比较，与发送给上游的请求体一致
+		data, _ := json.Marshal(body)
+		var result struct {
+			MaxTokens float64 `json:"max_tokens"`
+			Thinking  struct {
+				BudgetTokens float64 `json:"budget_tokens"`
+			} `json:"thinking"`
+		}
+		json.Unmarshal(data, &result)
+		if result.MaxTokens != tt.maxTokens || result.Thinking.BudgetTokens != tt.budget {
+			t.Errorf("%s: max_tokens = %v, budget_tokens = %v", tt.name, result.MaxTokens, result.Thinking.BudgetTokens)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package llm_proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/history"
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/metrics"
+	"github.com/imty42/claude-code-env/internal/tracing"
+	"github.com/imty42/claude-code-env/internal/usage"
+)
+
+// standardStopReasons Anthropic Messages API 定义的 stop_reason
+var standardStopReasons = map[string]bool{
+	"end_turn":      true,
+	"max_tokens":    true,
+	"stop_sequence": true,
+	"tool_use":      true,
+	"pause_turn":    true,
+	"refusal":       true,
+}
+
+// stopReasonAliases 常见的非标准 stop_reason（多为 OpenAI 风格）到标准值的映射
+var stopReasonAliases = map[string]string{
+	"stop":           "end_turn",
+	"eos":            "end_turn",
+	"length":         "max_tokens",
+	"tool_calls":     "tool_use",
+	"function_call":  "tool_use",
+	"content_filter": "refusal",
+}
+
+// messageResponseProcessor 处理 /v1/messages 响应：收集 token 用量，并按需将模型名改写回客户端请求的模型、规范化 stop_reason
+type messageResponseProcessor struct {
+	requestedModel    string // 客户端请求的模型
+	rewrite           bool   // 是否改写响应
+	requestID         string
+	startTime         time.Time      // 代理收到请求的时间，用于计算首个 token 耗时
+	upstreamRequestID string         // 上游返回的请求ID
+	provider          string         // 实际服务的 provider
+	servedModel       string         // 实际服务的模型
+	span              *tracing.Span  // 实际服务的上游请求 span
+	history           *history.Entry // 最近请求记录
+	usage             usage.Usage    // 从响应中解析的 token 用量
+}
+
+// collectUsage 合并 usage 字段中的 token 用量
+func (p *messageResponseProcessor) collectUsage(container map[string]interface{}) {
+	if fields, ok := container["usage"].(map[string]interface{}); ok {
+		p.usage.Merge(fields)
+	}
+}
+
+// processMessage 改写 message 对象（非流式响应体或 message_start 事件中的 message），返回是否有修改
+func (p *messageResponseProcessor) processMessage(message map[string]interface{}) bool {
+	changed := false
+	if p.requestedModel != "" {
+		if model, _ := message["model"].(string); model != p.requestedModel {
+			message["model"] = p.requestedModel
+			changed = true
+		}
+	}
+	if p.normalizeStopReason(message) {
+		changed = true
+	}
+	return changed
+}
+
+// normalizeStopReason 将已知的非标准 stop_reason 规范化为标准值，未知的值原样透传并记录警告，返回是否有修改
+func (p *messageResponseProcessor) normalizeStopReason(container map[string]interface{}) bool {
+	stopReason, ok := container["stop_reason"].(string)
+	if !ok || standardStopReasons[stopReason] {
+		return false
+	}
+
+	normalized, exists := stopReasonAliases[strings.ToLower(stopReason)]
+	if !exists {
+		logger.WarnWithFields(logger.ModuleProxy, logger.Fields{RequestID: p.requestID, Provider: p.provider, Model: p.servedModel}, "未知的 stop_reason: %s，原样返回", stopReason)
+		return false
+	}
+	logger.DebugWithRequestID(logger.ModuleProxy, p.requestID, "规范化 stop_reason: %s -> %s", stopReason, normalized)
+	container["stop_reason"] = normalized
+	return true
+}
+
+// processEventData 处理单个 SSE 事件的 data 负载，返回处理后的数据
+func (p *messageResponseProcessor) processEventData(data []byte) []byte {
+	// 只有 message_start 和 message_delta 事件携带用量或需要改写，其他事件跳过 JSON 解析
+	if !bytes.Contains(data, []byte(`"message_start"`)) && !bytes.Contains(data, []byte(`"message_delta"`)) {
+		return data
+	}
+
+	var event map[string]interface{}
+	if json.Unmarshal(data, &event) != nil {
+		return data
+	}
+
+	changed := false
+	switch event["type"] {
+	case "message_start":
+		if message, ok := event["message"].(map[string]interface{}); ok {
+			p.collectUsage(message)
+			changed = p.rewrite && p.processMessage(message)
+		}
+	case "message_delta":
+		p.collectUsage(event)
+		if delta, ok := event["delta"].(map[string]interface{}); ok {
+			changed = p.rewrite && p.normalizeStopReason(delta)
+		}
+	}
+
+	if !changed {
+		return data
+	}
+	modified, err := json.Marshal(event)
+	if err != nil {
+		return data
+	}
+	return modified
+}
+
+// processBody 处理非流式响应体，返回处理后的数据
+func (p *messageResponseProcessor) processBody(body []byte) []byte {
+	var message map[string]interface{}
+	if json.Unmarshal(body, &message) != nil {
+		return body
+	}
+	p.collectUsage(message)
+
+	if !p.rewrite || !p.processMessage(message) {
+		return body
+	}
+	modified, err := json.Marshal(message)
+	if err != nil {
+		return body
+	}
+	return modified
+}
+
+// isEventStream 判断响应是否为 SSE 流
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+}
+
+// copyMessagesResponse 复制 /v1/messages 响应，流式响应按行转发并逐个处理 SSE 事件
+func (s *LLMProxyServer) copyMessagesResponse(w http.ResponseWriter, resp *http.Response, processor *messageResponseProcessor) {
+	// 错误响应不含用量也不需要改写，原样转发
+	if resp.StatusCode != http.StatusOK {
+		s.copyResponse(w, resp)
+		return
+	}
+
+	if !isEventStream(resp) {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			logger.ErrorWithRequestID(logger.ModuleProxy, processor.requestID, "读取LLM API响应失败: %v", err)
+		}
+		body = processor.processBody(body)
+
+		copyHeaders(w, resp)
+		w.Header().Del("Content-Length")
+		w.WriteHeader(resp.StatusCode)
+		w.Write(body)
+		return
+	}
+
+	// 改写后长度会变化，流式响应同样不能保留上游的 Content-Length
+	copyHeaders(w, resp)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+
+	metrics.ActiveStreams.Add(1)
+	defer metrics.ActiveStreams.Add(-1)
+
+	firstToken := true
+	flusher, _ := w.(http.Flusher)
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if payload, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+				data := bytes.TrimSpace(payload)
+				// TTFT 以首个 content_block_delta 为准，message_start 和 ping 等事件不包含模型输出
+				if firstToken && isContentDelta(data) {
+					firstToken = false
+					ttft := time.Since(processor.startTime)
+					metrics.TTFT.Observe(ttft.Seconds(), processor.provider, processor.servedModel)
+					metrics.Timeline.ObserveTTFT(processor.provider, ttft)
+					processor.history.SetTTFT(ttft)
+					processor.span.AddEvent("first_token")
+				}
+				if processed := processor.processEventData(data); !bytes.Equal(processed, data) {
+					line = append(append([]byte("data: "), processed...), '\n')
+				}
+			}
+			w.Write(line)
+
+			// 缓冲区中没有更多数据时立即发送到客户端
+			if flusher != nil && reader.Buffered() == 0 {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				logger.ErrorWithRequestID(logger.ModuleProxy, processor.requestID, "读取LLM API响应失败: %v", err)
+				processor.span.SetError(err.Error())
+			}
+			processor.span.AddEvent("stream_end", "completed", err == io.EOF)
+			break
+		}
+	}
+}
+
+// isContentDelta 判断 SSE 事件的 data 负载是否为 content_block_delta 事件
+func isContentDelta(data []byte) bool {
+	if !bytes.Contains(data, []byte("content_block_delta")) {
+		return false
+	}
+	var event struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(data, &event) == nil && event.Type == "content_block_delta"
+}
+
+// copyHeaders 复制所有响应头，代理自身的请求ID响应头不会被上游覆盖
+func copyHeaders(w http.ResponseWriter, resp *http.Response) {
+	for key, values := range resp.Header {
+		if w.Header().Get(requestIDHeader) != "" && strings.EqualFold(key, requestIDHeader) {
+			continue
+		}
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+}
+
+// errorBodyLimit 记录错误响应体的字节数上限，比最近请求保留的上限多 1 字节，以便判断是否需要截断
+const errorBodyLimit = history.ErrorBodyLimit + 1
+
+// statusRecorder 记录写入客户端的响应状态码，错误响应同时记录响应体开头部分
+type statusRecorder struct {
+	http.ResponseWriter
+	status    int
+	errorBody []byte
+}
+
+// WriteHeader 记录状态码
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write 未显式写入状态码时按 200 记录
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.status >= 400 && len(r.errorBody) < errorBodyLimit {
+		r.errorBody = append(r.errorBody, data[:min(len(data), errorBodyLimit-len(r.errorBody))]...)
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Flush 转发流式响应的刷新
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,88 @@
+package llm_proxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestProcessEventDataRewritesModelAndStopReason(t *testing.T) {
+	processor := &messageResponseProcessor{requestedModel: "claude-sonnet-4-20250514", rewrite: true}
+
+	start := processor.processEventData([]byte(`{"type":"message_start","message":{"id":"msg_1","model":"deepseek-ai/DeepSeek-V3","usage":{"input_tokens":10}}}`))
+	var startEvent struct {
+		Message struct {
+			Model string `json:"model"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(start, &startEvent); err != nil {
+		t.Fatalf("unmarshal message_start: %v", err)
+	}
+	if startEvent.Message.Model != "claude-sonnet-4-20250514" {
+		t.Errorf("message_start model = %q", startEvent.Message.Model)
+	}
+
+	delta := processor.processEventData([]byte(`{"type":"message_delta","delta":{"stop_reason":"tool_calls"},"usage":{"output_tokens":5}}`))
+	var deltaEvent struct {
+		Delta struct {
+			StopReason string `json:"stop_reason"`
+		} `json:"delta"`
+	}
+	if err := json.Unmarshal(delta, &deltaEvent); err != nil {
+		t.Fatalf("unmarshal message_delta: %v", err)
+	}
+	if deltaEvent.Delta.StopReason != "tool_use" {
+		t.Errorf("message_delta stop_reason = %q", deltaEvent.Delta.StopReason)
+	}
+
+	if processor.usage.InputTokens != 10 || processor.usage.OutputTokens != 5 {
+		t.Errorf("collected usage = %+v", processor.usage)
+	}
+
+	// 无法识别的 stop_reason 原样返回
+	unknown := []byte(`{"type":"message_delta","delta":{"stop_reason":"safety_stop"}}`)
+	if got := processor.processEventData(unknown); string(got) != string(unknown) {
+		t.Errorf("unknown stop_reason was modified: %s", got)
+	}
+
+	// 其他事件原样返回
+	text := []byte(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`)
+	if got := processor.processEventData(text); string(got) != string(text) {
+		t.Errorf("content_block_delta was modified: %s", got)
+	}
+}
+
+func TestProcessBodyDisabled(t *testing.T) {
+	processor := &messageResponseProcessor{requestedModel: "claude-sonnet-4-20250514"}
+	body := []byte(`{"model":"deepseek-ai/DeepSeek-V3","stop_reason":"stop"}`)
+	if got := processor.processBody(body); string(got) != string(body) {
+		t.Errorf("body modified while rewrite disabled: %s", got)
+	}
+
+	processor.rewrite = true
+	var message map[string]interface{}
+	if err := json.Unmarshal(processor.processBody(body), &message); err != nil {
+		t.Fatalf("unmarshal body: %v", err)
+	}
+	if message["model"] != "claude-sonnet-4-20250514" || message["stop_reason"] != "end_turn" {
+		t.Errorf("unexpected rewritten body: %v", message)
+	}
+}
+
+func TestIsContentDelta(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`, true},
+		{`{"type": "content_block_delta", "index": 0}`, true},
+		{`{"type":"message_start","message":{"id":"msg_1"}}`, false},
+		{`{"type":"ping"}`, false},
+		{`{"type":"content_block_start","content_block":{"type":"text","text":"content_block_delta"}}`, false},
+		{`[DONE]`, false},
+	}
+	for _, tt := range tests {
+		if got := isContentDelta([]byte(tt.data)); got != tt.want {
+			t.Errorf("isContentDelta(%s) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
@@ -5,14 +5,22 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/imty42/claude-code-env/internal/capture"
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/history"
 	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/metrics"
 	"github.com/imty42/claude-code-env/internal/provider"
+	"github.com/imty42/claude-code-env/internal/tracing"
+	"github.com/imty42/claude-code-env/internal/usage"
 )
 
 // AnthropicErrorResponse Anthropic API 错误响应格式
@@ -24,13 +32,19 @@ type AnthropicErrorResponse struct {
 	} `json:"error"`
 }
 
-// writeAnthropicError 写入 Anthropic API 格式的错误响应
+// requestIDHeader 返回给客户端的代理请求ID响应头
+const requestIDHeader = "x-ccenv-request-id"
+
+// writeAnthropicError 写入 Anthropic API 格式的错误响应，消息中附带代理请求ID便于排查
 func writeAnthropicError(w http.ResponseWriter, statusCode int, errorType, message string) {
 	errorResp := AnthropicErrorResponse{
 		Type: "error",
 	}
 	errorResp.Error.Type = errorType
 	errorResp.Error.Message = "CCENV " + message
+	if requestID := w.Header().Get(requestIDHeader); requestID != "" {
+		errorResp.Error.Message += " (request_id: " + requestID + ")"
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -47,35 +61,64 @@ func writeAnthropicError(w http.ResponseWriter, statusCode int, errorType, messa
 
 // LLMProxyServer LLM API代理服务器
 type LLMProxyServer struct {
-	server          *http.Server
-	providerManager *provider.ProviderManager
-	httpClient      *http.Client
-	host            string
-	port            int
+	server               *http.Server
+	providerManager      *provider.ProviderManager
+	httpClient           *http.Client
+	host                 string
+	port                 int
+	rewriteResponseModel bool         // 是否将响应中的模型名改写回客户端请求的模型
+	usageStore           *usage.Store // 用量记录存储，无法确定存储路径时为 nil
+	upstreamIDHeader     string       // 向上游传递代理请求ID的请求头，为空时不传递
+}
+
+// upstreamRequestID 返回上游响应中的请求ID，Anthropic 使用 request-id，部分兼容服务使用 x-request-id
+func upstreamRequestID(resp *http.Response) string {
+	if id := resp.Header.Get("request-id"); id != "" {
+		return id
+	}
+	return resp.Header.Get("x-request-id")
 }
 
 // NewLLMProxyServer 创建新的LLM代理服务器
-func NewLLMProxyServer(providerManager *provider.ProviderManager, host string, port int, apiProxy string, timeout time.Duration) *LLMProxyServer {
+func NewLLMProxyServer(providerManager *provider.ProviderManager, cfg *config.Config) *LLMProxyServer {
 	// 创建带代理配置的 HTTP 客户端
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: false},
 	}
 
 	// 设置代理
-	if apiProxy != "" {
+	if cfg.APIProxy != "" {
+		apiProxy := cfg.APIProxy
 		transport.Proxy = func(req *http.Request) (*url.URL, error) {
 			return url.Parse(apiProxy)
 		}
 		logger.Info(logger.ModuleProxy, "LLM API服务器配置API代理: %s", apiProxy)
 	}
 
+	// 用量记录存储
+	var usageStore *usage.Store
+	if usagePath, err := usage.DefaultStorePath(); err != nil {
+		logger.Error(logger.ModuleProxy, "初始化用量记录存储失败，不会记录请求用量: %v", err)
+	} else {
+		usageStore = usage.NewStore(usagePath)
+	}
+
+	// 向上游传递请求ID的请求头
+	var upstreamIDHeader string
+	if cfg.ForwardsRequestID() {
+		upstreamIDHeader = cfg.RequestIDHeader
+	}
+
 	apiServer := &LLMProxyServer{
-		providerManager: providerManager,
-		host:            host,
-		port:            port,
+		providerManager:      providerManager,
+		host:                 cfg.CCEnvHost,
+		port:                 cfg.LLMProxyPort,
+		rewriteResponseModel: cfg.RewriteResponseModel,
+		usageStore:           usageStore,
+		upstreamIDHeader:     upstreamIDHeader,
 		httpClient: &http.Client{
 			Transport: transport,
-			Timeout:   timeout,
+			Timeout:   time.Duration(cfg.APITimeoutMS) * time.Millisecond,
 		},
 	}
 
@@ -89,7 +132,7 @@ func NewLLMProxyServer(providerManager *provider.ProviderManager, host string, p
 
 	// 创建服务器
 	apiServer.server = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", host, port),
+		Addr:    fmt.Sprintf("%s:%d", apiServer.host, apiServer.port),
 		Handler: mux,
 	}
 
@@ -121,10 +164,47 @@ func (s *LLMProxyServer) Shutdown() error {
 	return s.server.Shutdown(ctx)
 }
 
+// ServeMessages 在进程内处理一个 /v1/messages 请求，经过与代理端口相同的完整处理流程，供管理界面的 playground 使用
+func (s *LLMProxyServer) ServeMessages(w http.ResponseWriter, r *http.Request) {
+	s.handleMessages(w, r)
+}
+
+// pinnedProviderKey 请求上下文中指定 provider 的键
+type pinnedProviderKey struct{}
+
+// WithPinnedProvider 返回指定由 name 处理请求的上下文，name 为空时按路由规则选择
+// 只能在进程内通过 ServeMessages 使用（管理界面的 playground），代理端口的客户端无法指定 provider
+func WithPinnedProvider(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, pinnedProviderKey{}, name)
+}
+
+// pinnedProvider 返回请求上下文中指定的 provider，没有指定时为空
+func pinnedProvider(ctx context.Context) string {
+	name, _ := ctx.Value(pinnedProviderKey{}).(string)
+	return name
+}
+
 // handleMessages 处理 /v1/messages 请求
 func (s *LLMProxyServer) handleMessages(w http.ResponseWriter, r *http.Request) {
-	// 生成请求追踪ID
+	// 生成请求追踪ID，通过响应头返回给客户端
 	requestID := logger.GenerateRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	// 创建请求的根 span，请求结束时记录最终状态码
+	recorder := &statusRecorder{ResponseWriter: w}
+	w = recorder
+	span := tracing.StartRequestSpan("POST /v1/messages", r.Header)
+	span.SetAttribute("ccenv.request_id", requestID)
+	defer func() {
+		span.SetAttribute("http.response.status_code", recorder.status)
+		if recorder.status >= 400 {
+			span.SetError(http.StatusText(recorder.status))
+		}
+		span.End()
+	}()
 
 	// 只处理 POST 请求
 	if r.Method != "POST" {
@@ -135,12 +215,26 @@ func (s *LLMProxyServer) handleMessages(w http.ResponseWriter, r *http.Request)
 
 	// 开始计时
 	startTime := time.Now()
+	metrics.InflightRequests.Add(1)
+	defer metrics.InflightRequests.Add(-1)
 
-	// 获取下一个可用的 provider
-	providerState, err := s.providerManager.GetNextProvider()
-	if err != nil {
-		logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "获取可用 provider 失败: %v", err)
-		writeAnthropicError(w, http.StatusServiceUnavailable, "overloaded_error", "无可用的服务提供商")
+	// 记录到最近请求，请求结束时记录返回给客户端的状态码和错误响应体
+	entry := history.Begin(requestID, startTime, r.Header.Get("User-Agent"))
+	defer func() { entry.Finish(recorder.status, recorder.errorBody) }()
+
+	// 请求结束时写入用量记录，本地拒绝或转发失败（没有上游响应）的请求同样记录
+	record := usage.Record{Timestamp: startTime, RequestID: requestID}
+	defer func() { s.appendUsageRecord(record, recorder.status) }()
+
+	// 请求结束时输出 INFO 级别的请求完成摘要，logs --stats 据此统计
+	defer func() {
+		logger.LogRequestSummary(requestID, r.Method, r.URL.Path, recorder.status, time.Since(startTime), record.Provider, record.ServedModel, record.UpstreamRequestID)
+	}()
+
+	// 全局预算耗尽时拒绝请求
+	if exhausted, reason := s.providerManager.GlobalBudgetExhausted(); exhausted {
+		logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "全局预算耗尽，拒绝请求: %s", reason)
+		writeAnthropicError(w, http.StatusPaymentRequired, "billing_error", "全局"+reason+"，请调整 budget 配置或等待下个统计周期")
 		return
 	}
 
@@ -149,150 +243,330 @@ func (s *LLMProxyServer) handleMessages(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "读取请求体失败: %v", err)
 		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "读取请求体失败")
-		s.providerManager.RecordFailure(providerState.Provider.Name)
 		return
 	}
 	r.Body.Close()
 
-	// 解析和修改请求体（如果需要模型映射）
-	modifiedBody := bodyBytes
-	targetModel := providerState.Provider.Env["ANTHROPIC_MODEL"]
-	if targetModel != "" {
-		modifiedBody, err = s.modifyRequestModel(bodyBytes, targetModel, providerState.Provider.Name)
-		if err != nil {
-			logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "修改请求模型失败: %v", err)
-			writeAnthropicError(w, http.StatusInternalServerError, "api_error", "修改请求模型失败")
-			s.providerManager.RecordFailure(providerState.Provider.Name)
+	// 开启抓包时记录原始请求
+	wire := capture.Start(requestID)
+	defer wire.Close()
+	wire.Inbound(r, bodyBytes)
+
+	// 提取请求特征用于内容路由（解析失败时按空特征路由）
+	var requestBody map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &requestBody); err != nil {
+		logger.DebugWithRequestID(logger.ModuleProxy, requestID, "解析请求体失败，跳过内容路由: %v", err)
+	}
+	requestInfo := buildRequestInfo(requestBody, r.Header)
+	requestInfo.Provider = pinnedProvider(r.Context())
+	span.SetAttribute("ccenv.requested_model", requestInfo.Model)
+	stream, _ := requestBody["stream"].(bool)
+	record.RequestedModel, record.Session = requestInfo.Model, sessionID(r.Header, requestBody)
+	entry.SetRequest(requestInfo.Model, stream, record.Session)
+
+	// 响应处理器：收集 token 用量，并按配置将响应中的模型名改写回客户端请求的模型
+	processor := &messageResponseProcessor{
+		requestedModel: requestInfo.Model,
+		rewrite:        s.rewriteResponseModel,
+		requestID:      requestID,
+		startTime:      startTime,
+		history:        entry,
+	}
+
+	// 按路由规则和策略选择 provider，限流或过载时依次尝试备用模型、其他 provider 和降级链
+	var overloadedResp *http.Response // 最近一次限流或过载的响应，全部尝试失败时返回给客户端
+	var overloadedProvider *provider.ProviderState
+	var overloadedModel string
+	var forwardErr error                                        // 最近一次转发失败的错误，没有任何上游响应时返回 502
+	tried := make(map[string]bool)                              // 已尝试的 provider/上游模型组合
+	requestedModels := map[string]bool{requestInfo.Model: true} // 已尝试的请求模型，防止降级链成环
+	defer func() { span.SetAttribute("ccenv.attempts", len(tried)) }()
+
+	for {
+		excluded := make(map[string]bool)
+		for {
+			providerState, err := s.providerManager.GetProviderForRequest(requestInfo, excluded)
+			if err != nil {
+				if len(tried) > 0 {
+					// 当前模型已无可尝试的 provider，进入降级
+					break
+				}
+				logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "获取可用 provider 失败: %v", err)
+				if errors.Is(err, provider.ErrContextWindowExceeded) || errors.Is(err, provider.ErrUnknownProvider) || errors.Is(err, provider.ErrProviderUnavailable) {
+					writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+					return
+				}
+				if errors.Is(err, provider.ErrBudgetExhausted) {
+					writeAnthropicError(w, http.StatusPaymentRequired, "billing_error", err.Error()+"，请调整 budget 配置或等待下个统计周期")
+					return
+				}
+				writeAnthropicError(w, http.StatusServiceUnavailable, "overloaded_error", "无可用的服务提供商")
+				return
+			}
+			providerName := providerState.Provider.Name
+			excluded[providerName] = true
+
+			// 降级后固定上游模型的 provider 仍会收到同一个模型，降级步骤没有为它指定上游模型时不再重复尝试
+			if requestInfo.Model != processor.requestedModel && providerState.Provider.TargetModel("") != "" && requestInfo.ProviderModels[providerName] == "" {
+				logger.DebugWithRequestID(logger.ModuleProxy, requestID, "Provider %s 固定使用模型 %s，降级步骤未指定该 provider 的模型，降级后跳过", providerName, providerState.Provider.TargetModel(""))
+				continue
+			}
+
+			// tried 按映射后的上游模型记录，同一 provider 不会重复发送同一个模型
+			// 上下文窗口放不下该请求的备用模型直接跳过，避免上游返回难以理解的 400
+			for _, model := range provider.FittingModels(providerState.Provider, requestInfo) {
+				if tried[providerName+"/"+model] {
+					continue
+				}
+				tried[providerName+"/"+model] = true
+
+				// 每次上游尝试对应一个子 span
+				attemptSpan := span.StartChild("upstream "+providerName, tracing.KindClient)
+				attemptSpan.SetAttribute("ccenv.provider", providerName)
+				attemptSpan.SetAttribute("ccenv.model", model)
+				attemptSpan.SetAttribute("ccenv.attempt", len(tried))
+
+				// 修改请求体（模型映射、max_tokens 限制）
+				modifiedBody, err := s.rewriteRequestBody(bodyBytes, requestBody, providerState, model, requestID)
+				if err != nil {
+					logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "修改请求体失败: %v", err)
+					entry.AddAttempt(history.Attempt{Provider: providerName, Model: model, StartedAt: time.Now(), Error: "修改请求体失败: " + err.Error()})
+					wire.Error(err)
+					writeAnthropicError(w, http.StatusInternalServerError, "api_error", "修改请求模型失败")
+					s.providerManager.RecordFailure(providerName, "修改请求体失败: "+err.Error())
+					closeResponse(overloadedResp)
+					attemptSpan.SetError(err.Error())
+					attemptSpan.End()
+					return
+				}
+
+				resp, err := s.sendMessages(r, providerState, model, modifiedBody, requestID, startTime, attemptSpan, wire, entry)
+				if err != nil {
+					// 转发失败已在 sendMessages 中记录为 provider 失败，跳过该 provider 的其他模型，尝试下一个 provider
+					logger.WarnWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerName, Model: model},
+						"请求失败，尝试下一个 provider: %v", err)
+					forwardErr = err
+					record.Provider, record.ServedModel = providerName, model
+					attemptSpan.End()
+					break
+				}
+
+				if isOverloaded(resp) {
+					logger.WarnWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerName, Model: model, Status: resp.StatusCode, UpstreamRequestID: upstreamRequestID(resp)},
+						"模型 %s 限流或过载 (%d)，尝试下一个备选", model, resp.StatusCode)
+					closeResponse(overloadedResp)
+					overloadedResp, overloadedProvider, overloadedModel = resp, providerState, model
+					entry.MarkOverloaded()
+					attemptSpan.SetAttribute("ccenv.overloaded", true)
+					attemptSpan.End()
+					continue
+				}
+
+				closeResponse(overloadedResp)
+				defer resp.Body.Close()
+				w.Header().Set(servedModelHeader, model)
+				span.SetAttribute("ccenv.provider", providerName)
+				span.SetAttribute("ccenv.served_model", model)
+				processor.provider, processor.servedModel, processor.span = providerName, model, attemptSpan
+				processor.upstreamRequestID = upstreamRequestID(resp)
+				entry.SetServed(providerName, model, processor.upstreamRequestID)
+				s.copyMessagesResponse(w, resp, processor)
+				s.recordUsage(&record, providerState, model, processor)
+				attemptSpan.End()
+				return
+			}
+		}
+
+		// 所有 provider 均限流或过载，按降级链降低请求模型
+		step, ok := s.providerManager.DowngradeModel(requestInfo.Model)
+		nextModel := step.To
+		if overloadedResp == nil || !ok || requestedModels[nextModel] {
+			break
+		}
+		logger.WarnWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Model: nextModel}, "所有 provider 均限流或过载，模型降级: %s -> %s", requestInfo.Model, nextModel)
+		span.AddEvent("downgrade", "from", requestInfo.Model, "to", nextModel)
+		requestedModels[nextModel] = true
+		requestInfo.Model, requestInfo.ProviderModels = nextModel, step.Models
+	}
+
+	// 所有尝试都失败，返回最后一次限流或过载的响应
+	if overloadedResp == nil {
+		if forwardErr != nil {
+			logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "请求失败: %v", forwardErr)
+			writeAnthropicError(w, http.StatusBadGateway, "api_error", "请求转发失败")
 			return
 		}
-	} else {
-		// 没有配置模型映射，也要打印当前请求的模型
-		s.logRequestModel(bodyBytes, providerState.Provider.Name, requestID)
+		writeAnthropicError(w, http.StatusServiceUnavailable, "overloaded_error", "无可用的服务提供商")
+		return
 	}
+	defer overloadedResp.Body.Close()
+	processor.upstreamRequestID = upstreamRequestID(overloadedResp)
+	logger.ErrorWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: overloadedProvider.Provider.Name, Model: overloadedModel, Status: overloadedResp.StatusCode, UpstreamRequestID: processor.upstreamRequestID},
+		"所有 provider 和降级模型均限流或过载，返回 %s 的响应", overloadedProvider.Provider.Name)
+	w.Header().Set(servedModelHeader, overloadedModel)
+	span.SetAttribute("ccenv.provider", overloadedProvider.Provider.Name)
+	span.SetAttribute("ccenv.served_model", overloadedModel)
+	processor.provider, processor.servedModel = overloadedProvider.Provider.Name, overloadedModel
+	entry.SetServed(overloadedProvider.Provider.Name, overloadedModel, processor.upstreamRequestID)
+	s.copyMessagesResponse(w, overloadedResp, processor)
+	s.recordUsage(&record, overloadedProvider, overloadedModel, processor)
+}
 
-	// 构建目标 URL
-	baseURL := providerState.Provider.Env["ANTHROPIC_BASE_URL"]
-	targetURL := baseURL + "/v1/messages"
+// recordUsage 记录上游返回的 token 用量：计入预算、监控指标和最近请求，并填入用量记录
+func (s *LLMProxyServer) recordUsage(record *usage.Record, providerState *provider.ProviderState, servedModel string, processor *messageResponseProcessor) {
+	providerName := providerState.Provider.Name
+	u := processor.usage
+
+	if !u.IsZero() {
+		logger.DebugWithFields(logger.ModuleProxy, logger.Fields{RequestID: processor.requestID, Provider: providerName, Model: servedModel}, "token 用量: 输入 %d, 输出 %d, 缓存写入 %d, 缓存读取 %d",
+			u.InputTokens, u.OutputTokens, u.CacheCreationInputTokens, u.CacheReadInputTokens)
+		s.providerManager.RecordUsage(providerName, u)
+		processor.history.SetUsage(u)
+		processor.span.SetAttribute("gen_ai.usage.input_tokens", u.InputTokens)
+		processor.span.SetAttribute("gen_ai.usage.output_tokens", u.OutputTokens)
+
+		metrics.Tokens.Add(float64(u.InputTokens), providerName, servedModel, "input")
+		metrics.Tokens.Add(float64(u.OutputTokens), providerName, servedModel, "output")
+		metrics.Tokens.Add(float64(u.CacheCreationInputTokens), providerName, servedModel, "cache_creation")
+		metrics.Tokens.Add(float64(u.CacheReadInputTokens), providerName, servedModel, "cache_read")
+		metrics.Timeline.ObserveTokens(providerName, int64(u.InputTokens), int64(u.OutputTokens))
+	}
+
+	record.Provider = providerName
+	record.ServedModel = servedModel
+	record.UpstreamRequestID = processor.upstreamRequestID
+	record.Usage = u
+	record.Cost = usage.Cost(providerState.Provider.Pricing, u)
+}
 
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(modifiedBody))
-	if err != nil {
-		logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "创建请求失败: %v", err)
-		writeAnthropicError(w, http.StatusInternalServerError, "api_error", "创建请求失败")
-		s.providerManager.RecordFailure(providerState.Provider.Name)
+// appendUsageRecord 按返回给客户端的状态码补全用量记录并追加到用量记录存储
+func (s *LLMProxyServer) appendUsageRecord(record usage.Record, statusCode int) {
+	if s.usageStore == nil {
 		return
 	}
+	record.StatusCode = statusCode
+	record.LatencyMS = time.Since(record.Timestamp).Milliseconds()
+	if err := s.usageStore.Append(record); err != nil {
+		logger.ErrorWithRequestID(logger.ModuleProxy, record.RequestID, "记录请求用量失败: %v", err)
+	}
+}
 
-	// 复制所有请求头
-	proxyReq.Header = r.Header.Clone()
-
-	// 设置认证头：优先使用ANTHROPIC_AUTH_TOKEN，其次ANTHROPIC_API_KEY
-	authToken := providerState.Provider.Env["ANTHROPIC_AUTH_TOKEN"]
-	apiKey := providerState.Provider.Env["ANTHROPIC_API_KEY"]
+// sendMessages 向 provider 发送 /v1/messages 请求，并按响应状态记录 provider 成功或失败，entry 记录本次上游尝试
+func (s *LLMProxyServer) sendMessages(r *http.Request, providerState *provider.ProviderState, model string, body []byte, requestID string, startTime time.Time, span *tracing.Span, wire *capture.Capture, entry *history.Entry) (*http.Response, error) {
+	providerName := providerState.Provider.Name
+	attempt := history.Attempt{Provider: providerName, Model: model, StartedAt: time.Now()}
 
-	if authToken != "" {
-		// 使用 Authorization header with Bearer prefix
-		proxyReq.Header.Set("Authorization", "Bearer "+authToken)
-	} else if apiKey != "" {
-		// 使用 X-Api-Key header
-		proxyReq.Header.Set("X-Api-Key", apiKey)
+	proxyReq, err := s.newMessagesRequest(r.Header, providerState, body, requestID)
+	if err != nil {
+		s.providerManager.RecordFailure(providerName, err.Error())
+		attempt.Error = err.Error()
+		entry.AddAttempt(attempt)
+		return nil, err
 	}
 
-	// 确保 Content-Length 正确
-	proxyReq.Header.Set("Content-Length", fmt.Sprintf("%d", len(modifiedBody)))
+	// 向支持的 provider 传递 W3C traceparent
+	if span != nil && providerState.Provider.TracePropagation {
+		proxyReq.Header.Set("traceparent", span.Traceparent())
+	}
+	wire.Outbound(providerName, proxyReq, body)
 
 	// 发送请求
+	sendTime := time.Now()
+	metrics.QueueDepth.Add(1)
 	resp, err := s.httpClient.Do(proxyReq)
+	metrics.QueueDepth.Add(-1)
+	latency := time.Since(sendTime)
+	metrics.UpstreamLatency.Observe(latency.Seconds(), providerName, model)
+	attempt.LatencyMS = latency.Milliseconds()
 	if err != nil {
-		logger.ErrorWithRequestID(logger.ModuleProxy, requestID, "请求失败: %v", err)
-		writeAnthropicError(w, http.StatusBadGateway, "api_error", "请求转发失败")
-		s.providerManager.RecordFailure(providerState.Provider.Name)
-		return
+		attempt.Error = err.Error()
+		entry.AddAttempt(attempt)
+		wire.Error(err)
+		metrics.Requests.Inc(providerName, model, "error")
+		metrics.Timeline.ObserveRequest(providerName, 0, latency)
+		span.SetError(err.Error())
+		s.providerManager.RecordFailure(providerName, err.Error())
+		return nil, err
+	}
+	s.providerManager.RecordLatency(providerName, latency)
+	metrics.Requests.Inc(providerName, model, strconv.Itoa(resp.StatusCode))
+	metrics.Timeline.ObserveRequest(providerName, resp.StatusCode, latency)
+	// 每次尝试的响应体都记录到抓包，包括限流、过载后被跳过的响应
+	wire.Response(resp)
+	resp.Body = wire.WrapBody(resp.Body)
+	upstreamID := upstreamRequestID(resp)
+	attempt.Status, attempt.UpstreamRequestID = resp.StatusCode, upstreamID
+	entry.AddAttempt(attempt)
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if upstreamID != "" {
+		span.SetAttribute("ccenv.upstream_request_id", upstreamID)
+	}
+	if resp.StatusCode >= 400 {
+		span.SetError(resp.Status)
 	}
-	defer resp.Body.Close()
 
 	// 检查响应状态码，5xx 错误视为 provider 失败
 	if resp.StatusCode >= 500 {
-		logger.Warn(logger.ModuleProxy, "Provider %s 返回服务器错误: %d", providerState.Provider.Name, resp.StatusCode)
-		s.providerManager.RecordFailure(providerState.Provider.Name)
+		logger.WarnWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerName, Model: model, Status: resp.StatusCode, UpstreamRequestID: upstreamID}, "Provider %s 返回服务器错误: %d", providerName, resp.StatusCode)
+		s.providerManager.RecordFailure(providerName, "服务器错误: "+resp.Status)
 	} else {
 		// 成功响应，重置失败计数
-		s.providerManager.RecordSuccess(providerState.Provider.Name)
+		s.providerManager.RecordSuccess(providerName)
 	}
 
-	// 计算耗时并记录统一的HTTP请求日志
+	// 计算耗时并记录本次上游尝试的HTTP请求日志
 	duration := time.Since(startTime)
-	logger.LogHTTPRequest(requestID, r.Method, r.URL.Path, resp.StatusCode, duration, providerState.Provider.Name)
+	logger.LogHTTPRequest(requestID, r.Method, r.URL.Path, resp.StatusCode, duration, providerName, upstreamID)
 
-	// 复制响应
-	s.copyResponse(w, resp)
+	return resp, nil
 }
 
-// modifyRequestModel 修改请求中的模型
-func (s *LLMProxyServer) modifyRequestModel(bodyBytes []byte, targetModel, providerName string) ([]byte, error) {
-	var requestBody map[string]interface{}
+// newMessagesRequest 构建发往 provider 的 /v1/messages 请求：复制客户端请求头，设置 provider 的认证信息和代理请求ID
+func (s *LLMProxyServer) newMessagesRequest(header http.Header, providerState *provider.ProviderState, body []byte, requestID string) (*http.Request, error) {
+	// 构建目标 URL
+	baseURL := providerState.Provider.Env["ANTHROPIC_BASE_URL"]
+	targetURL := baseURL + "/v1/messages"
 
-	err := json.Unmarshal(bodyBytes, &requestBody)
+	// 创建代理请求
+	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("解析JSON失败: %v", err)
+		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
 
-	// 获取原始模型
-	originalModel := ""
-	if model, exists := requestBody["model"]; exists {
-		if modelStr, ok := model.(string); ok {
-			originalModel = modelStr
-		}
-	}
+	// 复制所有请求头
+	proxyReq.Header = header.Clone()
 
-	// 替换为目标模型
-	requestBody["model"] = targetModel
+	// 由 Transport 自动协商和解压 gzip，保证代理能解析和改写响应体
+	proxyReq.Header.Del("Accept-Encoding")
+	proxyReq.Header.Del(PinProviderHeader)
 
-	if originalModel != "" {
-		if originalModel != targetModel {
-			logger.Info(logger.ModuleProxy, "[%s] 模型映射: %s -> %s", providerName, originalModel, targetModel)
-		} else {
-			logger.Info(logger.ModuleProxy, "[%s] 请求模型: %s", providerName, originalModel)
-		}
-	} else {
-		logger.Info(logger.ModuleProxy, "[%s] 请求模型: %s", providerName, targetModel)
-	}
+	// 设置认证头：优先使用ANTHROPIC_AUTH_TOKEN，其次ANTHROPIC_API_KEY
+	authToken := providerState.Provider.Env["ANTHROPIC_AUTH_TOKEN"]
+	apiKey := providerState.Provider.Env["ANTHROPIC_API_KEY"]
 
-	// 重新序列化
-	modifiedBytes, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("序列化JSON失败: %v", err)
+	if authToken != "" {
+		// 使用 Authorization header with Bearer prefix
+		proxyReq.Header.Set("Authorization", "Bearer "+authToken)
+	} else if apiKey != "" {
+		// 使用 X-Api-Key header
+		proxyReq.Header.Set("X-Api-Key", apiKey)
 	}
 
-	return modifiedBytes, nil
-}
-
-// logRequestModel 记录请求模型（用于没有模型映射的情况）
-func (s *LLMProxyServer) logRequestModel(bodyBytes []byte, providerName, requestID string) {
-	var requestBody map[string]interface{}
+	// 确保 Content-Length 正确
+	proxyReq.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
 
-	err := json.Unmarshal(bodyBytes, &requestBody)
-	if err != nil {
-		logger.DebugWithRequestID(logger.ModuleProxy, requestID, "解析请求体失败，无法获取模型信息: %v", err)
-		return
+	// 传递代理请求ID，便于与 provider 的日志关联
+	if s.upstreamIDHeader != "" {
+		proxyReq.Header.Set(s.upstreamIDHeader, requestID)
 	}
 
-	// 获取请求模型
-	if model, exists := requestBody["model"]; exists {
-		if modelStr, ok := model.(string); ok {
-			logger.Info(logger.ModuleProxy, "[%s] [%s] 请求模型: %s", providerName, requestID, modelStr)
-		}
-	}
+	return proxyReq, nil
 }
 
 // copyResponse 复制响应
 func (s *LLMProxyServer) copyResponse(w http.ResponseWriter, resp *http.Response) {
 	// 复制所有响应头
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
+	copyHeaders(w, resp)
 
 	// 设置状态码
 	w.WriteHeader(resp.StatusCode)
@@ -327,8 +601,9 @@ func (s *LLMProxyServer) handleV1Routes(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 生成请求追踪ID
+	// 生成请求追踪ID，通过响应头返回给客户端
 	requestID := logger.GenerateRequestID()
+	w.Header().Set(requestIDHeader, requestID)
 	startTime := time.Now()
 
 	// 记录请求
@@ -358,8 +633,9 @@ func (s *LLMProxyServer) handleV1Routes(w http.ResponseWriter, r *http.Request)
 
 // handleHealth 处理 LLM代理健康检查
 func (s *LLMProxyServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	// 生成请求追踪ID
+	// 生成请求追踪ID，通过响应头返回给客户端
 	requestID := logger.GenerateRequestID()
+	w.Header().Set(requestIDHeader, requestID)
 	startTime := time.Now()
 
 	logger.DebugWithRequestID(logger.ModuleProxy, requestID, "LLM API Health %s %s", r.Method, r.URL.Path)
@@ -392,7 +668,7 @@ func (s *LLMProxyServer) forwardRequest(w http.ResponseWriter, r *http.Request,
 		bodyBytes, err = io.ReadAll(r.Body)
 		if err != nil {
 			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "读取请求体失败")
-			s.providerManager.RecordFailure(providerState.Provider.Name)
+			s.providerManager.RecordFailure(providerState.Provider.Name, "读取请求体失败: "+err.Error())
 			return fmt.Errorf("读取请求体失败: %v", err)
 		}
 		r.Body.Close()
@@ -402,7 +678,7 @@ func (s *LLMProxyServer) forwardRequest(w http.ResponseWriter, r *http.Request,
 	proxyReq, err := http.NewRequest(r.Method, targetURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		writeAnthropicError(w, http.StatusInternalServerError, "api_error", "创建请求失败")
-		s.providerManager.RecordFailure(providerState.Provider.Name)
+		s.providerManager.RecordFailure(providerState.Provider.Name, "创建请求失败: "+err.Error())
 		return fmt.Errorf("创建请求失败: %v", err)
 	}
 
@@ -426,29 +702,37 @@ func (s *LLMProxyServer) forwardRequest(w http.ResponseWriter, r *http.Request,
 		proxyReq.Header.Set("Content-Length", fmt.Sprintf("%d", len(bodyBytes)))
 	}
 
+	// 传递代理请求ID，便于与 provider 的日志关联
+	if s.upstreamIDHeader != "" {
+		proxyReq.Header.Set(s.upstreamIDHeader, requestID)
+	}
+
 	// 发送请求
+	sendTime := time.Now()
 	resp, err := s.httpClient.Do(proxyReq)
 	if err != nil {
 		writeAnthropicError(w, http.StatusBadGateway, "api_error", "请求转发失败")
-		s.providerManager.RecordFailure(providerState.Provider.Name)
+		s.providerManager.RecordFailure(providerState.Provider.Name, err.Error())
 		return fmt.Errorf("请求转发失败: %v", err)
 	}
+	s.providerManager.RecordLatency(providerState.Provider.Name, time.Since(sendTime))
 	defer resp.Body.Close()
 
 	// 检查响应状态码，5xx 错误视为 provider 失败
+	upstreamID := upstreamRequestID(resp)
 	if resp.StatusCode >= 500 {
-		logger.Warn(logger.ModuleProxy, "Provider %s 返回服务器错误: %d", providerState.Provider.Name, resp.StatusCode)
-		s.providerManager.RecordFailure(providerState.Provider.Name)
+		logger.WarnWithFields(logger.ModuleProxy, logger.Fields{RequestID: requestID, Provider: providerState.Provider.Name, Status: resp.StatusCode, UpstreamRequestID: upstreamID}, "Provider %s 返回服务器错误: %d", providerState.Provider.Name, resp.StatusCode)
+		s.providerManager.RecordFailure(providerState.Provider.Name, "服务器错误: "+resp.Status)
 	} else {
 		// 成功响应，重置失败计数
 		s.providerManager.RecordSuccess(providerState.Provider.Name)
 	}
 
-	// 计算耗时并记录统一的HTTP请求日志
+	// 单次转发即完整请求，记录请求完成摘要
 	duration := time.Since(startTime)
-	logger.LogHTTPRequest(requestID, r.Method, r.URL.Path, resp.StatusCode, duration, providerState.Provider.Name)
+	logger.LogRequestSummary(requestID, r.Method, r.URL.Path, resp.StatusCode, duration, providerState.Provider.Name, "", upstreamID)
 
 	// 复制响应
 	s.copyResponse(w, resp)
 	return nil
-}
\ No newline at end of file
+}
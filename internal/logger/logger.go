@@ -3,12 +3,14 @@ package logger
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -39,76 +41,186 @@ var levelValues = map[string]LogLevel{
 // Logger 统一日志系统
 type Logger struct {
 	level   LogLevel
+	format  string // 输出格式：text 或 json
 	output  *log.Logger
-	logFile *os.File
+	logFile *rotatingWriter
 }
 
 var globalLogger *Logger
 
+// loggerMutex 保护 globalLogger 的替换，配置重载时关闭和重新初始化日志系统不会与并发写入冲突
+var loggerMutex sync.RWMutex
+
+// Options 日志系统选项
+type Options struct {
+	Level       string // 日志级别：DEBUG/INFO/WARN/ERROR
+	Format      string // 输出格式：text（默认）或 json
+	Path        string // 日志文件路径，为空时使用 ~/.claude-code-env/ccenv.log
+	MaxSizeMB   int    // 单个日志文件的最大大小（MB），超过后轮转，0 表示不按大小轮转
+	RotateDaily bool   // 是否每天轮转
+	MaxBackups  int    // 保留的轮转文件数，0 表示不限制
+	MaxAgeDays  int    // 轮转文件的保留天数，0 表示不限制
+	Compress    bool   // 是否 gzip 压缩轮转文件
+
+	Secrets        []string // 需要从日志中脱敏的敏感值，如 provider 的 API Key
+	RedactPatterns []string // 额外的脱敏正则表达式
+}
+
+// DefaultLogPath 返回默认的日志文件路径
+func DefaultLogPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户主目录失败: %v", err)
+	}
+	return filepath.Join(homeDir, ".claude-code-env", "ccenv.log"), nil
+}
+
+// ResolveLogPath 解析日志文件路径，支持 ~ 开头的路径，为空时返回默认路径
+func ResolveLogPath(path string) (string, error) {
+	if path == "" {
+		return DefaultLogPath()
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("获取用户主目录失败: %v", err)
+		}
+		path = filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+	}
+	return path, nil
+}
+
+// Fields 结构化日志字段，JSON 格式下作为独立字段输出，文本格式下 Provider 和 RequestID 作为前缀输出
+type Fields struct {
+	RequestID string
+	Provider  string
+	Model     string
+	Status    int
+	Duration  time.Duration
+	Method    string
+	Path      string
+
+	UpstreamRequestID string // 上游返回的请求ID（request-id 响应头）
+}
+
+// entry 表示一条日志记录
+type entry struct {
+	Time       string  `json:"time"`
+	Level      string  `json:"level"`
+	Module     string  `json:"module"`
+	RequestID  string  `json:"request_id,omitempty"`
+	Provider   string  `json:"provider,omitempty"`
+	Model      string  `json:"model,omitempty"`
+	Method     string  `json:"method,omitempty"`
+	Path       string  `json:"path,omitempty"`
+	Status     int     `json:"status,omitempty"`
+	DurationMS float64 `json:"duration_ms,omitempty"`
+	Message    string  `json:"message"`
+	Error      string  `json:"error,omitempty"`
+	Caller     string  `json:"caller,omitempty"`
+
+	UpstreamRequestID string `json:"upstream_request_id,omitempty"`
+}
+
 // InitLogger 初始化全局日志系统
-func InitLogger(levelStr string) error {
+func InitLogger(options Options) error {
 	// 解析日志级别
-	level, exists := levelValues[strings.ToUpper(levelStr)]
+	level, exists := levelValues[strings.ToUpper(options.Level)]
 	if !exists {
 		level = INFO // 默认 INFO 级别
 	}
 
-	// 创建日志文件
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("获取用户主目录失败: %v", err)
-	}
-
-	logPath := filepath.Join(homeDir, ".claude-code-env", "ccenv.log")
+	// 设置脱敏规则
+	SetRedaction(options.Secrets, options.RedactPatterns)
 
-	// 确保目录存在
-	err = os.MkdirAll(filepath.Dir(logPath), 0755)
+	// 解析日志文件路径
+	logPath, err := ResolveLogPath(options.Path)
 	if err != nil {
-		return fmt.Errorf("创建日志目录失败: %v", err)
+		return err
 	}
 
-	// 打开日志文件
-	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	// 打开支持轮转的日志文件
+	logFile, err := newRotatingWriter(logPath, rotateOptions{
+		maxSize:    int64(options.MaxSizeMB) * 1024 * 1024,
+		daily:      options.RotateDaily,
+		maxBackups: options.MaxBackups,
+		maxAge:     time.Duration(options.MaxAgeDays) * 24 * time.Hour,
+		compress:   options.Compress,
+	})
 	if err != nil {
-		return fmt.Errorf("创建日志文件失败: %v", err)
+		return err
 	}
 
-	// 创建日志器
-	output := log.New(logFile, "", log.LstdFlags)
+	// 创建日志器，JSON 格式自带时间字段，不使用标准日志前缀
+	format := strings.ToLower(options.Format)
+	flags := log.LstdFlags
+	if format == "json" {
+		flags = 0
+	} else {
+		format = "text"
+	}
+	output := log.New(logFile, "", flags)
 
+	loggerMutex.Lock()
+	previous := globalLogger
 	globalLogger = &Logger{
 		level:   level,
+		format:  format,
 		output:  output,
 		logFile: logFile,
 	}
+	loggerMutex.Unlock()
+
+	// 未调用 CloseLogger 直接重新初始化时关闭旧文件
+	if previous != nil && previous.logFile != nil {
+		previous.logFile.Close()
+	}
 
 	return nil
 }
 
 // CloseLogger 关闭日志系统
 func CloseLogger() {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
 	if globalLogger != nil && globalLogger.logFile != nil {
 		globalLogger.logFile.Close()
 	}
+	globalLogger = nil
 }
 
 // shouldLog 检查是否应该记录此级别的日志
 func shouldLog(msgLevel LogLevel) bool {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+
 	if globalLogger == nil {
 		return true // 如果未初始化，记录所有日志
 	}
 	return msgLevel >= globalLogger.level
 }
 
-// log 统一日志记录方法
-func logMessage(level LogLevel, module, message string, args ...interface{}) {
-	if !shouldLog(level) {
-		return
-	}
+// write 脱敏后按配置的格式输出日志记录，并分发给订阅者
+func write(e entry) {
+	// 脱敏可能包含敏感信息的字段
+	e.Message = Redact(e.Message)
+	e.Error = Redact(e.Error)
+	e.Path = Redact(e.Path)
 
-	levelName := levelNames[level]
-	formattedMsg := fmt.Sprintf(message, args...)
-	logLine := fmt.Sprintf("[%s] %s %s", levelName, module, formattedMsg)
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+
+	var logLine string
+	if globalLogger != nil && globalLogger.format == "json" {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		logLine = string(data)
+	} else {
+		logLine = formatText(e)
+	}
 
 	if globalLogger != nil {
 		globalLogger.output.Println(logLine)
@@ -116,6 +228,69 @@ func logMessage(level LogLevel, module, message string, args ...interface{}) {
 		// 如果日志系统未初始化，输出到标准错误
 		log.Println(logLine)
 	}
+
+	// 分发给进程内的订阅者（如管理界面的实时日志）
+	publish(e)
+}
+
+// formatText 生成文本格式的日志行：[级别] 模块 [provider] [请求ID] 消息
+func formatText(e entry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %s", e.Level, e.Module)
+	if e.Provider != "" {
+		fmt.Fprintf(&sb, " [%s]", e.Provider)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&sb, " [%s]", e.RequestID)
+	}
+	sb.WriteString(" ")
+	sb.WriteString(e.Message)
+	if e.Error != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Error)
+	}
+	if e.UpstreamRequestID != "" {
+		fmt.Fprintf(&sb, " [upstream: %s]", e.UpstreamRequestID)
+	}
+	if e.Caller != "" {
+		fmt.Fprintf(&sb, " [%s]", e.Caller)
+	}
+	return sb.String()
+}
+
+// newEntry 创建日志记录
+func newEntry(level LogLevel, module string, fields Fields, message string) entry {
+	e := entry{
+		Time:      time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+		Level:     levelNames[level],
+		Module:    module,
+		RequestID: fields.RequestID,
+		Provider:  fields.Provider,
+		Model:     fields.Model,
+		Method:    fields.Method,
+		Path:      fields.Path,
+		Status:    fields.Status,
+		Message:   message,
+
+		UpstreamRequestID: fields.UpstreamRequestID,
+	}
+	if fields.Duration > 0 {
+		e.DurationMS = float64(fields.Duration.Microseconds()) / 1000
+	}
+	return e
+}
+
+// log 统一日志记录方法
+func logMessage(level LogLevel, module, message string, args ...interface{}) {
+	LogWithFields(level, module, Fields{}, message, args...)
+}
+
+// LogWithFields 带结构化字段的日志记录
+func LogWithFields(level LogLevel, module string, fields Fields, message string, args ...interface{}) {
+	if !shouldLog(level) {
+		return
+	}
+	write(newEntry(level, module, fields, fmt.Sprintf(message, args...)))
 }
 
 // GenerateRequestID 生成请求追踪ID
@@ -127,35 +302,50 @@ func GenerateRequestID() string {
 
 // LogWithRequestID 带请求ID的日志记录
 func LogWithRequestID(level LogLevel, module, requestID, message string, args ...interface{}) {
-	if !shouldLog(level) {
+	LogWithFields(level, module, Fields{RequestID: requestID}, message, args...)
+}
+
+// LogHTTPRequest 在 DEBUG 级别记录一次上游尝试的HTTP请求日志，upstreamRequestID 为上游返回的请求ID，没有时为空
+func LogHTTPRequest(requestID, method, path string, statusCode int, duration time.Duration, provider, upstreamRequestID string) {
+	if !shouldLog(DEBUG) {
 		return
 	}
 
-	levelName := levelNames[level]
-	formattedMsg := fmt.Sprintf(message, args...)
-	logLine := fmt.Sprintf("[%s] %s [%s] %s", levelName, module, requestID, formattedMsg)
+	fields := Fields{
+		RequestID: requestID,
+		Provider:  provider,
+		Status:    statusCode,
+		Duration:  duration,
+		Method:    method,
+		Path:      path,
 
-	if globalLogger != nil {
-		globalLogger.output.Println(logLine)
-	} else {
-		log.Println(logLine)
+		UpstreamRequestID: upstreamRequestID,
 	}
+	write(newEntry(DEBUG, ModuleProxy, fields, fmt.Sprintf("%s %s -> %d (%v)", method, path, statusCode, duration)))
 }
 
-// LogHTTPRequest 记录HTTP请求日志
-func LogHTTPRequest(requestID, method, path string, statusCode int, duration time.Duration, provider string) {
-	if !shouldLog(DEBUG) {
+// requestSummaryPrefix 请求完成摘要日志的消息前缀，用于和每次上游尝试的 LogHTTPRequest 日志区分
+const requestSummaryPrefix = "请求完成 "
+
+// LogRequestSummary 在 INFO 级别记录请求完成摘要，每个客户端请求输出一条，provider 和 model 为最终处理请求的 provider 和上游模型
+// logs --stats 的请求统计来自这条日志
+func LogRequestSummary(requestID, method, path string, statusCode int, duration time.Duration, provider, model, upstreamRequestID string) {
+	if !shouldLog(INFO) {
 		return
 	}
 
-	logLine := fmt.Sprintf("[DEBUG] %s [%s] [%s] %s %s -> %d (%v)",
-		ModuleProxy, provider, requestID, method, path, statusCode, duration)
+	fields := Fields{
+		RequestID: requestID,
+		Provider:  provider,
+		Model:     model,
+		Status:    statusCode,
+		Duration:  duration,
+		Method:    method,
+		Path:      path,
 
-	if globalLogger != nil {
-		globalLogger.output.Println(logLine)
-	} else {
-		log.Println(logLine)
+		UpstreamRequestID: upstreamRequestID,
 	}
+	write(newEntry(INFO, ModuleProxy, fields, fmt.Sprintf("%s%s %s -> %d (%v)", requestSummaryPrefix, method, path, statusCode, duration)))
 }
 
 // LogError 增强的错误日志记录
@@ -164,25 +354,17 @@ func LogError(module, message string, err error, skipFrames int) {
 		return
 	}
 
+	e := newEntry(ERROR, module, Fields{}, message)
+
 	// 获取调用栈信息
-	_, file, line, ok := runtime.Caller(skipFrames + 1)
-	var location string
-	if ok {
-		location = fmt.Sprintf(" [%s:%d]", filepath.Base(file), line)
+	if _, file, line, ok := runtime.Caller(skipFrames + 1); ok {
+		e.Caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
 	}
-
-	var logLine string
 	if err != nil {
-		logLine = fmt.Sprintf("[ERROR] %s %s: %v%s", module, message, err, location)
-	} else {
-		logLine = fmt.Sprintf("[ERROR] %s %s%s", module, message, location)
+		e.Error = err.Error()
 	}
 
-	if globalLogger != nil {
-		globalLogger.output.Println(logLine)
-	} else {
-		log.Println(logLine)
-	}
+	write(e)
 }
 
 // Debug 记录 DEBUG 级别日志
@@ -220,6 +402,26 @@ func ErrorWithRequestID(module, requestID, message string, args ...interface{})
 	LogWithRequestID(ERROR, module, requestID, message, args...)
 }
 
+// DebugWithFields 带结构化字段的DEBUG日志
+func DebugWithFields(module string, fields Fields, message string, args ...interface{}) {
+	LogWithFields(DEBUG, module, fields, message, args...)
+}
+
+// InfoWithFields 带结构化字段的INFO日志
+func InfoWithFields(module string, fields Fields, message string, args ...interface{}) {
+	LogWithFields(INFO, module, fields, message, args...)
+}
+
+// WarnWithFields 带结构化字段的WARN日志
+func WarnWithFields(module string, fields Fields, message string, args ...interface{}) {
+	LogWithFields(WARN, module, fields, message, args...)
+}
+
+// ErrorWithFields 带结构化字段的ERROR日志
+func ErrorWithFields(module string, fields Fields, message string, args ...interface{}) {
+	LogWithFields(ERROR, module, fields, message, args...)
+}
+
 // ErrorWithStack 带调用栈的错误日志
 func ErrorWithStack(module, message string, err error) {
 	LogError(module, message, err, 1)
@@ -232,4 +434,5 @@ const (
 	ModuleExecutor = "EXECUTOR"
 	ModuleServer   = "SERVER"
 	ModuleProvider = "PROVIDER"
+	ModuleBudget   = "BUDGET"
 )
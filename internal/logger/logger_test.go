@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogHTTPRequestFormats(t *testing.T) {
+	defer func(previous *Logger) { globalLogger = previous }(globalLogger)
+
+	var buf bytes.Buffer
+	globalLogger = &Logger{level: DEBUG, format: "text", output: log.New(&buf, "", 0)}
+	LogHTTPRequest("abcd1234", "POST", "/v1/messages", 200, 1500*time.Millisecond, "siliconflow", "")
+	if got, want := strings.TrimSpace(buf.String()), "[DEBUG] PROXY [siliconflow] [abcd1234] POST /v1/messages -> 200 (1.5s)"; got != want {
+		t.Errorf("text line = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	globalLogger.format = "json"
+	LogHTTPRequest("abcd1234", "POST", "/v1/messages", 200, 1500*time.Millisecond, "siliconflow", "req_018abc")
+	var e entry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", buf.String(), err)
+	}
+	if e.Level != "DEBUG" || e.RequestID != "abcd1234" || e.Provider != "siliconflow" || e.Status != 200 || e.DurationMS != 1500 || e.UpstreamRequestID != "req_018abc" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+}
+
+func TestLogRequestSummary(t *testing.T) {
+	defer func(previous *Logger) { globalLogger = previous }(globalLogger)
+
+	var buf bytes.Buffer
+	globalLogger = &Logger{level: INFO, format: "text", output: log.New(&buf, "", log.LstdFlags)}
+	LogHTTPRequest("abcd1234", "POST", "/v1/messages", 529, time.Second, "kimi", "")
+	LogRequestSummary("abcd1234", "POST", "/v1/messages", 200, 1500*time.Millisecond, "siliconflow", "deepseek-v3", "")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines at INFO, want only the summary: %q", len(lines), buf.String())
+	}
+	record, ok := ParseLine(lines[0])
+	if !ok || !record.IsRequestSummary() || record.Provider != "siliconflow" || record.Status != 200 || record.Duration != 1500*time.Millisecond {
+		t.Errorf("unexpected record: %+v", record)
+	}
+}
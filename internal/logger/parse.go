@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record 表示从日志文件解析出的一条日志
+type Record struct {
+	Time      time.Time
+	Level     string
+	Module    string
+	RequestID string
+	Provider  string
+	Model     string
+	Method    string
+	Path      string
+	Status    int
+	Duration  time.Duration
+	Message   string
+	Error     string
+	Caller    string
+
+	UpstreamRequestID string
+}
+
+// IsRequestSummary 判断是否为 LogRequestSummary 输出的请求完成摘要
+func (r Record) IsRequestSummary() bool {
+	return r.Status != 0 && strings.HasPrefix(r.Message, requestSummaryPrefix)
+}
+
+// textTimeFormat 文本格式日志的时间前缀（log.LstdFlags）
+const textTimeFormat = "2006/01/02 15:04:05"
+
+var (
+	// requestIDPattern 匹配 GenerateRequestID 生成的请求ID
+	requestIDPattern = regexp.MustCompile(`^[0-9a-f]{8}$`)
+	// httpRequestPattern 匹配 LogHTTPRequest 和 LogRequestSummary 的文本消息：[请求完成 ]METHOD PATH -> STATUS (DURATION)
+	httpRequestPattern = regexp.MustCompile(`^(?:` + requestSummaryPrefix + `)?(\S+) (\S+) -> (\d+) \(([^)]+)\)$`)
+	// upstreamRequestIDPattern 匹配文本消息末尾的上游请求ID
+	upstreamRequestIDPattern = regexp.MustCompile(` \[upstream: ([^\]]+)\]$`)
+)
+
+// ParseLine 解析一行日志，支持文本和 JSON 两种格式，无法识别的行（如多行消息的后续行）返回 false
+func ParseLine(line string) (Record, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "{") {
+		return parseJSONLine(line)
+	}
+	return parseTextLine(line)
+}
+
+// parseJSONLine 解析 JSON 格式的日志行
+func parseJSONLine(line string) (Record, bool) {
+	var e entry
+	if err := json.Unmarshal([]byte(line), &e); err != nil || e.Level == "" {
+		return Record{}, false
+	}
+
+	record := Record{
+		Level:     e.Level,
+		Module:    e.Module,
+		RequestID: e.RequestID,
+		Provider:  e.Provider,
+		Model:     e.Model,
+		Method:    e.Method,
+		Path:      e.Path,
+		Status:    e.Status,
+		Duration:  time.Duration(e.DurationMS * float64(time.Millisecond)),
+		Message:   e.Message,
+		Error:     e.Error,
+		Caller:    e.Caller,
+
+		UpstreamRequestID: e.UpstreamRequestID,
+	}
+	record.Time, _ = time.Parse("2006-01-02T15:04:05.000Z07:00", e.Time)
+	return record, true
+}
+
+// parseTextLine 解析文本格式的日志行：时间 [级别] 模块 [provider] [请求ID] 消息
+func parseTextLine(line string) (Record, bool) {
+	var record Record
+
+	if len(line) < len(textTimeFormat)+1 {
+		return record, false
+	}
+	t, err := time.ParseInLocation(textTimeFormat, line[:len(textTimeFormat)], time.Local)
+	if err != nil {
+		return record, false
+	}
+	record.Time = t
+	rest := strings.TrimPrefix(line[len(textTimeFormat):], " ")
+
+	// 级别
+	level, rest, ok := cutBracket(rest)
+	if _, known := levelValues[level]; !ok || !known {
+		return record, false
+	}
+	record.Level = level
+
+	// 模块
+	record.Module, rest, _ = strings.Cut(rest, " ")
+
+	// provider 和请求ID 前缀，只有一个前缀时按格式区分
+	var prefixes []string
+	for len(prefixes) < 2 {
+		value, remaining, ok := cutBracket(rest)
+		if !ok {
+			break
+		}
+		prefixes = append(prefixes, value)
+		rest = remaining
+	}
+	switch {
+	case len(prefixes) == 2:
+		record.Provider, record.RequestID = prefixes[0], prefixes[1]
+	case len(prefixes) == 1 && requestIDPattern.MatchString(prefixes[0]):
+		record.RequestID = prefixes[0]
+	case len(prefixes) == 1:
+		record.Provider = prefixes[0]
+	}
+	if match := upstreamRequestIDPattern.FindStringSubmatchIndex(rest); match != nil {
+		record.UpstreamRequestID = rest[match[2]:match[3]]
+		rest = rest[:match[0]]
+	}
+	record.Message = rest
+
+	// 还原 LogHTTPRequest 和 LogRequestSummary 的状态码和耗时
+	if match := httpRequestPattern.FindStringSubmatch(rest); match != nil {
+		if duration, err := time.ParseDuration(match[4]); err == nil {
+			record.Method, record.Path = match[1], match[2]
+			record.Status, _ = strconv.Atoi(match[3])
+			record.Duration = duration
+		}
+	}
+	return record, true
+}
+
+// cutBracket 从字符串开头取出 [value]，返回 value 和剩余部分
+func cutBracket(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return "", s, false
+	}
+	end := strings.Index(s, "] ")
+	if end < 0 {
+		if strings.HasSuffix(s, "]") {
+			return s[1 : len(s)-1], "", true
+		}
+		return "", s, false
+	}
+	return s[1:end], s[end+2:], true
+}
@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Record
+	}{
+		{
+			line: "2025/06/01 10:00:00 [DEBUG] PROXY [siliconflow] [abcd1234] POST /v1/messages -> 200 (1.5s)",
+			want: Record{Level: "DEBUG", Module: "PROXY", Provider: "siliconflow", RequestID: "abcd1234",
+				Method: "POST", Path: "/v1/messages", Status: 200, Duration: 1500 * time.Millisecond,
+				Message: "POST /v1/messages -> 200 (1.5s)"},
+		},
+		{
+			line: "2025/06/01 10:00:00 [DEBUG] PROXY [kimi] [abcd1234] POST /v1/messages -> 529 (300ms) [upstream: req_018abc]",
+			want: Record{Level: "DEBUG", Module: "PROXY", Provider: "kimi", RequestID: "abcd1234",
+				Method: "POST", Path: "/v1/messages", Status: 529, Duration: 300 * time.Millisecond,
+				Message: "POST /v1/messages -> 529 (300ms)", UpstreamRequestID: "req_018abc"},
+		},
+		{
+			line: "2025/06/01 10:00:00 [INFO] PROXY [abcd1234] 请求模型: claude",
+			want: Record{Level: "INFO", Module: "PROXY", RequestID: "abcd1234", Message: "请求模型: claude"},
+		},
+		{
+			line: "2025/06/01 10:00:00 [WARN] PROVIDER [kimi] 连续失败",
+			want: Record{Level: "WARN", Module: "PROVIDER", Provider: "kimi", Message: "连续失败"},
+		},
+		{
+			line: `{"time":"2025-06-01T10:00:00.000+08:00","level":"ERROR","module":"PROXY","request_id":"abcd1234","status":502,"duration_ms":250,"message":"上游错误","error":"EOF"}`,
+			want: Record{Level: "ERROR", Module: "PROXY", RequestID: "abcd1234", Status: 502,
+				Duration: 250 * time.Millisecond, Message: "上游错误", Error: "EOF"},
+		},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseLine(tt.line)
+		if !ok {
+			t.Errorf("ParseLine(%q) failed", tt.line)
+			continue
+		}
+		if got.Time.IsZero() {
+			t.Errorf("ParseLine(%q) has zero time", tt.line)
+		}
+		got.Time = time.Time{}
+		if got != tt.want {
+			t.Errorf("ParseLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+
+	if _, ok := ParseLine("  continuation of a multi-line message"); ok {
+		t.Error("continuation line should not be parsed")
+	}
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedMark 替换敏感信息的标记
+const redactedMark = "[REDACTED]"
+
+// minSecretLength 配置中的敏感值至少达到该长度才按原值替换，避免过短的值误伤正常日志
+const minSecretLength = 6
+
+// builtinPatterns 内置的敏感信息模式，第 1 个分组（如果有）会被保留
+var builtinPatterns = []*regexp.Regexp{
+	// Anthropic / OpenAI 风格的 API Key，如 sk-ant-api03-xxx
+	regexp.MustCompile(`sk-[A-Za-z0-9_\-]{8,}`),
+	// Bearer Token
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/\-]{8,}=*`),
+	// 请求头、JSON 或 URL 参数中的 key/token/secret/password 值
+	regexp.MustCompile(`(?i)((?:x-api-key|api[_-]?key|auth[_-]?token|access[_-]?token|secret|password)["']?\s*[:=]\s*["']?)[^\s"'&,;]{6,}`),
+}
+
+// redaction 当前生效的脱敏规则，配置重载时替换
+var redaction struct {
+	secrets  []string         // 配置中的敏感值，按长度从长到短排序
+	patterns []*regexp.Regexp // 配置的额外模式
+	mutex    sync.RWMutex
+}
+
+// SetRedaction 设置需要脱敏的敏感值和额外的正则表达式模式，无效的模式会被忽略
+func SetRedaction(secrets []string, patterns []string) {
+	var values []string
+	for _, secret := range secrets {
+		if len(secret) >= minSecretLength {
+			values = append(values, secret)
+		}
+	}
+	// 先替换较长的值，避免较短的值是其子串时替换不完整
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		if re, err := regexp.Compile(pattern); err == nil {
+			compiled = append(compiled, re)
+		}
+	}
+
+	redaction.mutex.Lock()
+	redaction.secrets = values
+	redaction.patterns = compiled
+	redaction.mutex.Unlock()
+}
+
+// Redact 替换字符串中的敏感信息：配置中的密钥原值、内置的常见密钥模式和配置的额外模式
+// 日志会自动脱敏，请求录制、管理接口等其他输出敏感数据的地方需要显式调用
+func Redact(s string) string {
+	if s == "" {
+		return s
+	}
+
+	redaction.mutex.RLock()
+	secrets, patterns := redaction.secrets, redaction.patterns
+	redaction.mutex.RUnlock()
+
+	for _, secret := range secrets {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, redactedMark)
+		}
+	}
+	for _, re := range builtinPatterns {
+		s = replacePattern(re, s)
+	}
+	for _, re := range patterns {
+		s = replacePattern(re, s)
+	}
+	return s
+}
+
+// replacePattern 替换匹配的内容，模式包含分组时保留第 1 个分组（如字段名）
+func replacePattern(re *regexp.Regexp, s string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, redactedMark)
+	}
+	return re.ReplaceAllString(s, "${1}"+redactedMark)
+}
@@ -0,0 +1,277 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat 轮转文件名中的时间格式，如 ccenv-2025-06-01T10-00-00.000.log
+const rotatedTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotateOptions 日志轮转选项
+type rotateOptions struct {
+	maxSize    int64 // 单个文件最大字节数，0 表示不按大小轮转
+	daily      bool  // 是否按天轮转
+	maxBackups int   // 保留的轮转文件数，0 表示不限制
+	maxAge     time.Duration
+	compress   bool // 是否 gzip 压缩轮转文件
+}
+
+// rotatingWriter 支持按大小和按天轮转的日志文件
+type rotatingWriter struct {
+	path    string
+	options rotateOptions
+	file    *os.File
+	size    int64
+	day     string // 当前文件对应的日期
+	mutex   sync.Mutex
+	cleanup sync.Mutex // 保证同一时间只有一个压缩和清理任务
+}
+
+// newRotatingWriter 打开日志文件，文件已存在时追加写入
+func newRotatingWriter(path string, options rotateOptions) (*rotatingWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %v", err)
+	}
+
+	w := &rotatingWriter{path: path, options: options}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open 打开当前日志文件
+func (w *rotatingWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("创建日志文件失败: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取日志文件信息失败: %v", err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+	// 按文件修改时间确定日期，使跨天重启后能正确轮转前一天的日志
+	w.day = info.ModTime().Format("2006-01-02")
+	if info.Size() == 0 {
+		w.day = time.Now().Format("2006-01-02")
+	}
+	return nil
+}
+
+// Write 写入日志，写入前检查是否需要轮转
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	today := time.Now().Format("2006-01-02")
+	needRotate := w.size > 0 && ((w.options.daily && w.day != today) ||
+		(w.options.maxSize > 0 && w.size+int64(len(p)) > w.options.maxSize))
+	if needRotate {
+		if err := w.rotate(); err != nil {
+			// 轮转失败时继续写入当前文件，避免丢失日志
+			fmt.Fprintf(os.Stderr, "日志轮转失败: %v\n", err)
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	w.day = today
+	return n, err
+}
+
+// rotate 将当前文件重命名为带时间戳的轮转文件并打开新文件，压缩和清理在后台进行
+func (w *rotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	rotatedPath := rotatedName(w.path, time.Now())
+	if err := os.Rename(w.path, rotatedPath); err != nil {
+		// 重命名失败时重新打开原文件继续写入
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	go w.postRotate(rotatedPath)
+	return nil
+}
+
+// Close 关闭日志文件
+func (w *rotatingWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// postRotate 压缩刚轮转的文件，并按保留数量和时间清理旧文件
+func (w *rotatingWriter) postRotate(rotatedPath string) {
+	w.cleanup.Lock()
+	defer w.cleanup.Unlock()
+
+	if w.options.compress {
+		if err := compressFile(rotatedPath); err != nil {
+			fmt.Fprintf(os.Stderr, "压缩日志文件失败: %v\n", err)
+		}
+	}
+
+	rotated, err := RotatedFiles(w.path)
+	if err != nil {
+		return
+	}
+
+	// rotated 按时间从旧到新排序
+	for i, name := range rotated {
+		expiredByCount := w.options.maxBackups > 0 && len(rotated)-i > w.options.maxBackups
+		expiredByAge := false
+		if w.options.maxAge > 0 {
+			if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > w.options.maxAge {
+				expiredByAge = true
+			}
+		}
+		if expiredByCount || expiredByAge {
+			os.Remove(name)
+		}
+	}
+}
+
+// compressFile 将文件压缩为 .gz 并删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path+".gz"); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// rotatedName 生成轮转文件名：ccenv.log -> ccenv-<时间>.log
+func rotatedName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.Format(rotatedTimeFormat), ext)
+}
+
+// RotatedFiles 返回日志文件的所有轮转文件（包括 .gz），按时间从旧到新排序
+func RotatedFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := filepath.Base(strings.TrimSuffix(path, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		stamp = strings.TrimPrefix(stamp, prefix)
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil {
+			continue
+		}
+		rotated = append(rotated, filepath.Join(filepath.Dir(path), name))
+	}
+
+	// 时间格式按字典序即为时间顺序
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// LogFiles 返回日志文件及其所有轮转文件，按时间从旧到新排序，当前日志文件在最后
+func LogFiles(path string) ([]string, error) {
+	files, err := RotatedFiles(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// OpenLogFile 打开日志文件，.gz 文件自动解压
+func OpenLogFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("解压日志文件 %s 失败: %v", path, err)
+	}
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+// gzipFile 关闭时同时关闭解压器和底层文件
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close 关闭解压器和文件
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriterRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ccenv.log")
+	w, err := newRotatingWriter(path, rotateOptions{maxSize: 10, maxBackups: 2, compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"line-one\n", "line-two\n", "line-three\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// 轮转文件名精确到毫秒，避免同名
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 等待后台压缩和清理完成
+	var files []string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		files, err = LogFiles(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 3 && strings.HasSuffix(files[0], ".gz") && strings.HasSuffix(files[1], ".gz") {
+			break
+		}
+	}
+	if len(files) != 3 || files[len(files)-1] != path {
+		t.Fatalf("LogFiles = %v, want 2 rotated files followed by %s", files, path)
+	}
+
+	var all strings.Builder
+	for _, file := range files {
+		if file != path && !strings.HasSuffix(file, ".gz") {
+			t.Errorf("rotated file %s not compressed", file)
+		}
+		reader, err := OpenLogFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(&all, reader)
+		reader.Close()
+	}
+	if got, want := all.String(), "line-one\nline-two\nline-three\n"; got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("current log file missing: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recentCapacity 保留在内存中的最近日志条数，新的订阅者可以先获取这些日志
+const recentCapacity = 500
+
+// Subscription 进程内的日志订阅，C 中依次收到写入日志文件的每条日志（已脱敏）
+// 订阅者处理不及时、缓冲区已满时丢弃新的日志，不阻塞日志写入
+type Subscription struct {
+	C       <-chan Record
+	ch      chan Record
+	dropped atomic.Int64
+}
+
+// subscribers 当前的订阅者和最近的日志，配置重载重新初始化日志系统时保持不变
+var subscribers struct {
+	subs   map[*Subscription]struct{}
+	recent []Record // 环形缓冲
+	next   int
+	mutex  sync.Mutex
+}
+
+// Subscribe 订阅日志，buffer 为缓冲的日志条数，使用完毕后需要调用 Close
+func Subscribe(buffer int) *Subscription {
+	ch := make(chan Record, buffer)
+	sub := &Subscription{C: ch, ch: ch}
+
+	subscribers.mutex.Lock()
+	if subscribers.subs == nil {
+		subscribers.subs = make(map[*Subscription]struct{})
+	}
+	subscribers.subs[sub] = struct{}{}
+	subscribers.mutex.Unlock()
+	return sub
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	subscribers.mutex.Lock()
+	defer subscribers.mutex.Unlock()
+	if _, exists := subscribers.subs[s]; exists {
+		delete(subscribers.subs, s)
+		close(s.ch)
+	}
+}
+
+// TakeDropped 返回自上次调用以来因缓冲区已满而丢弃的日志条数
+func (s *Subscription) TakeDropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Recent 返回最近写入的日志，按时间从旧到新排列，最多 recentCapacity 条
+func Recent() []Record {
+	subscribers.mutex.Lock()
+	defer subscribers.mutex.Unlock()
+
+	records := make([]Record, 0, len(subscribers.recent))
+	if len(subscribers.recent) == recentCapacity {
+		records = append(records, subscribers.recent[subscribers.next:]...)
+		return append(records, subscribers.recent[:subscribers.next]...)
+	}
+	return append(records, subscribers.recent...)
+}
+
+// publish 将日志记录分发给所有订阅者
+func publish(e entry) {
+	record := Record{
+		Level:     e.Level,
+		Module:    e.Module,
+		RequestID: e.RequestID,
+		Provider:  e.Provider,
+		Model:     e.Model,
+		Method:    e.Method,
+		Path:      e.Path,
+		Status:    e.Status,
+		Duration:  time.Duration(e.DurationMS * float64(time.Millisecond)),
+		Message:   e.Message,
+		Error:     e.Error,
+		Caller:    e.Caller,
+
+		UpstreamRequestID: e.UpstreamRequestID,
+	}
+	record.Time, _ = time.Parse("2006-01-02T15:04:05.000Z07:00", e.Time)
+
+	subscribers.mutex.Lock()
+	defer subscribers.mutex.Unlock()
+
+	if len(subscribers.recent) < recentCapacity {
+		subscribers.recent = append(subscribers.recent, record)
+	} else {
+		subscribers.recent[subscribers.next] = record
+		subscribers.next = (subscribers.next + 1) % recentCapacity
+	}
+
+	for sub := range subscribers.subs {
+		select {
+		case sub.ch <- record:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	defer func(previous *Logger) { globalLogger = previous }(globalLogger)
+	globalLogger = &Logger{level: INFO, format: "text", output: log.New(&bytes.Buffer{}, "", 0)}
+
+	sub := Subscribe(2)
+	defer sub.Close()
+
+	Debug(ModuleProxy, "不输出的 DEBUG 日志")
+	InfoWithFields(ModuleProvider, Fields{RequestID: "abcd1234", Provider: "p"}, "第 %d 条", 1)
+	Warn(ModuleProxy, "第 2 条")
+	Error(ModuleProxy, "第 3 条")
+
+	first := <-sub.C
+	if first.Level != "INFO" || first.Module != ModuleProvider || first.RequestID != "abcd1234" || first.Provider != "p" || first.Message != "第 1 条" || first.Time.IsZero() {
+		t.Errorf("first record = %+v", first)
+	}
+	if second := <-sub.C; second.Message != "第 2 条" {
+		t.Errorf("second record = %+v", second)
+	}
+	// 缓冲区只有 2 条，第 3 条被丢弃
+	if dropped := sub.TakeDropped(); dropped != 1 {
+		t.Errorf("TakeDropped() = %d, want 1", dropped)
+	}
+
+	recent := Recent()
+	if len(recent) < 3 || recent[len(recent)-1].Message != "第 3 条" {
+		t.Errorf("Recent() last = %+v", recent[len(recent)-1])
+	}
+
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("channel should be closed after Close")
+	}
+}
@@ -0,0 +1,100 @@
+package logview
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/timeparse"
+)
+
+// 日志级别的顺序，用于按最低级别过滤
+var levelOrder = map[string]int{"DEBUG": 0, "INFO": 1, "WARN": 2, "ERROR": 3}
+
+// Filter 日志过滤条件，零值表示不过滤
+type Filter struct {
+	Level     string         // 最低级别，如 WARN 表示只显示 WARN 和 ERROR
+	Modules   []string       // 模块名，匹配其中任意一个即可
+	Provider  string         // provider 名称
+	RequestID string         // 请求ID，同时匹配上游返回的请求ID
+	Since     time.Time      // 起始时间（包含）
+	Until     time.Time      // 结束时间（不包含）
+	Grep      *regexp.Regexp // 匹配原始日志行的正则表达式
+}
+
+// NewFilter 校验并创建过滤条件
+func NewFilter(level string, modules []string, provider, requestID, since, until, grep string) (*Filter, error) {
+	filter := &Filter{Provider: provider, RequestID: requestID}
+
+	if level != "" {
+		filter.Level = strings.ToUpper(level)
+		if _, exists := levelOrder[filter.Level]; !exists {
+			return nil, fmt.Errorf("不支持的日志级别 %q，可选: DEBUG, INFO, WARN, ERROR", level)
+		}
+	}
+	for _, module := range modules {
+		if module = strings.TrimSpace(module); module != "" {
+			filter.Modules = append(filter.Modules, strings.ToUpper(module))
+		}
+	}
+
+	var err error
+	now := time.Now()
+	if filter.Since, err = timeparse.Parse(since, now); err != nil {
+		return nil, err
+	}
+	if filter.Until, err = timeparse.Parse(until, now); err != nil {
+		return nil, err
+	}
+
+	if grep != "" {
+		if filter.Grep, err = regexp.Compile(grep); err != nil {
+			return nil, fmt.Errorf("无效的 --grep 表达式: %v", err)
+		}
+	}
+	return filter, nil
+}
+
+// IsEmpty 是否没有任何过滤条件
+func (f *Filter) IsEmpty() bool {
+	return f.Level == "" && len(f.Modules) == 0 && f.Provider == "" && f.RequestID == "" &&
+		f.Since.IsZero() && f.Until.IsZero() && f.Grep == nil
+}
+
+// Match 判断日志是否满足过滤条件，line 为原始日志行
+func (f *Filter) Match(record logger.Record, line string) bool {
+	if f.Level != "" && levelOrder[record.Level] < levelOrder[f.Level] {
+		return false
+	}
+	if len(f.Modules) > 0 && !contains(f.Modules, record.Module) {
+		return false
+	}
+	if f.Provider != "" && record.Provider != f.Provider {
+		return false
+	}
+	if f.RequestID != "" && record.RequestID != f.RequestID && record.UpstreamRequestID != f.RequestID {
+		return false
+	}
+	if !f.Since.IsZero() && record.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !record.Time.Before(f.Until) {
+		return false
+	}
+	if f.Grep != nil && !f.Grep.MatchString(line) {
+		return false
+	}
+	return true
+}
+
+// contains 判断切片中是否包含指定值
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package logview
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+func TestNewFilter(t *testing.T) {
+	filter, err := NewFilter("warn", []string{"proxy", " ", " provider "}, "sf", "a1b2c3d4", "2025-06-01", "2025-06-02 10:00", "429|529")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Level != "WARN" || strings.Join(filter.Modules, ",") != "PROXY,PROVIDER" || filter.Grep == nil {
+		t.Errorf("filter = %+v", filter)
+	}
+	if filter.Since.Format("2006-01-02 15:04") != "2025-06-01 00:00" || filter.Until.Format("2006-01-02 15:04") != "2025-06-02 10:00" {
+		t.Errorf("since = %v, until = %v", filter.Since, filter.Until)
+	}
+	if filter.IsEmpty() {
+		t.Error("filter should not be empty")
+	}
+
+	// 相对时间从当前时间倒推
+	filter, err = NewFilter("", nil, "", "", "2h", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ago := time.Since(filter.Since); ago < 2*time.Hour || ago > 2*time.Hour+time.Minute {
+		t.Errorf("since 2h = %v ago", ago)
+	}
+
+	if filter, _ := NewFilter("", nil, "", "", "", "", ""); !filter.IsEmpty() {
+		t.Errorf("filter without conditions = %+v", filter)
+	}
+
+	invalid := []struct {
+		name                      string
+		level, since, until, grep string
+	}{
+		{"level", "TRACE", "", "", ""},
+		{"since", "", "yesterday", "", ""},
+		{"until", "", "", "2025/06/01", ""},
+		{"grep", "", "", "", "("},
+	}
+	for _, tt := range invalid {
+		if _, err := NewFilter(tt.level, nil, "", "", tt.since, tt.until, tt.grep); err == nil {
+			t.Errorf("invalid %s accepted", tt.name)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, _ := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		return parsed
+	}
+	record := logger.Record{
+		Time:              at("2025-06-01 10:00"),
+		Level:             "WARN",
+		Module:            "PROXY",
+		Provider:          "sf",
+		RequestID:         "a1b2c3d4",
+		UpstreamRequestID: "req_upstream",
+	}
+	line := "2025/06/01 10:00:00 [WARN] PROXY [sf] [a1b2c3d4] 模型 glm 限流或过载 (429)"
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"level below", Filter{Level: "INFO"}, true},
+		{"level equal", Filter{Level: "WARN"}, true},
+		{"level above", Filter{Level: "ERROR"}, false},
+		{"module", Filter{Modules: []string{"PROVIDER", "PROXY"}}, true},
+		{"other module", Filter{Modules: []string{"CONFIG"}}, false},
+		{"provider", Filter{Provider: "sf"}, true},
+		{"other provider", Filter{Provider: "kimi"}, false},
+		{"request id", Filter{RequestID: "a1b2c3d4"}, true},
+		{"upstream request id", Filter{RequestID: "req_upstream"}, true},
+		{"other request id", Filter{RequestID: "ffffffff"}, false},
+		{"since inclusive", Filter{Since: at("2025-06-01 10:00")}, true},
+		{"since after", Filter{Since: at("2025-06-01 10:01")}, false},
+		{"until exclusive", Filter{Until: at("2025-06-01 10:00")}, false},
+		{"until after", Filter{Until: at("2025-06-01 10:01")}, true},
+		{"all conditions", Filter{Level: "WARN", Modules: []string{"PROXY"}, Provider: "sf", RequestID: "a1b2c3d4", Since: at("2025-06-01 09:00"), Until: at("2025-06-01 11:00")}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(record, line); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// --grep 匹配原始日志行
+	for pattern, want := range map[string]bool{"429": true, `\(5\d\d\)`: false, "限流": true} {
+		filter, err := NewFilter("", nil, "", "", "", "", pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filter.Match(record, line); got != want {
+			t.Errorf("grep %q: Match = %v, want %v", pattern, got, want)
+		}
+	}
+}
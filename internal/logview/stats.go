@@ -0,0 +1,120 @@
+package logview
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+// ProviderStats 单个 provider 的请求统计
+type ProviderStats struct {
+	Provider  string
+	Requests  int
+	Errors    int // 状态码 >= 400 的请求数
+	latencies []time.Duration
+}
+
+// Percentile 返回延迟的 p 分位数（0-100），采用最近秩法
+func (s *ProviderStats) Percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(s.latencies))))
+	if rank < 1 {
+		rank = 1
+	}
+	return s.latencies[rank-1]
+}
+
+// Stats 从日志中汇总的统计信息
+type Stats struct {
+	Levels    map[string]int // 各级别的日志条数
+	Providers []*ProviderStats
+	Total     *ProviderStats
+}
+
+// CollectStats 汇总日志文件（包括轮转文件）中匹配过滤条件的请求日志
+// 请求统计来自 LogRequestSummary 输出的请求完成摘要（INFO 级别），每个客户端请求一条
+func CollectStats(path string, filter *Filter) (*Stats, error) {
+	files, err := logger.LogFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取日志目录失败: %v", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("日志文件不存在: %s", path)
+	}
+
+	stats := &Stats{Levels: make(map[string]int), Total: &ProviderStats{Provider: "合计"}}
+	providers := make(map[string]*ProviderStats)
+
+	err = scanFiles(files, func(line string) {
+		record, ok := logger.ParseLine(line)
+		if !ok || (filter != nil && !filter.Match(record, line)) {
+			return
+		}
+		stats.Levels[record.Level]++
+
+		if !record.IsRequestSummary() {
+			return
+		}
+		name := record.Provider
+		if name == "" {
+			name = "<无>"
+		}
+		ps, exists := providers[name]
+		if !exists {
+			ps = &ProviderStats{Provider: name}
+			providers[name] = ps
+		}
+		for _, s := range []*ProviderStats{ps, stats.Total} {
+			s.Requests++
+			if record.Status >= 400 {
+				s.Errors++
+			}
+			s.latencies = append(s.latencies, record.Duration)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ps := range providers {
+		stats.Providers = append(stats.Providers, ps)
+	}
+	sort.Slice(stats.Providers, func(i, j int) bool { return stats.Providers[i].Provider < stats.Providers[j].Provider })
+	for _, s := range append(stats.Providers, stats.Total) {
+		sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	}
+	return stats, nil
+}
+
+// WriteTable 以表格形式输出统计信息
+func (s *Stats) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "日志条数: DEBUG %d, INFO %d, WARN %d, ERROR %d\n\n",
+		s.Levels["DEBUG"], s.Levels["INFO"], s.Levels["WARN"], s.Levels["ERROR"])
+
+	if s.Total.Requests == 0 {
+		fmt.Fprintln(w, "没有找到请求日志，请求完成摘要在 INFO 级别输出，请确认 LOGGING_LEVEL 不高于 INFO")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\t请求数\t错误数\t错误率\tP50\tP90\tP99\t最大")
+	for _, ps := range append(s.Providers, s.Total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%s\t%s\t%s\t%s\n",
+			ps.Provider, ps.Requests, ps.Errors, float64(ps.Errors)*100/float64(ps.Requests),
+			formatDuration(ps.Percentile(50)), formatDuration(ps.Percentile(90)),
+			formatDuration(ps.Percentile(99)), formatDuration(ps.Percentile(100)))
+	}
+	return tw.Flush()
+}
+
+// formatDuration 格式化延迟，保留到毫秒
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,54 @@
+package logview
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ccenv.log")
+	lines := []string{
+		"2025/06/01 10:00:00 [INFO] PROXY [sf] [a1b2c3d4] 请求模型: claude",
+		"2025/06/01 10:00:01 [DEBUG] PROXY [kimi] [a1b2c3d4] POST /v1/messages -> 529 (500ms)",
+		"2025/06/01 10:00:01 [DEBUG] PROXY [sf] [a1b2c3d4] POST /v1/messages -> 200 (900ms)",
+		"2025/06/01 10:00:01 [INFO] PROXY [sf] [a1b2c3d4] 请求完成 POST /v1/messages -> 200 (1s)",
+		`{"time":"2025-06-01T10:00:02.000+08:00","level":"INFO","module":"PROXY","request_id":"b1b2c3d4","provider":"sf","method":"POST","path":"/v1/messages","status":200,"duration_ms":3000,"message":"请求完成 POST /v1/messages -> 200 (3s)"}`,
+		"2025/06/01 10:00:03 [INFO] PROXY [kimi] [c1b2c3d4] 请求完成 POST /v1/messages -> 502 (200ms)",
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := CollectStats(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Levels["DEBUG"] != 2 || stats.Levels["INFO"] != 4 {
+		t.Errorf("levels = %v", stats.Levels)
+	}
+	if len(stats.Providers) != 2 || stats.Providers[0].Provider != "kimi" || stats.Providers[0].Errors != 1 {
+		t.Fatalf("providers = %+v", stats.Providers)
+	}
+	sf := stats.Providers[1]
+	if sf.Requests != 2 || sf.Percentile(50) != time.Second || sf.Percentile(99) != 3*time.Second {
+		t.Errorf("sf stats = %+v", sf)
+	}
+	if stats.Total.Requests != 3 || stats.Total.Errors != 1 {
+		t.Errorf("total = %+v", stats.Total)
+	}
+
+	filter, err := NewFilter("", nil, "", "a1b2c3d4", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err = CollectStats(path, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total.Requests != 1 || stats.Levels["INFO"] != 2 {
+		t.Errorf("filtered stats = %+v, levels %v", stats.Total, stats.Levels)
+	}
+}
@@ -0,0 +1,211 @@
+package logview
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+// followInterval 跟踪模式下检查日志文件变化的间隔
+const followInterval = 500 * time.Millisecond
+
+// 终端颜色
+const (
+	colorReset  = "\033[0m"
+	colorGray   = "\033[90m"
+	colorYellow = "\033[33m"
+	colorRed    = "\033[31m"
+)
+
+// Options 日志查看选项
+type Options struct {
+	Lines  int  // 显示最后多少条匹配的日志，0 表示全部
+	Follow bool // 是否持续跟踪新日志
+	Color  bool // 是否按级别着色
+	Filter *Filter
+}
+
+// matcher 逐行匹配日志，无法解析的行（多行消息的后续行）沿用上一行的匹配结果
+type matcher struct {
+	filter    *Filter
+	lastMatch bool
+}
+
+// match 判断日志行是否应该输出
+func (m *matcher) match(line string) (logger.Record, bool) {
+	record, ok := logger.ParseLine(line)
+	if !ok {
+		return record, m.lastMatch
+	}
+	m.lastMatch = m.filter == nil || m.filter.Match(record, line)
+	return record, m.lastMatch
+}
+
+// Show 按时间顺序输出日志文件（包括轮转文件）中匹配的日志，Follow 为 true 时继续跟踪当前日志文件
+func Show(path string, options Options, w io.Writer) error {
+	files, err := logger.LogFiles(path)
+	if err != nil {
+		return fmt.Errorf("读取日志目录失败: %v", err)
+	}
+	if len(files) == 0 && !options.Follow {
+		return fmt.Errorf("日志文件不存在: %s\n提示：请先运行 'ccenv start' 或 'ccenv code' 生成日志", path)
+	}
+
+	m := &matcher{filter: options.Filter}
+	output := func(record logger.Record, line string) {
+		fmt.Fprintln(w, colorize(record, line, options.Color))
+	}
+
+	// 只保留最后 Lines 条匹配的日志
+	var tail []string
+	var records []logger.Record
+	err = scanFiles(files, func(line string) {
+		record, matched := m.match(line)
+		if !matched {
+			return
+		}
+		if options.Lines <= 0 {
+			output(record, line)
+			return
+		}
+		tail = append(tail, line)
+		records = append(records, record)
+		if len(tail) > options.Lines {
+			tail, records = tail[1:], records[1:]
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for i, line := range tail {
+		output(records[i], line)
+	}
+
+	if !options.Follow {
+		return nil
+	}
+	return follow(path, m, output, nil)
+}
+
+// scanFiles 依次读取日志文件的每一行，.gz 文件自动解压
+func scanFiles(files []string, handle func(line string)) error {
+	for _, file := range files {
+		reader, err := logger.OpenLogFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 读取过程中被清理的轮转文件
+				continue
+			}
+			return fmt.Errorf("读取日志文件失败: %v", err)
+		}
+
+		buffered := bufio.NewReader(reader)
+		for {
+			line, err := buffered.ReadString('\n')
+			if line != "" {
+				handle(strings.TrimRight(line, "\r\n"))
+			}
+			if err != nil {
+				break
+			}
+		}
+		reader.Close()
+	}
+	return nil
+}
+
+// follow 从当前日志文件末尾开始持续输出新写入的日志，文件轮转后自动切换到新文件，直到 stop 关闭（nil 表示一直跟踪）
+func follow(path string, m *matcher, output func(logger.Record, string), stop <-chan struct{}) error {
+	var file *os.File
+	var info os.FileInfo
+	var reader *bufio.Reader
+	var partial string
+
+	// open 打开日志文件，fromEnd 为 true 时从末尾开始读取
+	open := func(fromEnd bool) {
+		f, err := os.Open(path)
+		if err != nil {
+			return
+		}
+		if fromEnd {
+			f.Seek(0, io.SeekEnd)
+		}
+		file, reader, partial = f, bufio.NewReader(f), ""
+		info, _ = f.Stat()
+	}
+
+	// drain 输出文件中所有完整的新行，不完整的行等待下次读取
+	drain := func() {
+		for {
+			line, err := reader.ReadString('\n')
+			partial += line
+			if err != nil {
+				return
+			}
+			line, partial = strings.TrimRight(partial, "\r\n"), ""
+			if record, matched := m.match(line); matched {
+				output(record, line)
+			}
+		}
+	}
+
+	open(true)
+	for {
+		select {
+		case <-stop:
+			if file != nil {
+				file.Close()
+			}
+			return nil
+		case <-time.After(followInterval):
+		}
+
+		if file == nil {
+			// 日志文件尚未创建
+			open(false)
+			continue
+		}
+
+		drain()
+
+		current, err := os.Stat(path)
+		switch {
+		case err != nil:
+			// 轮转过程中文件暂时不存在
+		case !os.SameFile(info, current):
+			// 文件已轮转，读完旧文件后切换到新文件
+			drain()
+			file.Close()
+			file = nil
+			open(false)
+		default:
+			if offset, err := file.Seek(0, io.SeekCurrent); err == nil && current.Size() < offset-int64(reader.Buffered()) {
+				// 文件被截断，从头读取
+				file.Seek(0, io.SeekStart)
+				reader.Reset(file)
+				partial = ""
+			}
+		}
+	}
+}
+
+// colorize 按日志级别为日志行着色
+func colorize(record logger.Record, line string, enabled bool) string {
+	if !enabled {
+		return line
+	}
+	switch record.Level {
+	case "DEBUG":
+		return colorGray + line + colorReset
+	case "WARN":
+		return colorYellow + line + colorReset
+	case "ERROR":
+		return colorRed + line + colorReset
+	}
+	return line
+}
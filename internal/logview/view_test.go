@@ -0,0 +1,159 @@
+package logview
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+// writeLog 写入日志文件，.gz 文件按 gzip 压缩
+func writeLog(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	data := []byte(strings.Join(lines, "\n") + "\n")
+	if strings.HasSuffix(path, ".gz") {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		data = buf.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShow(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ccenv.log")
+	writeLog(t, filepath.Join(dir, "ccenv-2025-06-01T09-00-00.000.log.gz"),
+		"2025/06/01 09:00:00 [INFO] PROXY [sf] [a1b2c3d4] 请求模型: claude",
+		"2025/06/01 09:00:01 [WARN] PROXY [sf] [a1b2c3d4] 模型 glm 限流或过载 (429)")
+	writeLog(t, filepath.Join(dir, "ccenv-2025-06-01T10-00-00.000.log"),
+		"2025/06/01 10:00:00 [ERROR] PROXY [kimi] [b1b2c3d4] 请求失败: timeout",
+		"  多行消息的后续行")
+	writeLog(t, path,
+		"2025/06/01 11:00:00 [DEBUG] CONFIG 配置未变化",
+		"  DEBUG 日志的后续行",
+		"2025/06/01 11:00:01 [INFO] PROXY [sf] [c1b2c3d4] 请求完成 POST /v1/messages -> 200 (1s)")
+	// 不是轮转文件名格式的文件不会被读取
+	writeLog(t, filepath.Join(dir, "ccenv-backup.log"), "2025/06/01 08:00:00 [ERROR] PROXY 不应读取")
+
+	show := func(options Options) []string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := Show(path, options, &out); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	}
+	filter := func(level string, modules ...string) *Filter {
+		f, err := NewFilter(level, modules, "", "", "", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	// 按时间顺序读取压缩的轮转文件、未压缩的轮转文件和当前文件
+	all := show(Options{})
+	if len(all) != 7 || !strings.Contains(all[0], "09:00:00") || !strings.Contains(all[6], "11:00:01") {
+		t.Errorf("all lines = %q", all)
+	}
+
+	// -n 只保留最后几条匹配的日志
+	if got := show(Options{Lines: 2}); len(got) != 2 || got[0] != "  DEBUG 日志的后续行" || !strings.Contains(got[1], "请求完成") {
+		t.Errorf("last 2 lines = %q", got)
+	}
+
+	// 多行消息的后续行跟随上一行的匹配结果
+	got := show(Options{Filter: filter("warn")})
+	if len(got) != 3 || !strings.Contains(got[0], "429") || !strings.Contains(got[1], "timeout") || got[2] != "  多行消息的后续行" {
+		t.Errorf("WARN and above = %q", got)
+	}
+	if got := show(Options{Lines: 1, Filter: filter("", "config")}); len(got) != 1 || got[0] != "  DEBUG 日志的后续行" {
+		t.Errorf("last CONFIG line = %q", got)
+	}
+
+	// 按级别着色
+	colored := show(Options{Color: true, Filter: filter("error")})
+	if !strings.HasPrefix(colored[0], colorRed) || !strings.HasSuffix(colored[0], colorReset) {
+		t.Errorf("colored line = %q", colored[0])
+	}
+
+	if err := Show(filepath.Join(t.TempDir(), "ccenv.log"), Options{}, &bytes.Buffer{}); err == nil {
+		t.Error("missing log file should return an error")
+	}
+}
+
+func TestFollowRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ccenv.log")
+
+	var mutex sync.Mutex
+	var lines []string
+	output := func(record logger.Record, line string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		lines = append(lines, line)
+	}
+	// waitFor 等待输出包含 want 的全部行
+	waitFor := func(want ...string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mutex.Lock()
+			got := strings.Join(lines, "\n")
+			mutex.Unlock()
+			if got == strings.Join(want, "\n") {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("followed lines = %q, want %q", got, want)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	appendLog := func(name, line string) {
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString(line)
+		file.Close()
+	}
+
+	filter, _ := NewFilter("info", nil, "", "", "", "", "")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		follow(path, &matcher{filter: filter}, output, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// 日志文件创建后从头读取，DEBUG 日志被过滤，不完整的行等待写完
+	appendLog("ccenv.log", "2025/06/01 10:00:00 [INFO] PROXY first\n2025/06/01 10:00:01 [DEBUG] PROXY hidden\n2025/06/01 10:00:02 [INFO] PROXY sec")
+	waitFor("2025/06/01 10:00:00 [INFO] PROXY first")
+	appendLog("ccenv.log", "ond\n")
+	waitFor("2025/06/01 10:00:00 [INFO] PROXY first", "2025/06/01 10:00:02 [INFO] PROXY second")
+
+	// 轮转前写入旧文件的日志读完后切换到新文件
+	appendLog("ccenv.log", "2025/06/01 10:00:03 [WARN] PROXY before rotation\n")
+	if err := os.Rename(path, filepath.Join(dir, "ccenv-2025-06-01T10-00-03.000.log")); err != nil {
+		t.Fatal(err)
+	}
+	appendLog("ccenv.log", "2025/06/01 10:00:04 [ERROR] PROXY after rotation\n")
+	waitFor("2025/06/01 10:00:00 [INFO] PROXY first", "2025/06/01 10:00:02 [INFO] PROXY second",
+		"2025/06/01 10:00:03 [WARN] PROXY before rotation", "2025/06/01 10:00:04 [ERROR] PROXY after rotation")
+}
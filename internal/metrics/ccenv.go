@@ -0,0 +1,37 @@
+package metrics
+
+// 延迟类直方图的桶（秒），覆盖从快速响应到长时间思考的请求
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// ccenv 代理的指标定义
+var (
+	// Requests 上游请求数（每次尝试计一次，包括过载重试），status 为 HTTP 状态码或 error（请求发送失败）
+	Requests = NewCounterVec("ccenv_requests_total", "Upstream requests by provider, model and status.", "provider", "model", "status")
+
+	// UpstreamLatency 上游响应头返回的耗时
+	UpstreamLatency = NewHistogramVec("ccenv_upstream_latency_seconds", "Time until upstream response headers.", latencyBuckets, "provider", "model")
+
+	// TTFT 流式响应中首个 content_block_delta 事件返回的耗时（从代理收到请求开始计算）
+	TTFT = NewHistogramVec("ccenv_ttft_seconds", "Time to first streamed content token.", latencyBuckets, "provider", "model")
+
+	// Tokens token 用量，type 为 input、output、cache_creation 或 cache_read
+	Tokens = NewCounterVec("ccenv_tokens_total", "Tokens used by provider, model and type.", "provider", "model", "type")
+
+	// ProviderCircuitOpen provider 是否因连续失败被暂时禁用（1 为禁用）
+	ProviderCircuitOpen = NewGaugeVec("ccenv_provider_circuit_open", "Whether the provider is temporarily disabled after failures.", "provider")
+
+	// ProviderFailures provider 当前的累计失败次数
+	ProviderFailures = NewGaugeVec("ccenv_provider_failures", "Current consecutive failure count of the provider.", "provider")
+
+	// InflightRequests 代理正在处理的 /v1/messages 请求数
+	InflightRequests = NewGaugeVec("ccenv_inflight_requests", "Messages requests currently being handled by the proxy.")
+
+	// QueueDepth 已发往上游、尚未收到响应头的请求数
+	QueueDepth = NewGaugeVec("ccenv_queue_depth", "Requests waiting for upstream response headers.")
+
+	// ActiveStreams 正在转发的流式响应数
+	ActiveStreams = NewGaugeVec("ccenv_active_streams", "Streaming responses currently being relayed.")
+
+	// ConfigReloads 配置重载次数，result 为 success 或 failure
+	ConfigReloads = NewCounterVec("ccenv_config_reloads_total", "Configuration reloads by result.", "result")
+)
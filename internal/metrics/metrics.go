@@ -0,0 +1,258 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector 表示可以输出 Prometheus 文本格式的指标
+type collector interface {
+	write(w io.Writer)
+}
+
+// registry 全局指标注册表，指标在进程内全局共享，配置重载时不会重置
+var registry struct {
+	collectors []collector
+	mutex      sync.Mutex
+}
+
+// register 注册指标
+func register(c collector) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.collectors = append(registry.collectors, c)
+}
+
+// WriteText 以 Prometheus 文本格式 (0.0.4) 输出所有指标
+func WriteText(w io.Writer) {
+	registry.mutex.Lock()
+	collectors := append([]collector(nil), registry.collectors...)
+	registry.mutex.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// desc 指标的公共描述
+type desc struct {
+	name       string
+	help       string
+	labelNames []string
+}
+
+// writeHeader 输出 HELP 和 TYPE 行
+func (d *desc) writeHeader(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, metricType)
+}
+
+// labelKey 将标签值编码为 map 键
+func (d *desc) labelKey(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际为 %d", d.name, len(d.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// labelValueEscaper 按 Prometheus 文本格式转义标签值：只转义反斜杠、双引号和换行，其他字符（包括非 ASCII）原样输出
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels 生成 {name="value",...} 形式的标签字符串，extra 为附加的标签对
+func (d *desc) formatLabels(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labelNames) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, d.labelNames[i], labelValueEscaper.Replace(value)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], labelValueEscaper.Replace(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys 返回排序后的键，保证输出顺序稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatFloat 格式化指标值
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// valueVec 计数器和仪表共用的按标签存储的数值
+type valueVec struct {
+	desc
+	metricType string
+	values     map[string]float64
+	mutex      sync.Mutex
+}
+
+// newValueVec 创建并注册数值指标
+func newValueVec(metricType, name, help string, labelNames ...string) *valueVec {
+	v := &valueVec{
+		desc:       desc{name: name, help: help, labelNames: labelNames},
+		metricType: metricType,
+		values:     make(map[string]float64),
+	}
+	register(v)
+	return v
+}
+
+// write 输出指标
+func (v *valueVec) write(w io.Writer) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.writeHeader(w, v.metricType)
+	if len(v.labelNames) == 0 && len(v.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", v.name)
+		return
+	}
+	for _, key := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.formatLabels(key), formatFloat(v.values[key]))
+	}
+}
+
+// CounterVec 只增不减的计数器
+type CounterVec struct {
+	*valueVec
+}
+
+// NewCounterVec 创建并注册计数器
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{newValueVec("counter", name, help, labelNames...)}
+}
+
+// Add 增加计数，delta 必须为非负数
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	key := c.labelKey(labelValues)
+	c.mutex.Lock()
+	c.values[key] += delta
+	c.mutex.Unlock()
+}
+
+// Inc 计数加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// GaugeVec 可增可减的仪表
+type GaugeVec struct {
+	*valueVec
+}
+
+// NewGaugeVec 创建并注册仪表
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{newValueVec("gauge", name, help, labelNames...)}
+}
+
+// Set 设置仪表值
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	key := g.labelKey(labelValues)
+	g.mutex.Lock()
+	g.values[key] = value
+	g.mutex.Unlock()
+}
+
+// Add 增减仪表值
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	key := g.labelKey(labelValues)
+	g.mutex.Lock()
+	g.values[key] += delta
+	g.mutex.Unlock()
+}
+
+// Reset 清除所有标签组合，用于 provider 列表随配置变化的场景
+func (g *GaugeVec) Reset() {
+	g.mutex.Lock()
+	g.values = make(map[string]float64)
+	g.mutex.Unlock()
+}
+
+// histogramValue 单个标签组合的直方图数据
+type histogramValue struct {
+	counts []uint64 // 每个桶的计数（非累计）
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec 直方图
+type HistogramVec struct {
+	desc
+	buckets []float64
+	values  map[string]*histogramValue
+	mutex   sync.Mutex
+}
+
+// NewHistogramVec 创建并注册直方图，buckets 为升序的桶上界
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, labelNames: labelNames},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+	register(h)
+	return h
+}
+
+// Observe 记录一个观测值
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.labelKey(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	hv, exists := h.values[key]
+	if !exists {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += value
+}
+
+// write 输出指标
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(key, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(key, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.formatLabels(key), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.formatLabels(key), hv.count)
+	}
+}
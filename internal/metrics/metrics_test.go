@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogramText(t *testing.T) {
+	h := &HistogramVec{
+		desc:    desc{name: "test_seconds", help: "Test.", labelNames: []string{"provider"}},
+		buckets: []float64{1, 5},
+		values:  make(map[string]*histogramValue),
+	}
+	h.Observe(0.5, "a")
+	h.Observe(3, "a")
+	h.Observe(10, "a")
+
+	var sb strings.Builder
+	h.write(&sb)
+	for _, line := range []string{
+		`test_seconds_bucket{provider="a",le="1"} 1`,
+		`test_seconds_bucket{provider="a",le="5"} 2`,
+		`test_seconds_bucket{provider="a",le="+Inf"} 3`,
+		`test_seconds_sum{provider="a"} 13.5`,
+		`test_seconds_count{provider="a"} 3`,
+	} {
+		if !strings.Contains(sb.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, sb.String())
+		}
+	}
+}
+
+func TestFormatLabelsEscaping(t *testing.T) {
+	d := &desc{name: "test_total", labelNames: []string{"provider", "model"}}
+	got := d.formatLabels(d.labelKey([]string{"硅基流动\t", "a\"b\\c\nd"}))
+	want := `{provider="硅基流动` + "\t" + `",model="a\"b\\c\nd"}`
+	if got != want {
+		t.Errorf("formatLabels = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,218 @@
+package metrics
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// timelineStep 时间序列每个点的时间跨度
+	timelineStep = time.Minute
+	// timelinePoints 保留的点数，即最近 1 小时
+	timelinePoints = 60
+	// timelineSamples 每个点每个 provider 保留的耗时样本数，超出后随机替换以估算分位数
+	timelineSamples = 256
+)
+
+// TimelineTotal 汇总所有 provider 的序列名称，记录时同时写入汇总序列，分位数按全部样本抽样而不是合并各 provider 的样本
+const TimelineTotal = "*"
+
+// Timeline 最近 1 小时按分钟汇总的请求数、错误率、耗时和 token 用量，供管理界面绘制趋势图
+// 与其他指标一样全局共享，配置重载时不会重置
+var Timeline = &timeline{now: time.Now}
+
+// seriesBucket 某一分钟内单个 provider 的统计
+type seriesBucket struct {
+	requests     int
+	errors       int
+	latency      sampler
+	ttft         sampler
+	inputTokens  int64
+	outputTokens int64
+}
+
+// timelineSlot 环形缓冲中的一分钟
+type timelineSlot struct {
+	minute    int64 // Unix 分钟数，与当前时间不符的槽位已过期
+	providers map[string]*seriesBucket
+}
+
+// timeline 按分钟划分的环形缓冲
+type timeline struct {
+	slots [timelinePoints]timelineSlot
+	now   func() time.Time // 当前时间，测试时可替换
+	mutex sync.Mutex
+}
+
+// bucket 返回 t 所在分钟的 provider 统计，调用方需持有锁
+func (tl *timeline) bucket(t time.Time, provider string) *seriesBucket {
+	minute := t.Unix() / int64(timelineStep/time.Second)
+	slot := &tl.slots[minute%timelinePoints]
+	if slot.minute != minute || slot.providers == nil {
+		slot.minute = minute
+		slot.providers = make(map[string]*seriesBucket)
+	}
+	b, exists := slot.providers[provider]
+	if !exists {
+		b = &seriesBucket{}
+		slot.providers[provider] = b
+	}
+	return b
+}
+
+// ObserveRequest 记录一次上游请求（每次上游尝试，包括限流重试和备选），status 为 HTTP 状态码，0 表示请求发送失败
+// 状态码 >= 400 和发送失败计为错误
+func (tl *timeline) ObserveRequest(provider string, status int, latency time.Duration) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	now := tl.now()
+	for _, name := range []string{provider, TimelineTotal} {
+		b := tl.bucket(now, name)
+		b.requests++
+		if status == 0 || status >= 400 {
+			b.errors++
+		}
+		b.latency.add(latency)
+	}
+}
+
+// ObserveTTFT 记录流式响应的首 token 耗时（收到第一个 content_block_delta 的时间）
+func (tl *timeline) ObserveTTFT(provider string, ttft time.Duration) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	now := tl.now()
+	for _, name := range []string{provider, TimelineTotal} {
+		tl.bucket(now, name).ttft.add(ttft)
+	}
+}
+
+// ObserveTokens 记录已完成请求的 token 用量
+func (tl *timeline) ObserveTokens(provider string, input, output int64) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	now := tl.now()
+	for _, name := range []string{provider, TimelineTotal} {
+		b := tl.bucket(now, name)
+		b.inputTokens += input
+		b.outputTokens += output
+	}
+}
+
+// TimelinePoint 一分钟内的统计，耗时单位为毫秒，没有样本时为 0
+type TimelinePoint struct {
+	Time         time.Time `json:"time"`
+	Requests     int       `json:"requests"` // 上游请求数，每次重试和备选单独计数
+	Errors       int       `json:"errors"`
+	ErrorRate    float64   `json:"error_rate"`
+	LatencyP50   float64   `json:"latency_p50_ms"`
+	LatencyP90   float64   `json:"latency_p90_ms"`
+	LatencyP99   float64   `json:"latency_p99_ms"`
+	TTFTP50      float64   `json:"ttft_p50_ms"`
+	TTFTP90      float64   `json:"ttft_p90_ms"`
+	TTFTP99      float64   `json:"ttft_p99_ms"`
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+}
+
+// TimelineSeries 单个 provider 的时间序列，Name 为 TimelineTotal 时是所有 provider 的汇总
+type TimelineSeries struct {
+	Name   string          `json:"name"`
+	Points []TimelinePoint `json:"points"`
+}
+
+// TimelineSnapshot 最近 1 小时的时间序列，每个序列的点按时间从旧到新排列，最后一个点为当前分钟（尚未结束）
+type TimelineSnapshot struct {
+	StepSeconds int              `json:"step_seconds"`
+	Series      []TimelineSeries `json:"series"`
+}
+
+// Snapshot 返回最近 1 小时的时间序列，汇总序列在最前，其余按 provider 名称排序
+func (tl *timeline) Snapshot() TimelineSnapshot {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	current := tl.now().Unix() / int64(timelineStep/time.Second)
+	first := current - timelinePoints + 1
+
+	// 收集出现过的 provider
+	names := map[string]bool{}
+	for i := range tl.slots {
+		if slot := &tl.slots[i]; slot.minute >= first {
+			for name := range slot.providers {
+				if name != TimelineTotal {
+					names[name] = true
+				}
+			}
+		}
+	}
+	providers := sortedKeys(names)
+
+	snapshot := TimelineSnapshot{StepSeconds: int(timelineStep / time.Second)}
+	for _, name := range append([]string{TimelineTotal}, providers...) {
+		series := TimelineSeries{Name: name, Points: make([]TimelinePoint, 0, timelinePoints)}
+		for minute := first; minute <= current; minute++ {
+			point := TimelinePoint{Time: time.Unix(minute*int64(timelineStep/time.Second), 0)}
+			slot := &tl.slots[minute%timelinePoints]
+			if b := slot.providers[name]; slot.minute == minute && b != nil {
+				point.fill(b)
+			}
+			series.Points = append(series.Points, point)
+		}
+		snapshot.Series = append(snapshot.Series, series)
+	}
+	return snapshot
+}
+
+// fill 用一分钟的统计填充数据点
+func (p *TimelinePoint) fill(b *seriesBucket) {
+	p.Requests = b.requests
+	p.Errors = b.errors
+	if b.requests > 0 {
+		p.ErrorRate = float64(b.errors) / float64(b.requests)
+	}
+	p.LatencyP50, p.LatencyP90, p.LatencyP99 = b.latency.percentiles()
+	p.TTFTP50, p.TTFTP90, p.TTFTP99 = b.ttft.percentiles()
+	p.InputTokens = b.inputTokens
+	p.OutputTokens = b.outputTokens
+}
+
+// sampler 使用蓄水池抽样保留最多 timelineSamples 个耗时样本
+type sampler struct {
+	samples []time.Duration
+	count   int
+}
+
+// add 添加一个样本
+func (s *sampler) add(d time.Duration) {
+	s.count++
+	if len(s.samples) < timelineSamples {
+		s.samples = append(s.samples, d)
+	} else if i := rand.Intn(s.count); i < timelineSamples {
+		s.samples[i] = d
+	}
+}
+
+// percentiles 返回 p50、p90 和 p99（毫秒）
+func (s *sampler) percentiles() (p50, p90, p99 float64) {
+	if len(s.samples) == 0 {
+		return 0, 0, 0
+	}
+	sorted := append([]time.Duration(nil), s.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(q float64) float64 {
+		index := int(q*float64(len(sorted))+0.5) - 1
+		if index < 0 {
+			index = 0
+		}
+		if index >= len(sorted) {
+			index = len(sorted) - 1
+		}
+		return float64(sorted[index].Microseconds()) / 1000
+	}
+	return at(0.5), at(0.9), at(0.99)
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimelineSnapshot(t *testing.T) {
+	// 固定在一分钟的最后一秒，避免依赖实际时间
+	now := time.Date(2025, 6, 1, 10, 0, 59, 0, time.UTC)
+	tl := &timeline{now: func() time.Time { return now }}
+	tl.ObserveRequest("b", 200, 100*time.Millisecond)
+	tl.ObserveRequest("b", 529, 300*time.Millisecond)
+	tl.ObserveRequest("a", 0, 50*time.Millisecond)
+	tl.ObserveTTFT("b", 80*time.Millisecond)
+	tl.ObserveTokens("b", 10, 20)
+
+	// 过期的槽位不计入
+	stale := &tl.slots[(now.Unix()/60+1)%timelinePoints]
+	stale.minute = now.Unix()/60 - timelinePoints
+	stale.providers = map[string]*seriesBucket{"old": {requests: 5}}
+
+	snapshot := tl.Snapshot()
+	if len(snapshot.Series) != 3 || snapshot.Series[0].Name != TimelineTotal || snapshot.Series[1].Name != "a" || snapshot.Series[2].Name != "b" {
+		t.Fatalf("series = %+v", snapshot.Series)
+	}
+	for _, series := range snapshot.Series {
+		if len(series.Points) != timelinePoints {
+			t.Fatalf("%s has %d points, want %d", series.Name, len(series.Points), timelinePoints)
+		}
+	}
+
+	total := snapshot.Series[0].Points[timelinePoints-1]
+	if total.Requests != 3 || total.Errors != 2 || total.OutputTokens != 20 || total.LatencyP50 != 100 || total.LatencyP99 != 300 {
+		t.Errorf("total = %+v", total)
+	}
+	b := snapshot.Series[2].Points[timelinePoints-1]
+	if b.ErrorRate != 0.5 || b.TTFTP90 != 80 || b.InputTokens != 10 {
+		t.Errorf("b = %+v", b)
+	}
+	if previous := snapshot.Series[0].Points[timelinePoints-2]; previous.Requests != 0 || !previous.Time.Before(total.Time) {
+		t.Errorf("previous = %+v", previous)
+	}
+}
+
+func TestTimelineTotalPercentiles(t *testing.T) {
+	now := time.Date(2025, 6, 1, 10, 0, 59, 0, time.UTC)
+	tl := &timeline{now: func() time.Time { return now }}
+	// 少量慢请求不应因为各 provider 样本数相同而拉高汇总分位数
+	for i := 0; i < 10000; i++ {
+		tl.ObserveRequest("fast", 200, 100*time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		tl.ObserveRequest("slow", 200, time.Second)
+	}
+
+	total := tl.Snapshot().Series[0].Points[timelinePoints-1]
+	if total.Requests != 10010 || total.LatencyP50 != 100 || total.LatencyP99 != 100 {
+		t.Errorf("total = %+v", total)
+	}
+}
@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+// 运行时控制操作默认不写回配置文件，配置重载时由 InheritRuntimeState 保留，配置文件中修改过的项以配置文件为准
+
+// ValidStrategies 支持的路由策略
+var ValidStrategies = []string{"default", "robin"}
+
+// hasAuth 判断 provider 是否配置了认证信息
+func hasAuth(p config.Provider) bool {
+	return p.Env["ANTHROPIC_AUTH_TOKEN"] != "" || p.Env["ANTHROPIC_API_KEY"] != ""
+}
+
+// SetProviderEnabled 在运行时启用或禁用 provider，启用时同时清除失败计数和熔断状态
+func (pm *ProviderManager) SetProviderEnabled(name string, enabled bool) error {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	ps := pm.findProvider(name)
+	if ps == nil {
+		return fmt.Errorf("provider %s 不存在", name)
+	}
+
+	if !enabled {
+		ps.Provider.State = "off"
+		ps.IsDisabled = true
+		ps.DisabledUntil = time.Time{}
+		if pm.forced == ps {
+			pm.forced = nil
+			logger.Warn(logger.ModuleProvider, "Provider %s 已禁用，取消强制使用", name)
+		}
+		logger.Warn(logger.ModuleProvider, "通过管理接口禁用 provider %s", name)
+		reportMetrics(ps)
+		return nil
+	}
+
+	if !hasAuth(ps.Provider) {
+		return fmt.Errorf("provider %s 缺少认证配置(ANTHROPIC_AUTH_TOKEN或ANTHROPIC_API_KEY)，无法启用", name)
+	}
+	ps.Provider.State = "on"
+	ps.IsDisabled = false
+	ps.DisabledUntil = time.Time{}
+	ps.FailureCount = 0
+	logger.Warn(logger.ModuleProvider, "通过管理接口启用 provider %s", name)
+	reportMetrics(ps)
+	return nil
+}
+
+// ResetProvider 重置 provider 的失败计数，并关闭因连续失败打开的熔断
+func (pm *ProviderManager) ResetProvider(name string) error {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	ps := pm.findProvider(name)
+	if ps == nil {
+		return fmt.Errorf("provider %s 不存在", name)
+	}
+
+	ps.FailureCount = 0
+	ps.LastError = ""
+	if ps.IsDisabled && !ps.DisabledUntil.IsZero() {
+		ps.IsDisabled = false
+		ps.DisabledUntil = time.Time{}
+	}
+	logger.Warn(logger.ModuleProvider, "通过管理接口重置 provider %s 的失败计数和熔断状态", name)
+	reportMetrics(ps)
+	return nil
+}
+
+// ForceProvider 在 duration 内将所有请求都发往指定 provider，忽略路由规则、路由策略和熔断状态
+func (pm *ProviderManager) ForceProvider(name string, duration time.Duration) error {
+	if duration <= 0 {
+		return fmt.Errorf("强制使用时长必须大于 0")
+	}
+
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	ps := pm.findProvider(name)
+	if ps == nil {
+		return fmt.Errorf("provider %s 不存在", name)
+	}
+	if !hasAuth(ps.Provider) {
+		return fmt.Errorf("provider %s 缺少认证配置(ANTHROPIC_AUTH_TOKEN或ANTHROPIC_API_KEY)，无法强制使用", name)
+	}
+
+	pm.forced = ps
+	pm.forcedUntil = time.Now().Add(duration)
+	logger.Warn(logger.ModuleProvider, "通过管理接口强制使用 provider %s，持续到 %s", name, pm.forcedUntil.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// ClearForce 取消强制使用的 provider，恢复正常路由
+func (pm *ProviderManager) ClearForce() {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if pm.forced != nil {
+		logger.Warn(logger.ModuleProvider, "通过管理接口取消强制使用 provider %s，恢复正常路由", pm.forced.Provider.Name)
+		pm.forced = nil
+	}
+}
+
+// Forced 返回当前强制使用的 provider 名称和到期时间，没有强制使用时返回空字符串
+func (pm *ProviderManager) Forced() (string, time.Time) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if forced := pm.activeForced(); forced != nil {
+		return forced.Provider.Name, pm.forcedUntil
+	}
+	return "", time.Time{}
+}
+
+// SetRoutingStrategy 在运行时切换路由策略
+func (pm *ProviderManager) SetRoutingStrategy(strategy string) error {
+	if !isValidStrategy(strategy) {
+		return fmt.Errorf("不支持的路由策略 %q，可选: %v", strategy, ValidStrategies)
+	}
+
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if pm.routingStrategy != strategy {
+		logger.Warn(logger.ModuleProvider, "通过管理接口切换路由策略: %s -> %s", pm.routingStrategy, strategy)
+		pm.routingStrategy = strategy
+		pm.robinIndex = 0
+	}
+	return nil
+}
+
+// InheritRuntimeState 在配置重载后继承旧 ProviderManager 的运行时状态：
+// 同名 provider 的失败计数、熔断状态、延迟统计和运行时启用/禁用，未到期的强制使用，以及运行时切换的路由策略
+// 配置文件中修改了 state 或路由策略时以配置文件为准
+func (pm *ProviderManager) InheritRuntimeState(previous *ProviderManager) {
+	if previous == nil {
+		return
+	}
+	previous.mutex.RLock()
+	defer previous.mutex.RUnlock()
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	for _, ps := range pm.providers {
+		old := previous.findProvider(ps.Provider.Name)
+		if old == nil {
+			continue
+		}
+
+		// 运行时启用或禁用过，且配置文件中的 state 没有变化
+		if old.Provider.State != old.configState && ps.configState == old.configState {
+			if old.Provider.State == "off" {
+				ps.Provider.State = "off"
+				ps.IsDisabled = true
+			} else if hasAuth(ps.Provider) {
+				ps.Provider.State = "on"
+				ps.IsDisabled = false
+			}
+		}
+
+		ps.FailureCount = old.FailureCount
+		ps.LastFailureTime = old.LastFailureTime
+		ps.LastError = old.LastError
+		if ps.Provider.State == "on" && !ps.IsDisabled && old.IsDisabled && !old.DisabledUntil.IsZero() {
+			ps.IsDisabled = true
+			ps.DisabledUntil = old.DisabledUntil
+		}
+		ps.latencies = append([]time.Duration(nil), old.latencies...)
+		ps.latencyIndex = old.latencyIndex
+		reportMetrics(ps)
+	}
+
+	// 与 SetProviderEnabled 一致，配置文件中禁用了强制使用的 provider 时取消强制使用
+	if previous.forced != nil && time.Now().Before(previous.forcedUntil) {
+		ps := pm.findProvider(previous.forced.Provider.Name)
+		disabledInConfig := ps != nil && ps.configState == "off" && previous.forced.configState != "off"
+		if ps != nil && hasAuth(ps.Provider) && !disabledInConfig {
+			pm.forced = ps
+			pm.forcedUntil = previous.forcedUntil
+		}
+	}
+
+	if previous.routingStrategy != previous.routing.Strategy && pm.routing.Strategy == previous.routing.Strategy {
+		pm.routingStrategy = previous.routingStrategy
+	}
+
+	logger.Info(logger.ModuleProvider, "已继承配置重载前的运行时状态，路由策略: %s", pm.routingStrategy)
+}
+
+// activeForced 返回未到期的强制使用 provider，到期时自动恢复正常路由，调用方需持有写锁
+func (pm *ProviderManager) activeForced() *ProviderState {
+	if pm.forced == nil {
+		return nil
+	}
+	if time.Now().After(pm.forcedUntil) {
+		logger.Info(logger.ModuleProvider, "强制使用 provider %s 已到期，恢复正常路由", pm.forced.Provider.Name)
+		pm.forced = nil
+		return nil
+	}
+	return pm.forced
+}
+
+// isValidStrategy 判断路由策略是否受支持
+func isValidStrategy(strategy string) bool {
+	for _, s := range ValidStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+)
+
+func TestRuntimeControl(t *testing.T) {
+	pm := NewProviderManager(&config.Config{
+		Routing: config.Routing{Strategy: "default"},
+		Providers: []config.Provider{
+			{Name: "a", State: "on", Env: map[string]string{"ANTHROPIC_AUTH_TOKEN": "token-a"}},
+			{Name: "b", State: "on", Env: map[string]string{"ANTHROPIC_API_KEY": "key-b"}},
+			{Name: "noauth", State: "on", Env: map[string]string{}},
+		},
+	})
+	next := func() string {
+		ps, err := pm.GetProviderForRequest(RequestInfo{}, nil)
+		if err != nil {
+			return err.Error()
+		}
+		return ps.Provider.Name
+	}
+
+	if err := pm.SetProviderEnabled("a", false); err != nil || next() != "b" {
+		t.Fatalf("disable a: err = %v, next = %s", err, next())
+	}
+	if err := pm.SetProviderEnabled("noauth", true); err == nil {
+		t.Error("enabling a provider without auth should fail")
+	}
+
+	// 强制使用忽略禁用状态和路由策略，同一请求内失败后不再回退到其他 provider
+	pm.RecordFailure("b", "x")
+	if err := pm.ForceProvider("a", time.Minute); err != nil || next() != "a" {
+		t.Fatalf("force a: err = %v, next = %s", err, next())
+	}
+	if _, err := pm.GetProviderForRequest(RequestInfo{}, map[string]bool{"a": true}); err == nil {
+		t.Error("forced provider excluded should fail")
+	}
+	if name, _ := pm.Forced(); name != "a" {
+		t.Errorf("Forced() = %s, want a", name)
+	}
+
+	pm.ClearForce()
+	if next() != "b" {
+		t.Errorf("after ClearForce next = %s, want b", next())
+	}
+
+	if err := pm.ResetProvider("b"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := pm.GetProvider("b"); status.FailureCount != 0 || status.LastError != "" {
+		t.Errorf("after reset = %+v", status)
+	}
+
+	if err := pm.SetRoutingStrategy("random"); err == nil {
+		t.Error("invalid strategy should fail")
+	}
+	if err := pm.SetRoutingStrategy("robin"); err != nil || pm.RoutingStrategy() != "robin" {
+		t.Errorf("SetRoutingStrategy(robin) err = %v, strategy = %s", err, pm.RoutingStrategy())
+	}
+}
+
+func TestInheritRuntimeState(t *testing.T) {
+	newConfig := func(stateC string) *config.Config {
+		return &config.Config{
+			Routing: config.Routing{Strategy: "default"},
+			Providers: []config.Provider{
+				{Name: "a", State: "on", Env: map[string]string{"ANTHROPIC_AUTH_TOKEN": "token-a"}},
+				{Name: "b", State: "on", Env: map[string]string{"ANTHROPIC_AUTH_TOKEN": "token-b"}},
+				{Name: "c", State: stateC, Env: map[string]string{"ANTHROPIC_AUTH_TOKEN": "token-c"}},
+			},
+		}
+	}
+	previous := NewProviderManager(newConfig("on"))
+	previous.SetProviderEnabled("a", false)
+	for i := 0; i < 5; i++ {
+		previous.RecordFailure("b", "x")
+	}
+	previous.RecordLatency("b", time.Second)
+	previous.SetProviderEnabled("c", false)
+	previous.ForceProvider("b", time.Minute)
+	previous.SetRoutingStrategy("robin")
+
+	pm := NewProviderManager(newConfig("on"))
+	pm.InheritRuntimeState(previous)
+	if a, _ := pm.GetProvider("a"); a.State != "off" {
+		t.Errorf("runtime disable of a lost: %+v", a)
+	}
+	if b, _ := pm.GetProvider("b"); b.FailureCount != 5 || b.DisabledUntil == nil || b.Latency.Samples != 1 {
+		t.Errorf("circuit state of b lost: %+v", b)
+	}
+	if c, _ := pm.GetProvider("c"); c.State != "off" {
+		t.Errorf("runtime disable of c lost: %+v", c)
+	}
+	if name, _ := pm.Forced(); name != "b" || pm.RoutingStrategy() != "robin" {
+		t.Errorf("forced = %s, strategy = %s", name, pm.RoutingStrategy())
+	}
+
+	// 配置文件中禁用了强制使用的 provider 时取消强制使用
+	previous = NewProviderManager(newConfig("on"))
+	previous.ForceProvider("c", time.Minute)
+	edited := NewProviderManager(newConfig("off"))
+	edited.InheritRuntimeState(previous)
+	if name, _ := edited.Forced(); name != "" {
+		t.Errorf("forced = %s, want none after c was turned off in the config", name)
+	}
+}
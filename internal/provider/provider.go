@@ -2,11 +2,15 @@ package provider
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/imty42/claude-code-env/internal/budget"
 	"github.com/imty42/claude-code-env/internal/config"
 	"github.com/imty42/claude-code-env/internal/logger"
+	"github.com/imty42/claude-code-env/internal/metrics"
+	"github.com/imty42/claude-code-env/internal/usage"
 )
 
 // ProviderState 表示 provider 的运行时状态
@@ -16,14 +20,24 @@ type ProviderState struct {
 	LastFailureTime time.Time // 最后失败时间
 	IsDisabled      bool      // 是否被暂时禁用
 	DisabledUntil   time.Time // 禁用到期时间
+	LastError       string    // 最后一次失败的原因
+
+	configState string // 配置文件中的 state，用于在配置重载时识别运行时的启用/禁用操作
+
+	latencies    []time.Duration // 最近的上游响应耗时，环形缓冲
+	latencyIndex int
 }
 
 // ProviderManager 管理多个 providers 的状态和路由
 type ProviderManager struct {
 	providers       []*ProviderState
 	routingStrategy string
+	routing         config.Routing
 	robinIndex      int
-	lastSelected    string // 上次选择的 provider 名称
+	lastSelected    string          // 上次选择的 provider 名称
+	forced          *ProviderState  // 管理接口临时强制使用的 provider，为 nil 时正常路由
+	forcedUntil     time.Time       // 强制使用的到期时间
+	budget          *budget.Tracker // 预算追踪器，未配置预算时为 nil
 	mutex           sync.RWMutex
 }
 
@@ -32,18 +46,16 @@ func NewProviderManager(cfg *config.Config) *ProviderManager {
 	pm := &ProviderManager{
 		providers:       make([]*ProviderState, 0),
 		routingStrategy: cfg.Routing.Strategy,
+		routing:         cfg.Routing,
 		robinIndex:      0,
+		budget:          budget.NewTracker(cfg),
 	}
 
 	// 初始化所有 providers
 	for _, provider := range cfg.Providers {
-		// 验证认证配置
-		authToken := provider.Env["ANTHROPIC_AUTH_TOKEN"]
-		apiKey := provider.Env["ANTHROPIC_API_KEY"]
-
-		// 如果两个都没有配置，标记为失效
+		// 验证认证配置，如果两个都没有配置，标记为失效
 		isDisabled := provider.State != "on"
-		if authToken == "" && apiKey == "" {
+		if !hasAuth(provider) {
 			isDisabled = true
 			logger.Warn(logger.ModuleProvider, "Provider %s 缺少认证配置(ANTHROPIC_AUTH_TOKEN或ANTHROPIC_API_KEY)，已禁用", provider.Name)
 		}
@@ -52,12 +64,20 @@ func NewProviderManager(cfg *config.Config) *ProviderManager {
 			Provider:     provider,
 			FailureCount: 0,
 			IsDisabled:   isDisabled,
+			configState:  provider.State,
 		}
 		pm.providers = append(pm.providers, ps)
 	}
 
 	logger.Info(logger.ModuleProvider, "初始化 ProviderManager，策略: %s，providers 数量: %d", pm.routingStrategy, len(pm.providers))
 
+	// provider 列表可能随配置变化，重置指标中已删除的 provider
+	metrics.ProviderCircuitOpen.Reset()
+	metrics.ProviderFailures.Reset()
+	for _, ps := range pm.providers {
+		reportMetrics(ps)
+	}
+
 	// 展示每个 provider 的状态
 	for _, ps := range pm.providers {
 		status := ps.Provider.State
@@ -67,9 +87,40 @@ func NewProviderManager(cfg *config.Config) *ProviderManager {
 		logger.Info(logger.ModuleProvider, "Provider: %s, State: %s", ps.Provider.Name, status)
 	}
 
+	// 检查路由规则目标是否存在
+	for _, rule := range pm.routing.Rules {
+		for _, name := range ResolveTarget(pm.routing, rule.Target) {
+			if pm.findProvider(name) == nil {
+				logger.Warn(logger.ModuleProvider, "路由规则 %s 的目标 %s 引用了不存在的 provider: %s", rule.Name, rule.Target, name)
+			}
+		}
+	}
+	if len(pm.routing.Rules) > 0 {
+		logger.Info(logger.ModuleProvider, "已加载 %d 条路由规则", len(pm.routing.Rules))
+	}
+
 	return pm
 }
 
+// findProvider 按名称查找 provider
+func (pm *ProviderManager) findProvider(name string) *ProviderState {
+	for _, ps := range pm.providers {
+		if ps.Provider.Name == name {
+			return ps
+		}
+	}
+	return nil
+}
+
+// LookupProvider 按名称查找 provider，不考虑是否启用或熔断，用于连通性测试等绕过路由的场景
+func (pm *ProviderManager) LookupProvider(name string) (*ProviderState, bool) {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	ps := pm.findProvider(name)
+	return ps, ps != nil
+}
+
 // GetNextProvider 根据路由策略获取下一个可用的 provider
 func (pm *ProviderManager) GetNextProvider() (*ProviderState, error) {
 	pm.mutex.Lock()
@@ -78,24 +129,135 @@ func (pm *ProviderManager) GetNextProvider() (*ProviderState, error) {
 	// 更新 provider 状态（检查是否可以恢复）
 	pm.updateProviderStates()
 
+	// 管理接口强制使用的 provider 优先
+	if forced := pm.activeForced(); forced != nil {
+		return forced, nil
+	}
+
 	// 获取所有可用的 providers
 	availableProviders := pm.getAvailableProviders()
 	if len(availableProviders) == 0 {
 		return nil, fmt.Errorf("没有可用的 provider")
 	}
 
+	return pm.selectByStrategy(availableProviders), nil
+}
+
+// GetProviderForRequest 先按内容路由规则筛选候选 providers，再按路由策略选择
+// excluded 中的 providers 不参与选择（用于同一请求内的故障转移）
+func (pm *ProviderManager) GetProviderForRequest(info RequestInfo, excluded map[string]bool) (*ProviderState, error) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	pm.updateProviderStates()
+
+	// playground 指定的 provider 是唯一目标，优先于强制使用
+	// 不考虑配置中的 state 和熔断，便于在启用前测试 provider，但仍需认证配置、未被管理接口禁用且预算未耗尽
+	if info.Provider != "" {
+		pinned := pm.findProvider(info.Provider)
+		if pinned == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, info.Provider)
+		}
+		if err := pm.checkPinned(pinned); err != nil {
+			return nil, err
+		}
+		return singleTarget(pinned, info, excluded, "请求指定的")
+	}
+
+	// 管理接口强制使用的 provider 是唯一目标，不再按路由规则和策略选择
+	if forced := pm.activeForced(); forced != nil {
+		return singleTarget(forced, info, excluded, "强制使用的")
+	}
+
+	var availableProviders []*ProviderState
+	for _, ps := range pm.getAvailableProviders() {
+		if !excluded[ps.Provider.Name] {
+			availableProviders = append(availableProviders, ps)
+		}
+	}
+	if len(availableProviders) == 0 {
+		if err := pm.budgetExhaustedError(excluded, nil); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("没有可用的 provider")
+	}
+
+	if rule := MatchRoutingRule(pm.routing.Rules, info); rule != nil {
+		targets := ResolveTarget(pm.routing, rule.Target)
+		availableProviders = filterByNames(availableProviders, targets)
+		if len(availableProviders) == 0 {
+			if err := pm.budgetExhaustedError(excluded, targets); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("路由规则 %s 的目标 %s 没有可用的 provider", rule.Name, rule.Target)
+		}
+		logger.Debug(logger.ModuleProvider, "请求命中路由规则 %s -> %s", rule.Name, rule.Target)
+	}
+
+	// 跳过上下文窗口放不下该请求的 providers
+	fitting := filterByContextWindow(availableProviders, info)
+	if len(fitting) == 0 {
+		return nil, fmt.Errorf("%w: 请求估算输入约 %d tokens、max_tokens 为 %d，可用 provider 的最大上下文窗口为 %d tokens",
+			ErrContextWindowExceeded, info.EstimatedTokens, info.MaxTokens, largestContextWindow(availableProviders, info))
+	}
+
+	return pm.selectByStrategy(fitting), nil
+}
+
+// checkPinned 检查请求指定的 provider 是否可以使用：需要认证配置、未被管理接口禁用且预算未耗尽
+func (pm *ProviderManager) checkPinned(ps *ProviderState) error {
+	name := ps.Provider.Name
+	if !hasAuth(ps.Provider) {
+		return fmt.Errorf("%w: %s 缺少认证配置(ANTHROPIC_AUTH_TOKEN或ANTHROPIC_API_KEY)", ErrProviderUnavailable, name)
+	}
+	if ps.Provider.State == "off" && ps.configState != "off" {
+		return fmt.Errorf("%w: %s 已通过管理接口禁用", ErrProviderUnavailable, name)
+	}
+	if pm.budget.ProviderExhausted(name) {
+		return fmt.Errorf("%w: %s", ErrBudgetExhausted, name)
+	}
+	return nil
+}
+
+// singleTarget 检查唯一目标 provider 能否处理请求，kind 描述目标的来源，用于错误信息
+func singleTarget(ps *ProviderState, info RequestInfo, excluded map[string]bool, kind string) (*ProviderState, error) {
+	if excluded[ps.Provider.Name] {
+		return nil, fmt.Errorf("%s provider %s 请求失败", kind, ps.Provider.Name)
+	}
+	if len(filterByContextWindow([]*ProviderState{ps}, info)) == 0 {
+		return nil, fmt.Errorf("%w: 请求估算输入约 %d tokens、max_tokens 为 %d，%s provider %s 的上下文窗口为 %d tokens",
+			ErrContextWindowExceeded, info.EstimatedTokens, info.MaxTokens, kind, ps.Provider.Name, largestContextWindow([]*ProviderState{ps}, info))
+	}
+	return ps, nil
+}
+
+// DowngradeModel 按全局降级链返回请求模型匹配的降级步骤，To 为下一级请求模型，没有匹配的降级步骤时返回 false
+func (pm *ProviderManager) DowngradeModel(model string) (config.DowngradeStep, bool) {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	for _, step := range pm.routing.Downgrade {
+		if step.To != "" && wildcardMatch(step.From, model) && !strings.EqualFold(step.To, model) {
+			return step, true
+		}
+	}
+	return config.DowngradeStep{}, false
+}
+
+// selectByStrategy 按路由策略从候选 providers 中选择一个
+func (pm *ProviderManager) selectByStrategy(availableProviders []*ProviderState) *ProviderState {
 	switch pm.routingStrategy {
 	case "robin":
-		return pm.getNextRobin(availableProviders), nil
+		return pm.getNextRobin(availableProviders)
 	case "default":
 		fallthrough
 	default:
-		return pm.getNextDefault(availableProviders), nil
+		return pm.getNextDefault(availableProviders)
 	}
 }
 
-// RecordFailure 记录 provider 失败
-func (pm *ProviderManager) RecordFailure(providerName string) {
+// RecordFailure 记录 provider 失败，reason 为失败原因
+func (pm *ProviderManager) RecordFailure(providerName string, reason string) {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
 
@@ -103,6 +265,7 @@ func (pm *ProviderManager) RecordFailure(providerName string) {
 		if ps.Provider.Name == providerName {
 			ps.FailureCount++
 			ps.LastFailureTime = time.Now()
+			ps.LastError = reason
 
 			logger.Warn(logger.ModuleProvider, "Provider %s 失败，累计失败次数: %d", providerName, ps.FailureCount)
 
@@ -112,6 +275,7 @@ func (pm *ProviderManager) RecordFailure(providerName string) {
 				ps.DisabledUntil = time.Now().Add(5 * time.Minute)
 				logger.Error(logger.ModuleProvider, "Provider %s 失败次数达到 5 次，禁用 5 分钟", providerName)
 			}
+			reportMetrics(ps)
 			break
 		}
 	}
@@ -127,12 +291,49 @@ func (pm *ProviderManager) RecordSuccess(providerName string) {
 			if ps.FailureCount > 0 {
 				logger.Info(logger.ModuleProvider, "Provider %s 成功，重置失败计数 (之前: %d)", providerName, ps.FailureCount)
 				ps.FailureCount = 0
+				reportMetrics(ps)
 			}
 			break
 		}
 	}
 }
 
+// RecordLatency 记录 provider 的上游响应耗时（收到响应头的时间）
+func (pm *ProviderManager) RecordLatency(providerName string, latency time.Duration) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	ps := pm.findProvider(providerName)
+	if ps == nil {
+		return
+	}
+	if len(ps.latencies) < recentLatencySamples {
+		ps.latencies = append(ps.latencies, latency)
+		return
+	}
+	ps.latencies[ps.latencyIndex] = latency
+	ps.latencyIndex = (ps.latencyIndex + 1) % recentLatencySamples
+}
+
+// RecordUsage 记录 provider 的 token 用量，用于预算统计
+func (pm *ProviderManager) RecordUsage(providerName string, u usage.Usage) {
+	ps := pm.findProvider(providerName)
+	if ps == nil {
+		return
+	}
+	pm.budget.Record(providerName, ps.Provider.Pricing, u)
+}
+
+// Close 写入未保存的预算用量，服务关闭或配置重载前调用
+func (pm *ProviderManager) Close() {
+	pm.budget.Close()
+}
+
+// GlobalBudgetExhausted 判断全局预算是否已耗尽，返回耗尽原因
+func (pm *ProviderManager) GlobalBudgetExhausted() (bool, string) {
+	return pm.budget.GlobalExhausted()
+}
+
 // updateProviderStates 更新所有 provider 状态（检查是否可以恢复）
 func (pm *ProviderManager) updateProviderStates() {
 	now := time.Now()
@@ -144,17 +345,28 @@ func (pm *ProviderManager) updateProviderStates() {
 			ps.DisabledUntil = time.Time{}
 			ps.FailureCount = 0 // 重置失败计数
 			logger.Info(logger.ModuleProvider, "Provider %s 禁用期结束，重新启用", ps.Provider.Name)
+			reportMetrics(ps)
 		}
 	}
 }
 
+// reportMetrics 更新 provider 的熔断状态指标
+func reportMetrics(ps *ProviderState) {
+	circuitOpen := 0.0
+	if ps.IsDisabled && !ps.DisabledUntil.IsZero() {
+		circuitOpen = 1
+	}
+	metrics.ProviderCircuitOpen.Set(circuitOpen, ps.Provider.Name)
+	metrics.ProviderFailures.Set(float64(ps.FailureCount), ps.Provider.Name)
+}
+
 // getAvailableProviders 获取所有可用的 providers
 func (pm *ProviderManager) getAvailableProviders() []*ProviderState {
 	var available []*ProviderState
 
 	for _, ps := range pm.providers {
-		// Provider 必须配置为 "on" 且未被禁用
-		if ps.Provider.State == "on" && !ps.IsDisabled {
+		// Provider 必须配置为 "on"、未被禁用且预算未耗尽
+		if ps.Provider.State == "on" && !ps.IsDisabled && !pm.budget.ProviderExhausted(ps.Provider.Name) {
 			available = append(available, ps)
 		}
 	}
@@ -162,6 +374,27 @@ func (pm *ProviderManager) getAvailableProviders() []*ProviderState {
 	return available
 }
 
+// budgetExhaustedError 候选 providers 中有仅因预算耗尽而不可用的 provider 时返回 ErrBudgetExhausted，否则返回 nil
+// 只在没有其他可用 provider 时调用，names 为空表示不限制候选范围
+func (pm *ProviderManager) budgetExhaustedError(excluded map[string]bool, names []string) error {
+	var exhausted []string
+	for _, ps := range pm.providers {
+		if excluded[ps.Provider.Name] || ps.Provider.State != "on" || ps.IsDisabled {
+			continue
+		}
+		if names != nil && len(filterByNames([]*ProviderState{ps}, names)) == 0 {
+			continue
+		}
+		if pm.budget.ProviderExhausted(ps.Provider.Name) {
+			exhausted = append(exhausted, ps.Provider.Name)
+		}
+	}
+	if len(exhausted) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrBudgetExhausted, strings.Join(exhausted, ", "))
+}
+
 // getNextDefault 默认策略：按配置顺序返回第一个可用的
 func (pm *ProviderManager) getNextDefault(availableProviders []*ProviderState) *ProviderState {
 	// 按原始顺序返回第一个可用的
@@ -217,28 +450,3 @@ func (pm *ProviderManager) getNextRobin(availableProviders []*ProviderState) *Pr
 	}
 	return selected
 }
-
-// GetProviderStatus 获取所有 provider 状态（用于调试）
-func (pm *ProviderManager) GetProviderStatus() []map[string]interface{} {
-	pm.mutex.RLock()
-	defer pm.mutex.RUnlock()
-
-	var status []map[string]interface{}
-
-	for _, ps := range pm.providers {
-		s := map[string]interface{}{
-			"name":          ps.Provider.Name,
-			"state":         ps.Provider.State,
-			"failure_count": ps.FailureCount,
-			"is_disabled":   ps.IsDisabled,
-		}
-
-		if !ps.DisabledUntil.IsZero() {
-			s["disabled_until"] = ps.DisabledUntil.Format("2006-01-02 15:04:05")
-		}
-
-		status = append(status, s)
-	}
-
-	return status
-}
@@ -0,0 +1,306 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+// RequestInfo 描述用于内容路由匹配的请求特征
+type RequestInfo struct {
+	Model           string      // 客户端请求的模型
+	HasTools        bool        // 是否携带 tools
+	HasImages       bool        // 是否包含图片
+	Thinking        bool        // 是否开启 thinking
+	EstimatedTokens int         // 估算的输入 token 数
+	MaxTokens       int         // 请求的 max_tokens，未设置时为 0
+	Headers         http.Header // 原始请求头
+	Provider        string      // 管理界面 playground 指定的 provider（通过请求上下文传入），非空时绕过路由规则和策略
+
+	ProviderModels map[string]string // 降级步骤为各 provider 指定的上游模型，覆盖 ANTHROPIC_MODEL
+}
+
+// MatchRoutingRule 按顺序返回第一条命中的路由规则，均未命中时返回 nil
+func MatchRoutingRule(rules []config.RoutingRule, info RequestInfo) *config.RoutingRule {
+	for i := range rules {
+		if ruleMatches(rules[i].Match, info) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// ruleMatches 检查请求是否满足规则的全部匹配条件
+func ruleMatches(m config.RuleMatch, info RequestInfo) bool {
+	if m.Model != "" && !wildcardMatch(m.Model, info.Model) {
+		return false
+	}
+	if m.HasTools != nil && *m.HasTools != info.HasTools {
+		return false
+	}
+	if m.HasImages != nil && *m.HasImages != info.HasImages {
+		return false
+	}
+	if m.Thinking != nil && *m.Thinking != info.Thinking {
+		return false
+	}
+	if m.MinTokens > 0 && info.EstimatedTokens < m.MinTokens {
+		return false
+	}
+	if m.MaxTokens > 0 && info.EstimatedTokens > m.MaxTokens {
+		return false
+	}
+	for key, pattern := range m.Headers {
+		if !wildcardMatch(pattern, info.Headers.Get(key)) {
+			return false
+		}
+	}
+	return true
+}
+
+// wildcardMatch 不区分大小写的通配匹配，* 匹配任意字符序列（包括 /）
+func wildcardMatch(pattern, value string) bool {
+	pattern = strings.ToLower(pattern)
+	value = strings.ToLower(value)
+
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	// 首段必须是前缀，末段必须是后缀，中间各段按顺序出现
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(value, part)
+		if idx < 0 {
+			return false
+		}
+		value = value[idx+len(part):]
+	}
+
+	return strings.HasSuffix(value, last)
+}
+
+// ResolveTarget 将规则目标解析为 provider 名称列表：优先匹配 provider 组，否则视为单个 provider
+func ResolveTarget(routing config.Routing, target string) []string {
+	if members, exists := routing.Groups[target]; exists {
+		return members
+	}
+	return []string{target}
+}
+
+// filterByNames 从可用 providers 中筛选出名称在列表中的 providers
+func filterByNames(providers []*ProviderState, names []string) []*ProviderState {
+	var filtered []*ProviderState
+	for _, ps := range providers {
+		for _, name := range names {
+			if ps.Provider.Name == name {
+				filtered = append(filtered, ps)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// ErrContextWindowExceeded 表示没有任何可用 provider 的上下文窗口能容纳该请求
+var ErrContextWindowExceeded = errors.New("请求超出所有可用 provider 的上下文窗口")
+
+// ErrBudgetExhausted 表示候选 providers 的预算均已耗尽
+var ErrBudgetExhausted = errors.New("可用 provider 的预算均已耗尽")
+
+// ErrUnknownProvider 表示请求指定的 provider 不存在
+var ErrUnknownProvider = errors.New("请求指定的 provider 不存在")
+
+// ErrProviderUnavailable 表示请求指定的 provider 缺少认证配置或已通过管理接口禁用
+var ErrProviderUnavailable = errors.New("请求指定的 provider 不可用")
+
+// filterByContextWindow 筛选出至少有一个候选模型（目标模型或备用模型）的上下文窗口能容纳请求输入和输出的 providers（未配置上下文窗口视为不限制）
+func filterByContextWindow(providers []*ProviderState, info RequestInfo) []*ProviderState {
+	var fitting []*ProviderState
+	for _, ps := range providers {
+		if len(FittingModels(ps.Provider, info)) == 0 {
+			logger.Debug(logger.ModuleProvider, "Provider %s 的模型 %s 上下文窗口均无法容纳约 %d tokens 的请求（含输出），跳过",
+				ps.Provider.Name, strings.Join(candidateModels(ps.Provider, info), ", "), requiredTokens(info, 0))
+			continue
+		}
+		fitting = append(fitting, ps)
+	}
+	return fitting
+}
+
+// candidateModels 返回 provider 处理请求时依次尝试的模型，降级步骤为该 provider 指定了上游模型时替换目标模型
+func candidateModels(p config.Provider, info RequestInfo) []string {
+	models := p.CandidateModels(info.Model)
+	downgraded := info.ProviderModels[p.Name]
+	if downgraded == "" {
+		return models
+	}
+
+	candidates := []string{downgraded}
+	for _, model := range models[1:] {
+		if model != downgraded {
+			candidates = append(candidates, model)
+		}
+	}
+	return candidates
+}
+
+// FittingModels 按尝试顺序返回 provider 的候选模型中上下文窗口能容纳请求输入和输出的模型
+func FittingModels(p config.Provider, info RequestInfo) []string {
+	var models []string
+	for _, model := range candidateModels(p, info) {
+		contextWindow, maxOutputTokens := p.LimitsFor(model)
+		if contextWindow > 0 && requiredTokens(info, maxOutputTokens) > contextWindow {
+			continue
+		}
+		models = append(models, model)
+	}
+	return models
+}
+
+// requiredTokens 返回请求在上下文窗口中需要的 token 数：估算的输入加上请求的输出
+// 输出按 provider 的输出上限截断（超出的 max_tokens 会被限制），未设置 max_tokens 时至少预留 1 个 token
+func requiredTokens(info RequestInfo, maxOutputTokens int) int {
+	output := info.MaxTokens
+	if maxOutputTokens > 0 && output > maxOutputTokens {
+		output = maxOutputTokens
+	}
+	if output < 1 {
+		output = 1
+	}
+	return info.EstimatedTokens + output
+}
+
+// largestContextWindow 返回候选 providers 的全部候选模型中最大的上下文窗口
+func largestContextWindow(providers []*ProviderState, info RequestInfo) int {
+	largest := 0
+	for _, ps := range providers {
+		for _, model := range candidateModels(ps.Provider, info) {
+			if contextWindow, _ := ps.Provider.LimitsFor(model); contextWindow > largest {
+				largest = contextWindow
+			}
+		}
+	}
+	return largest
+}
+
+// routingSample 用于路由预览的示例请求
+type routingSample struct {
+	label string
+	info  RequestInfo
+	rule  string // 为该规则生成的示例，预览时检查是否被前面的规则抢先命中
+}
+
+// defaultRoutingSamples 未指定示例请求时预览的常见请求
+var defaultRoutingSamples = []routingSample{
+	{label: "普通文本请求", info: RequestInfo{Model: "claude-sonnet-4-20250514", EstimatedTokens: 2000}},
+	{label: "携带 tools 的请求", info: RequestInfo{Model: "claude-sonnet-4-20250514", HasTools: true, EstimatedTokens: 20000}},
+	{label: "包含图片的请求", info: RequestInfo{Model: "claude-sonnet-4-20250514", HasTools: true, HasImages: true, EstimatedTokens: 20000}},
+	{label: "开启 thinking 的请求", info: RequestInfo{Model: "claude-opus-4-20250514", HasTools: true, Thinking: true, EstimatedTokens: 20000}},
+	{label: "长上下文请求", info: RequestInfo{Model: "claude-sonnet-4-20250514", HasTools: true, EstimatedTokens: 150000}},
+	{label: "后台 haiku 请求", info: RequestInfo{Model: "claude-3-5-haiku-20241022", EstimatedTokens: 500}},
+}
+
+// ruleSample 根据规则的匹配条件生成一个满足全部条件的示例请求
+// 通配符 * 按空字符串处理，token 数取下限（未设置下限时取上限）
+func ruleSample(rule config.RoutingRule) RequestInfo {
+	m := rule.Match
+	info := RequestInfo{
+		Model:           "claude-sonnet-4-20250514",
+		EstimatedTokens: 2000,
+		Headers:         http.Header{},
+	}
+	if m.Model != "" {
+		info.Model = strings.ReplaceAll(m.Model, "*", "")
+	}
+	if m.HasTools != nil {
+		info.HasTools = *m.HasTools
+	}
+	if m.HasImages != nil {
+		info.HasImages = *m.HasImages
+	}
+	if m.Thinking != nil {
+		info.Thinking = *m.Thinking
+	}
+	switch {
+	case m.MinTokens > 0:
+		info.EstimatedTokens = m.MinTokens
+	case m.MaxTokens > 0 && m.MaxTokens < info.EstimatedTokens:
+		info.EstimatedTokens = m.MaxTokens
+	}
+	for key, pattern := range m.Headers {
+		info.Headers.Set(key, strings.ReplaceAll(pattern, "*", ""))
+	}
+	return info
+}
+
+// DisplayRoutingPreview 显示示例请求的路由结果
+// sample 为 nil 时预览常见请求和为每条规则生成的示例请求，否则只预览 sample
+func DisplayRoutingPreview(cfg *config.Config, sample *RequestInfo) {
+	var samples []routingSample
+	if sample != nil {
+		samples = append(samples, routingSample{label: "指定的请求", info: *sample})
+	} else {
+		samples = append(samples, defaultRoutingSamples...)
+		for _, rule := range cfg.Routing.Rules {
+			samples = append(samples, routingSample{label: fmt.Sprintf("匹配规则 %s 的请求", rule.Name), info: ruleSample(rule), rule: rule.Name})
+		}
+	}
+
+	fmt.Printf("\n=== 路由预览 ===\n")
+	if len(cfg.Routing.Rules) == 0 {
+		fmt.Printf("未配置路由规则，所有请求按 %s 策略路由\n", cfg.Routing.Strategy)
+		return
+	}
+
+	for _, sample := range samples {
+		fmt.Printf("- %s (%s)\n", sample.label, describeSample(sample.info))
+
+		rule := MatchRoutingRule(cfg.Routing.Rules, sample.info)
+		if rule == nil {
+			fmt.Printf("    -> 未命中规则，按 %s 策略路由\n", cfg.Routing.Strategy)
+			continue
+		}
+		targets := ResolveTarget(cfg.Routing, rule.Target)
+		fmt.Printf("    -> 规则 %s，目标 %s: %s\n", rule.Name, rule.Target, strings.Join(targets, ", "))
+		if sample.rule != "" && rule.Name != sample.rule {
+			fmt.Printf("    注意: 该请求先命中了规则 %s，规则 %s 可能永远不会生效\n", rule.Name, sample.rule)
+		}
+	}
+}
+
+// describeSample 输出示例请求的模型、特征、token 数和请求头
+func describeSample(info RequestInfo) string {
+	features := []string{"model=" + info.Model}
+	if info.HasTools {
+		features = append(features, "tools")
+	}
+	if info.HasImages {
+		features = append(features, "images")
+	}
+	if info.Thinking {
+		features = append(features, "thinking")
+	}
+	features = append(features, fmt.Sprintf("~%d tokens", info.EstimatedTokens))
+
+	var keys []string
+	for key := range info.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		features = append(features, fmt.Sprintf("%s: %s", key, info.Headers.Get(key)))
+	}
+	return strings.Join(features, ", ")
+}
@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/usage"
+)
+
+func TestMatchRoutingRule(t *testing.T) {
+	yes := true
+	rules := []config.RoutingRule{
+		{Name: "vision", Match: config.RuleMatch{HasImages: &yes}, Target: "vision"},
+		{Name: "reasoning", Match: config.RuleMatch{Thinking: &yes}, Target: "reasoner"},
+		{Name: "haiku", Match: config.RuleMatch{Model: "claude-*haiku*"}, Target: "cheap"},
+		{Name: "long", Match: config.RuleMatch{MinTokens: 100000}, Target: "long-context"},
+		{Name: "header", Match: config.RuleMatch{Headers: map[string]string{"X-Team": "infra-*"}}, Target: "infra"},
+	}
+
+	header := http.Header{}
+	header.Set("X-Team", "Infra-Core")
+
+	tests := []struct {
+		name string
+		info RequestInfo
+		want string
+	}{
+		{"images", RequestInfo{HasImages: true, Thinking: true}, "vision"},
+		{"thinking", RequestInfo{Thinking: true}, "reasoning"},
+		{"model wildcard", RequestInfo{Model: "claude-3-5-haiku-20241022"}, "haiku"},
+		{"tokens", RequestInfo{Model: "claude-sonnet-4", EstimatedTokens: 150000}, "long"},
+		{"header", RequestInfo{Headers: header}, "header"},
+		{"no match", RequestInfo{Model: "claude-sonnet-4", EstimatedTokens: 1000}, ""},
+	}
+
+	for _, tt := range tests {
+		rule := MatchRoutingRule(rules, tt.info)
+		got := ""
+		if rule != nil {
+			got = rule.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s: got rule %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRuleSample(t *testing.T) {
+	yes, no := true, false
+	rules := []config.RoutingRule{
+		{Name: "haiku", Match: config.RuleMatch{Model: "claude-*haiku*"}},
+		{Name: "plain", Match: config.RuleMatch{HasTools: &no, Thinking: &yes}},
+		{Name: "long", Match: config.RuleMatch{HasImages: &yes, MinTokens: 100000}},
+		{Name: "short", Match: config.RuleMatch{MaxTokens: 500}},
+		{Name: "header", Match: config.RuleMatch{Headers: map[string]string{"X-Team": "infra-*", "User-Agent": "*cli*"}}},
+	}
+
+	for _, rule := range rules {
+		if info := ruleSample(rule); !ruleMatches(rule.Match, info) {
+			t.Errorf("%s: sample %+v does not match its rule", rule.Name, info)
+		}
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	routing := config.Routing{Groups: map[string][]string{"vision": {"a", "b"}}}
+
+	if got := ResolveTarget(routing, "vision"); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("group target resolved to %v", got)
+	}
+	if got := ResolveTarget(routing, "c"); len(got) != 1 || got[0] != "c" {
+		t.Errorf("provider target resolved to %v", got)
+	}
+}
+
+func TestFilterByContextWindow(t *testing.T) {
+	small := &ProviderState{Provider: config.Provider{Name: "small", ContextWindow: 10000, MaxOutputTokens: 4000}}
+	large := &ProviderState{Provider: config.Provider{Name: "large", ContextWindow: 200000}}
+	unlimited := &ProviderState{Provider: config.Provider{Name: "unlimited"}}
+	providers := []*ProviderState{small, large, unlimited}
+
+	tests := []struct {
+		name string
+		info RequestInfo
+		want []string
+	}{
+		{"fits all", RequestInfo{EstimatedTokens: 5000, MaxTokens: 1000}, []string{"small", "large", "unlimited"}},
+		{"input exceeds", RequestInfo{EstimatedTokens: 10000}, []string{"large", "unlimited"}},
+		{"input plus output exceeds", RequestInfo{EstimatedTokens: 8000, MaxTokens: 3000}, []string{"large", "unlimited"}},
+		{"output clamped to provider limit", RequestInfo{EstimatedTokens: 6000, MaxTokens: 32000}, []string{"small", "large", "unlimited"}},
+		{"exceeds all limited", RequestInfo{EstimatedTokens: 190000, MaxTokens: 20000}, []string{"unlimited"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, ps := range filterByContextWindow(providers, tt.info) {
+			got = append(got, ps.Provider.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFittingModels(t *testing.T) {
+	p := config.Provider{
+		Name:           "p",
+		Env:            map[string]string{"ANTHROPIC_MODEL": "primary"},
+		FallbackModels: []string{"fallback-64k", "fallback-128k"},
+		ContextWindow:  200000,
+		ModelLimits: map[string]config.ModelLimit{
+			"fallback-64k":  {ContextWindow: 64000},
+			"fallback-128k": {ContextWindow: 128000},
+		},
+	}
+	small := config.Provider{Name: "small", ContextWindow: 64000, FallbackModels: []string{"large"},
+		ModelLimits: map[string]config.ModelLimit{"large": {ContextWindow: 128000}}}
+
+	tests := []struct {
+		name     string
+		provider config.Provider
+		tokens   int
+		want     []string
+	}{
+		{"all fit", p, 30000, []string{"primary", "fallback-64k", "fallback-128k"}},
+		{"primary fits, fallback does not", p, 100000, []string{"primary", "fallback-128k"}},
+		{"only primary fits", p, 150000, []string{"primary"}},
+		{"only fallback fits", small, 100000, []string{"large"}},
+	}
+
+	for _, tt := range tests {
+		info := RequestInfo{Model: "claude-sonnet-4", EstimatedTokens: tt.tokens, MaxTokens: 1000}
+		if got := FittingModels(tt.provider, info); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// 有任一候选模型能容纳请求时保留 provider
+	info := RequestInfo{Model: "claude-sonnet-4", EstimatedTokens: 100000}
+	if got := filterByContextWindow([]*ProviderState{{Provider: small}}, info); len(got) != 1 {
+		t.Errorf("provider with a fitting fallback filtered out")
+	}
+	if got := largestContextWindow([]*ProviderState{{Provider: small}}, info); got != 128000 {
+		t.Errorf("largest context window = %d, want 128000", got)
+	}
+}
+
+func TestDowngradeModel(t *testing.T) {
+	pm := NewProviderManager(&config.Config{
+		Routing: config.Routing{
+			Strategy: "default",
+			Downgrade: []config.DowngradeStep{
+				{From: "claude-opus-*", To: "claude-sonnet-4-20250514"},
+				{From: "claude-sonnet-*", To: "claude-3-5-haiku-20241022"},
+				{From: "claude-3-5-haiku-*", To: ""},
+			},
+		},
+	})
+
+	tests := []struct {
+		model  string
+		want   string
+		wantOK bool
+	}{
+		{"claude-opus-4-20250514", "claude-sonnet-4-20250514", true},
+		{"Claude-Sonnet-4-20250514", "claude-3-5-haiku-20241022", true},
+		{"claude-3-5-haiku-20241022", "", false},
+		{"gpt-4o", "", false},
+	}
+
+	for _, tt := range tests {
+		step, ok := pm.DowngradeModel(tt.model)
+		if step.To != tt.want || ok != tt.wantOK {
+			t.Errorf("DowngradeModel(%s) = %q, %v; want %q, %v", tt.model, step.To, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestBudgetExhaustedError(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	pm := NewProviderManager(&config.Config{
+		Routing: config.Routing{Strategy: "default"},
+		Providers: []config.Provider{
+			{Name: "a", State: "on", Env: map[string]string{"ANTHROPIC_API_KEY": "key-a"}, Budget: &config.BudgetLimit{DailyTokens: 100}},
+			{Name: "b", State: "on", Env: map[string]string{"ANTHROPIC_API_KEY": "key-b"}},
+		},
+	})
+	defer pm.Close()
+
+	pm.RecordUsage("a", usage.Usage{InputTokens: 100})
+	if ps, err := pm.GetProviderForRequest(RequestInfo{}, nil); err != nil || ps.Provider.Name != "b" {
+		t.Fatalf("ps = %v, err = %v", ps, err)
+	}
+
+	// 其他 provider 因失败被排除后，剩下的只因预算耗尽不可用
+	_, err := pm.GetProviderForRequest(RequestInfo{}, map[string]bool{"b": true})
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("err = %v, want ErrBudgetExhausted", err)
+	}
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"sort"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+// recentLatencySamples 每个 provider 保留的最近响应耗时样本数
+const recentLatencySamples = 50
+
+// 熔断状态
+const (
+	BreakerClosed = "closed" // 正常接收请求
+	BreakerOpen   = "open"   // 连续失败后暂时禁用，到期自动恢复
+)
+
+// LatencyStatus 最近的上游响应耗时统计（毫秒）
+type LatencyStatus struct {
+	Samples int   `json:"samples"`
+	LastMS  int64 `json:"last_ms"`
+	AvgMS   int64 `json:"avg_ms"`
+	P50MS   int64 `json:"p50_ms"`
+	P90MS   int64 `json:"p90_ms"`
+	MaxMS   int64 `json:"max_ms"`
+}
+
+// ProviderStatus provider 的运行时状态快照，用于管理接口
+type ProviderStatus struct {
+	Name            string        `json:"name"`
+	State           string        `json:"state"`     // 配置中的状态 on/off
+	Available       bool          `json:"available"` // 当前是否参与路由
+	Forced          bool          `json:"forced"`    // 是否被临时强制为唯一目标
+	BaseURL         string        `json:"base_url"`
+	FailureCount    int           `json:"failure_count"`
+	IsDisabled      bool          `json:"is_disabled"`
+	DisabledUntil   *time.Time    `json:"disabled_until,omitempty"`
+	Breaker         string        `json:"breaker"`
+	BudgetExhausted bool          `json:"budget_exhausted"`
+	LastFailureTime *time.Time    `json:"last_failure_time,omitempty"`
+	LastError       string        `json:"last_error,omitempty"`
+	Latency         LatencyStatus `json:"latency"`
+}
+
+// RoutingStrategy 返回当前的路由策略
+func (pm *ProviderManager) RoutingStrategy() string {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	return pm.routingStrategy
+}
+
+// GetProviderStatus 获取所有 provider 的状态，按配置顺序排列
+func (pm *ProviderManager) GetProviderStatus() []ProviderStatus {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	// 先恢复禁用期已结束的 provider，避免返回过期的熔断状态
+	pm.updateProviderStates()
+	pm.activeForced()
+
+	status := make([]ProviderStatus, 0, len(pm.providers))
+	for _, ps := range pm.providers {
+		status = append(status, pm.statusOf(ps))
+	}
+	return status
+}
+
+// GetProvider 获取指定 provider 的状态，不存在时返回 false
+func (pm *ProviderManager) GetProvider(name string) (ProviderStatus, bool) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	pm.updateProviderStates()
+	pm.activeForced()
+
+	ps := pm.findProvider(name)
+	if ps == nil {
+		return ProviderStatus{}, false
+	}
+	return pm.statusOf(ps), true
+}
+
+// statusOf 生成 provider 的状态快照，调用方需持有锁
+func (pm *ProviderManager) statusOf(ps *ProviderState) ProviderStatus {
+	s := ProviderStatus{
+		Name:            ps.Provider.Name,
+		State:           ps.Provider.State,
+		BaseURL:         ps.Provider.Env["ANTHROPIC_BASE_URL"],
+		FailureCount:    ps.FailureCount,
+		IsDisabled:      ps.IsDisabled,
+		Breaker:         BreakerClosed,
+		BudgetExhausted: pm.budget.ProviderExhausted(ps.Provider.Name),
+		LastError:       logger.Redact(ps.LastError),
+		Latency:         latencyStatus(ps),
+	}
+	s.Available = s.State == "on" && !s.IsDisabled && !s.BudgetExhausted
+	s.Forced = ps == pm.forced
+
+	if !ps.DisabledUntil.IsZero() {
+		disabledUntil := ps.DisabledUntil
+		s.DisabledUntil = &disabledUntil
+		if ps.IsDisabled {
+			s.Breaker = BreakerOpen
+		}
+	}
+	if !ps.LastFailureTime.IsZero() {
+		lastFailure := ps.LastFailureTime
+		s.LastFailureTime = &lastFailure
+	}
+	return s
+}
+
+// latencyStatus 汇总 provider 最近的响应耗时
+func latencyStatus(ps *ProviderState) LatencyStatus {
+	n := len(ps.latencies)
+	if n == 0 {
+		return LatencyStatus{}
+	}
+
+	// 环形缓冲写满后，最新的样本在 latencyIndex 之前
+	last := ps.latencies[n-1]
+	if n == recentLatencySamples {
+		last = ps.latencies[(ps.latencyIndex+n-1)%n]
+	}
+
+	sorted := append([]time.Duration(nil), ps.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return LatencyStatus{
+		Samples: n,
+		LastMS:  last.Milliseconds(),
+		AvgMS:   (total / time.Duration(n)).Milliseconds(),
+		P50MS:   percentile(sorted, 50).Milliseconds(),
+		P90MS:   percentile(sorted, 90).Milliseconds(),
+		MaxMS:   sorted[n-1].Milliseconds(),
+	}
+}
+
+// percentile 返回已排序样本的 p 分位数（0-100），采用最近秩法
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+)
+
+func TestGetProviderStatus(t *testing.T) {
+	pm := NewProviderManager(&config.Config{
+		Routing: config.Routing{Strategy: "default"},
+		Providers: []config.Provider{
+			{Name: "a", State: "on", Env: map[string]string{"ANTHROPIC_BASE_URL": "https://a.example.com", "ANTHROPIC_AUTH_TOKEN": "token-a"}},
+			{Name: "b", State: "off", Env: map[string]string{"ANTHROPIC_API_KEY": "key-b"}},
+		},
+	})
+
+	for i := 1; i <= recentLatencySamples+10; i++ {
+		pm.RecordLatency("a", time.Duration(i)*time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		pm.RecordFailure("a", "服务器错误: 502 Bad Gateway")
+	}
+
+	status := pm.GetProviderStatus()
+	if len(status) != 2 || status[0].Name != "a" || status[1].Name != "b" {
+		t.Fatalf("GetProviderStatus() = %+v", status)
+	}
+
+	a := status[0]
+	if a.Breaker != BreakerOpen || a.Available || a.FailureCount != 5 || a.DisabledUntil == nil {
+		t.Errorf("provider a = %+v, want open breaker after 5 failures", a)
+	}
+	if a.LastError != "服务器错误: 502 Bad Gateway" || a.LastFailureTime == nil {
+		t.Errorf("provider a last error = %q", a.LastError)
+	}
+	// 只保留最近 recentLatencySamples 个样本：11ms..60ms
+	want := LatencyStatus{Samples: recentLatencySamples, LastMS: 60, AvgMS: 35, P50MS: 35, P90MS: 55, MaxMS: 60}
+	if a.Latency != want {
+		t.Errorf("provider a latency = %+v, want %+v", a.Latency, want)
+	}
+
+	b, exists := pm.GetProvider("b")
+	if !exists || b.Breaker != BreakerClosed || b.Available || b.Latency.Samples != 0 {
+		t.Errorf("GetProvider(b) = %+v, %v", b, exists)
+	}
+	if _, exists := pm.GetProvider("missing"); exists {
+		t.Error("GetProvider(missing) should not exist")
+	}
+}
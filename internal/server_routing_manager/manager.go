@@ -2,18 +2,26 @@ package server_routing_manager
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/imty42/claude-code-env/internal/admin"
+	"github.com/imty42/claude-code-env/internal/capture"
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/history"
 	"github.com/imty42/claude-code-env/internal/llm_proxy"
 	"github.com/imty42/claude-code-env/internal/logger"
 	"github.com/imty42/claude-code-env/internal/provider"
+	"github.com/imty42/claude-code-env/internal/tracing"
 )
 
 // ServerRoutingManager 服务路由管理器 - 管理 LLMProxyServer 和 AdminServer 的生命周期
 type ServerRoutingManager struct {
-	llmServer   *llm_proxy.LLMProxyServer
-	adminServer *admin.AdminServer
+	providerManager *provider.ProviderManager
+	llmServer       *llm_proxy.LLMProxyServer
+	adminServer     *admin.AdminServer
+	shutdownOnce    sync.Once
+	shutdownErr     error
 	
 	// 配置参数
 	host      string
@@ -22,21 +30,31 @@ type ServerRoutingManager struct {
 }
 
 // NewServerRoutingManager 创建新的服务路由管理器
-func NewServerRoutingManager(providerManager *provider.ProviderManager, host string, apiPort, adminPort int, apiProxy string, timeout time.Duration) *ServerRoutingManager {
-	logger.Info(logger.ModuleProxy, "初始化服务路由管理器: LLM代理端口=%d, 管理端口=%d", apiPort, adminPort)
+func NewServerRoutingManager(providerManager *provider.ProviderManager, cfg *config.Config) *ServerRoutingManager {
+	logger.Info(logger.ModuleProxy, "初始化服务路由管理器: LLM代理端口=%d, 管理端口=%d", cfg.LLMProxyPort, cfg.AdminPort)
 	
+	// 按配置启用或关闭链路追踪（导出器全局共享，配置未变化时保持不变）
+	tracing.Configure(cfg.Tracing)
+
+	// 按配置启用或关闭请求抓包（配置未变化时保持运行时开关）
+	capture.Configure(cfg.DebugWire)
+
+	// 按配置调整最近请求记录的容量（保留已有记录）
+	history.Configure(cfg.RecentRequests)
+
 	// 创建 LLM API 服务器
-	llmServer := llm_proxy.NewLLMProxyServer(providerManager, host, apiPort, apiProxy, timeout)
+	llmServer := llm_proxy.NewLLMProxyServer(providerManager, cfg)
 	
 	// 创建管理服务器
-	adminServer := admin.NewAdminServer(host, adminPort)
+	adminServer := admin.NewAdminServer(providerManager, llmServer, cfg)
 	
 	manager := &ServerRoutingManager{
-		llmServer:   llmServer,
-		adminServer: adminServer,
-		host:        host,
-		apiPort:     apiPort,
-		adminPort:   adminPort,
+		providerManager: providerManager,
+		llmServer:       llmServer,
+		adminServer:     adminServer,
+		host:            cfg.CCEnvHost,
+		apiPort:         cfg.LLMProxyPort,
+		adminPort:       cfg.AdminPort,
 	}
 	
 	return manager
@@ -65,8 +83,14 @@ func (s *ServerRoutingManager) Start() error {
 	return nil
 }
 
-// Shutdown 关闭所有服务
+// Shutdown 关闭所有服务，重复调用时直接返回第一次关闭的结果
 func (s *ServerRoutingManager) Shutdown() error {
+	s.shutdownOnce.Do(func() { s.shutdownErr = s.shutdown() })
+	return s.shutdownErr
+}
+
+// shutdown 并行关闭两个服务器，之后写入预算用量并导出追踪数据
+func (s *ServerRoutingManager) shutdown() error {
 	logger.Info(logger.ModuleProxy, "关闭服务路由管理器...")
 	
 	var llmErr, adminErr error
@@ -95,6 +119,12 @@ func (s *ServerRoutingManager) Shutdown() error {
 	// 等待两个服务器都关闭
 	<-done
 	<-done
+
+	// 请求均已结束，写入未保存的预算用量
+	s.providerManager.Close()
+
+	// 导出已结束请求的追踪数据
+	tracing.Flush(2 * time.Second)
 	
 	// 如果有任何一个关闭失败，返回错误
 	if llmErr != nil {
@@ -0,0 +1,33 @@
+package timeparse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"30m", now.Add(-30 * time.Minute), false},
+		{"24h", now.Add(-24 * time.Hour), false},
+		{"7d", now.AddDate(0, 0, -7), false},
+		{"2026-03-01", time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), false},
+		{"2026-03-01 10:00", time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local), false},
+		{"2026-03-01T10:00:05", time.Date(2026, 3, 1, 10, 0, 5, 0, time.Local), false},
+		{"yesterday", time.Time{}, true},
+		{"-1d", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("Parse(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
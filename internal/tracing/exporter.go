@@ -0,0 +1,292 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"github.com/imty42/claude-code-env/internal/logger"
+)
+
+const (
+	maxQueueSize  = 2048            // 待导出 span 的最大数量，超过时丢弃新的 span
+	maxBatchSize  = 512             // 单次导出的最大 span 数
+	flushInterval = 5 * time.Second // 定时导出间隔
+)
+
+// exporter 以 OTLP/HTTP JSON 或 OTLP/gRPC 格式批量导出 span
+type exporter struct {
+	cfg     config.Tracing
+	url     string
+	client  *http.Client
+	queue   chan *Span
+	flush   chan chan struct{}
+	stop    chan struct{}
+	dropped atomic.Int64 // 队列已满时丢弃的 span 数
+}
+
+// global 当前生效的导出器，配置重载时替换
+var global struct {
+	exporter *exporter
+	mutex    sync.RWMutex
+}
+
+// current 返回当前导出器，未启用追踪时返回 nil
+func current() *exporter {
+	global.mutex.RLock()
+	defer global.mutex.RUnlock()
+	return global.exporter
+}
+
+// Configure 按配置启用、更新或关闭链路追踪，配置未变化时保持当前导出器
+func Configure(cfg config.Tracing) {
+	global.mutex.Lock()
+	defer global.mutex.Unlock()
+
+	old := global.exporter
+	if old != nil && reflect.DeepEqual(old.cfg, cfg) {
+		return
+	}
+
+	global.exporter = nil
+	if cfg.Enabled {
+		global.exporter = newExporter(cfg)
+		logger.Info(logger.ModuleServer, "链路追踪已启用，OTLP 导出地址: %s", global.exporter.url)
+	}
+
+	// 旧导出器在后台导出剩余 span 后退出
+	if old != nil {
+		close(old.stop)
+	}
+}
+
+// Flush 导出所有待导出的 span，最多等待 timeout
+func Flush(timeout time.Duration) {
+	exp := current()
+	if exp == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	select {
+	case exp.flush <- done:
+	case <-time.After(timeout):
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// newExporter 创建导出器并启动后台导出协程
+func newExporter(cfg config.Tracing) *exporter {
+	exp := &exporter{
+		cfg:   cfg,
+		queue: make(chan *Span, maxQueueSize),
+		flush: make(chan chan struct{}),
+		stop:  make(chan struct{}),
+	}
+
+	if cfg.Protocol == "grpc" {
+		exp.url = grpcEndpoint(cfg.Endpoint)
+		exp.client = newGRPCClient(strings.HasPrefix(exp.url, "https://"))
+	} else {
+		exp.url = strings.TrimRight(cfg.Endpoint, "/")
+		if !strings.HasSuffix(exp.url, "/v1/traces") {
+			exp.url += "/v1/traces"
+		}
+		exp.client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	go exp.run()
+	return exp
+}
+
+// enqueue 提交 span，队列已满时丢弃，不阻塞请求处理
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// run 定时或在批次满时导出 span
+func (e *exporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	export := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = nil
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case span := <-e.queue:
+				batch = append(batch, span)
+				if len(batch) >= maxBatchSize {
+					export()
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-e.flush:
+			drain()
+			export()
+			close(done)
+		case <-e.stop:
+			drain()
+			export()
+			return
+		}
+	}
+}
+
+// export 将一批 span 发送到 OTLP 接收端
+func (e *exporter) export(spans []*Span) {
+	var err error
+	if e.cfg.Protocol == "grpc" {
+		err = e.exportGRPC(spans)
+	} else {
+		err = e.exportHTTP(spans)
+	}
+	if err != nil {
+		logger.Warn(logger.ModuleServer, "导出 %d 个 span 失败: %v", len(spans), err)
+		return
+	}
+
+	if dropped := e.dropped.Swap(0); dropped > 0 {
+		logger.Warn(logger.ModuleServer, "追踪队列已满，丢弃了 %d 个 span", dropped)
+	}
+	logger.Debug(logger.ModuleServer, "已导出 %d 个 span", len(spans))
+}
+
+// exportHTTP 以 OTLP/HTTP JSON 格式发送一批 span
+func (e *exporter) exportHTTP(spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return fmt.Errorf("序列化追踪数据失败: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建追踪导出请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP 接收端返回 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// encode 按 OTLP/JSON 格式编码 span
+// 参考 opentelemetry-proto 的 JSON 映射：trace ID 和 span ID 使用十六进制字符串，64 位整数使用字符串
+func (e *exporter) encode(spans []*Span) map[string]interface{} {
+	encoded := make([]interface{}, 0, len(spans))
+	for _, span := range spans {
+		span.mutex.Lock()
+		s := map[string]interface{}{
+			"traceId":           hex.EncodeToString(span.traceID[:]),
+			"spanId":            hex.EncodeToString(span.spanID[:]),
+			"name":              span.name,
+			"kind":              int(span.kind),
+			"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+			"attributes":        encodeAttributes(span.attributes),
+		}
+		if span.parentSpanID != [8]byte{} {
+			s["parentSpanId"] = hex.EncodeToString(span.parentSpanID[:])
+		}
+		if len(span.events) > 0 {
+			events := make([]interface{}, 0, len(span.events))
+			for _, ev := range span.events {
+				events = append(events, map[string]interface{}{
+					"name":         ev.name,
+					"timeUnixNano": strconv.FormatInt(ev.time.UnixNano(), 10),
+					"attributes":   encodeAttributes(ev.attributes),
+				})
+			}
+			s["events"] = events
+		}
+		if span.hasError {
+			s["status"] = map[string]interface{}{"code": 2, "message": logger.Redact(span.errorMessage)}
+		}
+		span.mutex.Unlock()
+		encoded = append(encoded, s)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": encodeAttributes([]attribute{{key: "service.name", value: e.cfg.ServiceName}}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/imty42/claude-code-env"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+// encodeAttributes 按 OTLP/JSON 的 AnyValue 格式编码属性，字符串值会被脱敏
+func encodeAttributes(attributes []attribute) []interface{} {
+	encoded := make([]interface{}, 0, len(attributes))
+	for _, attr := range attributes {
+		var value map[string]interface{}
+		switch v := attr.value.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": logger.Redact(v)}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": attr.key, "value": value})
+	}
+	return encoded
+}
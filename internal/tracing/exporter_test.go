@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestExportToCollector(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("invalid OTLP JSON: %v", err)
+		}
+		received <- payload
+	}))
+	defer collector.Close()
+
+	Configure(config.Tracing{Enabled: true, Endpoint: collector.URL, ServiceName: "ccenv-test"})
+	defer Configure(config.Tracing{})
+
+	header := http.Header{}
+	header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	root := StartRequestSpan("POST /v1/messages", header)
+	child := root.StartChild("upstream test", KindClient)
+	child.AddEvent("first_token")
+	child.End()
+	root.End()
+	Flush(time.Second)
+
+	payload := <-received
+	spans := payload["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	exportedChild := spans[0].(map[string]interface{})
+	exportedRoot := spans[1].(map[string]interface{})
+	if exportedRoot["traceId"] != "0af7651916cd43dd8448eb211c80319c" || exportedRoot["parentSpanId"] != "b7ad6b7169203331" {
+		t.Errorf("root span did not continue incoming trace: %v", exportedRoot)
+	}
+	if exportedChild["parentSpanId"] != exportedRoot["spanId"] {
+		t.Errorf("child parent = %v, want %v", exportedChild["parentSpanId"], exportedRoot["spanId"])
+	}
+}
+
+func TestExportGRPC(t *testing.T) {
+	received := make(chan []byte, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != grpcExportPath || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("unexpected request %s %s %s", r.Proto, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("header not forwarded: %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Errorf("invalid gRPC message prefix: %x", body[:min(len(body), 5)])
+		}
+		received <- body[5:]
+
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Grpc-Status", "0")
+	})
+	collector := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer collector.Close()
+
+	Configure(config.Tracing{Enabled: true, Protocol: "grpc", Endpoint: collector.Listener.Addr().String(), ServiceName: "ccenv-test",
+		Headers: map[string]string{"Authorization": "Bearer secret"}})
+	defer Configure(config.Tracing{})
+
+	root := StartRequestSpan("POST /v1/messages", http.Header{})
+	root.SetAttribute("ccenv.attempts", 2)
+	child := root.StartChild("upstream test", KindClient)
+	child.SetError("boom")
+	child.End()
+	root.End()
+	Flush(time.Second)
+
+	// ExportTraceServiceRequest.resource_spans -> ResourceSpans.scope_spans -> ScopeSpans.spans
+	message := <-received
+	resourceSpans := protoFields(t, message)[1][0]
+	scopeSpans := protoFields(t, resourceSpans)[2][0]
+	spans := protoFields(t, scopeSpans)[2]
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	exportedChild, exportedRoot := protoFields(t, spans[0]), protoFields(t, spans[1])
+	if string(exportedRoot[5][0]) != "POST /v1/messages" || string(exportedChild[5][0]) != "upstream test" {
+		t.Errorf("span names = %q, %q", exportedRoot[5][0], exportedChild[5][0])
+	}
+	if hex.EncodeToString(exportedChild[4][0]) != hex.EncodeToString(exportedRoot[2][0]) {
+		t.Errorf("child parent = %x, want %x", exportedChild[4][0], exportedRoot[2][0])
+	}
+	if status := protoFields(t, exportedChild[15][0]); string(status[2][0]) != "boom" {
+		t.Errorf("status message = %q", status[2][0])
+	}
+}
+
+// protoFields 解析 protobuf 消息中的长度前缀字段，按字段编号返回，忽略 varint 和 fixed64 字段
+func protoFields(t *testing.T, data []byte) map[int][][]byte {
+	t.Helper()
+	fields := make(map[int][][]byte)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(data)
+			data = data[n:]
+		case 1:
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[n:n+int(length)])
+			data = data[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,206 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/imty42/claude-code-env/internal/logger"
+	"golang.org/x/net/http2"
+)
+
+// grpcExportPath OTLP/gRPC 链路追踪导出方法的路径
+const grpcExportPath = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+// grpcEndpoint 返回 OTLP/gRPC 导出地址，未指定协议时（如 127.0.0.1:4317）按不加密处理
+func grpcEndpoint(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	return strings.TrimRight(endpoint, "/") + grpcExportPath
+}
+
+// newGRPCClient 创建 HTTP/2 客户端，http:// 地址使用不加密的 HTTP/2（h2c），与 Collector 默认的 4317 端口一致
+func newGRPCClient(useTLS bool) *http.Client {
+	transport := &http2.Transport{}
+	if !useTLS {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+// exportGRPC 以 OTLP/gRPC 格式发送一批 span
+func (e *exporter) exportGRPC(spans []*Span) error {
+	// gRPC 消息前缀：1 字节压缩标记（不压缩）和 4 字节大端消息长度
+	message := e.encodeProto(spans)
+	body := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(message)))
+	body = append(body, message...)
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建追踪导出请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 读完响应体后才能拿到 trailer 中的 gRPC 状态
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OTLP 接收端返回 %d", resp.StatusCode)
+	}
+
+	// 出错时接收端可能只返回响应头（Trailers-Only），状态在响应头中
+	status, statusMessage := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, statusMessage = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if unescaped, err := url.PathUnescape(statusMessage); err == nil {
+			statusMessage = unescaped
+		}
+		return fmt.Errorf("OTLP 接收端返回 gRPC 状态 %s: %s", status, statusMessage)
+	}
+	return nil
+}
+
+// encodeProto 按 opentelemetry-proto 的 ExportTraceServiceRequest 编码 span，字段编号与 OTLP/JSON 的 encode 一一对应
+func (e *exporter) encodeProto(spans []*Span) []byte {
+	var request protoWriter
+	request.message(1, func(resourceSpans *protoWriter) { // ResourceSpans.resource_spans
+		resourceSpans.message(1, func(resource *protoWriter) { // Resource
+			writeProtoAttributes(resource, 1, []attribute{{key: "service.name", value: e.cfg.ServiceName}})
+		})
+		resourceSpans.message(2, func(scopeSpans *protoWriter) { // ScopeSpans
+			scopeSpans.message(1, func(scope *protoWriter) { // InstrumentationScope
+				scope.string(1, "github.com/imty42/claude-code-env")
+			})
+			for _, span := range spans {
+				scopeSpans.message(2, span.writeProto)
+			}
+		})
+	})
+	return request.buf
+}
+
+// writeProto 按 opentelemetry-proto 的 Span 编码 span
+func (span *Span) writeProto(w *protoWriter) {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	w.bytes(1, span.traceID[:])
+	w.bytes(2, span.spanID[:])
+	if span.parentSpanID != [8]byte{} {
+		w.bytes(4, span.parentSpanID[:])
+	}
+	w.string(5, span.name)
+	w.varint(6, uint64(span.kind))
+	w.fixed64(7, uint64(span.start.UnixNano()))
+	w.fixed64(8, uint64(span.end.UnixNano()))
+	writeProtoAttributes(w, 9, span.attributes)
+	for _, ev := range span.events {
+		w.message(11, func(event *protoWriter) {
+			event.fixed64(1, uint64(ev.time.UnixNano()))
+			event.string(2, ev.name)
+			writeProtoAttributes(event, 3, ev.attributes)
+		})
+	}
+	if span.hasError {
+		w.message(15, func(status *protoWriter) {
+			status.string(2, logger.Redact(span.errorMessage))
+			status.varint(3, 2) // STATUS_CODE_ERROR
+		})
+	}
+}
+
+// writeProtoAttributes 按 KeyValue 和 AnyValue 编码属性，字符串值会被脱敏
+func writeProtoAttributes(w *protoWriter, field int, attributes []attribute) {
+	for _, attr := range attributes {
+		w.message(field, func(kv *protoWriter) {
+			kv.string(1, attr.key)
+			kv.message(2, func(value *protoWriter) {
+				switch v := attr.value.(type) {
+				case string:
+					value.string(1, logger.Redact(v))
+				case bool:
+					if v {
+						value.varint(2, 1)
+					} else {
+						value.varint(2, 0)
+					}
+				case int:
+					value.varint(3, uint64(v))
+				case int64:
+					value.varint(3, uint64(v))
+				case float64:
+					value.fixed64(4, math.Float64bits(v))
+				default:
+					value.string(1, fmt.Sprint(v))
+				}
+			})
+		})
+	}
+}
+
+// protoWriter 最小的 protobuf 编码器，只支持导出 span 所需的 varint、fixed64 和长度前缀字段
+// 所有字段都会写出，AnyValue 的 oneof 字段即使为零值也需要出现
+type protoWriter struct {
+	buf []byte
+}
+
+// tag 写入字段编号和编码类型
+func (w *protoWriter) tag(field int, wireType int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wireType))
+}
+
+// varint 写入 varint 字段（整数、布尔值和枚举）
+func (w *protoWriter) varint(field int, v uint64) {
+	w.tag(field, 0)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+// fixed64 写入 fixed64 字段（时间戳和浮点数）
+func (w *protoWriter) fixed64(field int, v uint64) {
+	w.tag(field, 1)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, v)
+}
+
+// bytes 写入长度前缀字段
+func (w *protoWriter) bytes(field int, data []byte) {
+	w.tag(field, 2)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(data)))
+	w.buf = append(w.buf, data...)
+}
+
+// string 写入字符串字段
+func (w *protoWriter) string(field int, s string) {
+	w.bytes(field, []byte(s))
+}
+
+// message 写入嵌套消息字段
+func (w *protoWriter) message(field int, encode func(*protoWriter)) {
+	var nested protoWriter
+	encode(&nested)
+	w.bytes(field, nested.buf)
+}
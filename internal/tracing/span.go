@@ -0,0 +1,185 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind 表示 span 的类型，取值与 OTLP 一致
+type SpanKind int
+
+const (
+	KindServer SpanKind = 2 // 代理收到的请求
+	KindClient SpanKind = 3 // 代理发往上游的请求
+)
+
+// attribute 表示 span 或事件的属性
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// event 表示 span 中的事件
+type event struct {
+	name       string
+	time       time.Time
+	attributes []attribute
+}
+
+// Span 表示一次操作的追踪数据，未启用追踪时为 nil，所有方法都可以在 nil 上安全调用
+type Span struct {
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte
+	name         string
+	kind         SpanKind
+	start        time.Time
+	end          time.Time
+	attributes   []attribute
+	events       []event
+	errorMessage string
+	hasError     bool
+	ended        bool
+	exporter     *exporter
+	mutex        sync.Mutex
+}
+
+// StartRequestSpan 为代理收到的请求创建根 span，请求携带合法的 traceparent 时延续调用方的链路
+func StartRequestSpan(name string, header http.Header) *Span {
+	exp := current()
+	if exp == nil {
+		return nil
+	}
+
+	span := &Span{name: name, kind: KindServer, start: time.Now(), exporter: exp}
+	if traceID, parentID, ok := parseTraceparent(header.Get("traceparent")); ok {
+		span.traceID, span.parentSpanID = traceID, parentID
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+	return span
+}
+
+// StartChild 创建子 span
+func (s *Span) StartChild(name string, kind SpanKind) *Span {
+	if s == nil {
+		return nil
+	}
+
+	child := &Span{
+		traceID:      s.traceID,
+		parentSpanID: s.spanID,
+		name:         name,
+		kind:         kind,
+		start:        time.Now(),
+		exporter:     s.exporter,
+	}
+	rand.Read(child.spanID[:])
+	return child
+}
+
+// SetAttribute 设置属性，value 支持 string、bool、int、int64 和 float64
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.attributes {
+		if s.attributes[i].key == key {
+			s.attributes[i].value = value
+			return
+		}
+	}
+	s.attributes = append(s.attributes, attribute{key: key, value: value})
+}
+
+// AddEvent 添加事件，attrs 为交替的键和值
+func (s *Span) AddEvent(name string, attrs ...interface{}) {
+	if s == nil {
+		return
+	}
+
+	e := event{name: name, time: time.Now()}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if key, ok := attrs[i].(string); ok {
+			e.attributes = append(e.attributes, attribute{key: key, value: attrs[i+1]})
+		}
+	}
+
+	s.mutex.Lock()
+	s.events = append(s.events, e)
+	s.mutex.Unlock()
+}
+
+// SetError 将 span 标记为失败
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	s.hasError = true
+	s.errorMessage = message
+	s.mutex.Unlock()
+}
+
+// End 结束 span 并提交导出，重复调用只生效一次
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mutex.Unlock()
+
+	s.exporter.enqueue(s)
+}
+
+// Traceparent 返回用于向下游传递的 W3C traceparent 请求头
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// TraceID 返回十六进制的 trace ID，未启用追踪时返回空字符串
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// parseTraceparent 解析 W3C traceparent 请求头（version-traceid-parentid-flags）
+func parseTraceparent(value string) ([16]byte, [8]byte, bool) {
+	var traceID [16]byte
+	var parentID [8]byte
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, true
+}
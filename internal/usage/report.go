@@ -0,0 +1,140 @@
+package usage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// 支持的分组维度
+var groupKeys = map[string]func(Record) string{
+	"day":      func(r Record) string { return r.Timestamp.Local().Format("2006-01-02") },
+	"provider": func(r Record) string { return r.Provider },
+	"model":    func(r Record) string { return r.ServedModel },
+	"session":  func(r Record) string { return r.Session },
+}
+
+// Row 表示报表中的一行汇总
+type Row struct {
+	Key          string  `json:"key"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	Usage                // 各类 token 合计
+	TotalTokens  int     `json:"total_tokens"`
+	Cost         float64 `json:"cost"`
+	AvgLatencyMS int64   `json:"avg_latency_ms"`
+
+	latencySum int64
+}
+
+// Report 表示按维度汇总的用量报表
+type Report struct {
+	By    string `json:"by"`
+	Since string `json:"since,omitempty"`
+	Rows  []Row  `json:"rows"`
+	Total Row    `json:"total"`
+}
+
+// Summarize 按指定维度汇总用量记录，结果按键排序
+func Summarize(records []Record, by string) (*Report, error) {
+	keyFunc, exists := groupKeys[by]
+	if !exists {
+		return nil, fmt.Errorf("不支持的分组维度 %q，可选: day, provider, model, session", by)
+	}
+
+	rows := make(map[string]*Row)
+	total := &Row{Key: "total"}
+	for _, record := range records {
+		key := keyFunc(record)
+		if key == "" {
+			key = "<无>"
+		}
+		row, exists := rows[key]
+		if !exists {
+			row = &Row{Key: key}
+			rows[key] = row
+		}
+		row.add(record)
+		total.add(record)
+	}
+
+	report := &Report{By: by, Rows: make([]Row, 0, len(rows)), Total: total.finish()}
+	for _, row := range rows {
+		report.Rows = append(report.Rows, row.finish())
+	}
+	sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Key < report.Rows[j].Key })
+
+	return report, nil
+}
+
+// add 累加一条记录
+func (r *Row) add(record Record) {
+	r.Requests++
+	if record.StatusCode >= 400 {
+		r.Errors++
+	}
+	r.InputTokens += record.InputTokens
+	r.OutputTokens += record.OutputTokens
+	r.CacheCreationInputTokens += record.CacheCreationInputTokens
+	r.CacheReadInputTokens += record.CacheReadInputTokens
+	r.Cost += record.Cost
+	r.latencySum += record.LatencyMS
+}
+
+// finish 计算合计和平均值
+func (r *Row) finish() Row {
+	r.TotalTokens = r.Total()
+	if r.Requests > 0 {
+		r.AvgLatencyMS = r.latencySum / int64(r.Requests)
+	}
+	return *r
+}
+
+// WriteTable 以对齐的文本表格输出报表，最后一行为合计
+func (r *Report) WriteTable(w io.Writer) error {
+	total := r.Total
+	total.Key = "合计"
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t请求数\t错误数\t输入\t输出\t缓存写入\t缓存读取\t总tokens\t费用\t平均耗时(ms)\t\n", r.By)
+	for _, row := range append(r.Rows, total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%.4f\t%d\t\n",
+			row.Key, row.Requests, row.Errors, row.InputTokens, row.OutputTokens,
+			row.CacheCreationInputTokens, row.CacheReadInputTokens, row.TotalTokens, row.Cost, row.AvgLatencyMS)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON 以 JSON 格式输出报表
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV 以 CSV 格式输出报表，不包含合计行，便于导入表格软件核对
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{r.By, "requests", "errors", "input_tokens", "output_tokens",
+		"cache_creation_input_tokens", "cache_read_input_tokens", "total_tokens", "cost", "avg_latency_ms"})
+	for _, row := range r.Rows {
+		writer.Write([]string{
+			row.Key,
+			strconv.Itoa(row.Requests),
+			strconv.Itoa(row.Errors),
+			strconv.Itoa(row.InputTokens),
+			strconv.Itoa(row.OutputTokens),
+			strconv.Itoa(row.CacheCreationInputTokens),
+			strconv.Itoa(row.CacheReadInputTokens),
+			strconv.Itoa(row.TotalTokens),
+			strconv.FormatFloat(row.Cost, 'f', 6, 64),
+			strconv.FormatInt(row.AvgLatencyMS, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,41 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	records := []Record{
+		{Timestamp: day, Provider: "b", ServedModel: "m1", StatusCode: 200, LatencyMS: 100, Usage: Usage{InputTokens: 10, OutputTokens: 5}, Cost: 0.5},
+		{Timestamp: day, Provider: "a", ServedModel: "m1", StatusCode: 200, LatencyMS: 300, Usage: Usage{InputTokens: 20}, Cost: 1},
+		{Timestamp: day.AddDate(0, 0, 1), Provider: "a", ServedModel: "m2", StatusCode: 529, LatencyMS: 200},
+		// 本地拒绝的请求没有 provider
+		{Timestamp: day.AddDate(0, 0, 1), StatusCode: 402},
+	}
+
+	report, err := Summarize(records, "provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 3 || report.Rows[0].Key != "<无>" || report.Rows[1].Key != "a" || report.Rows[2].Key != "b" {
+		t.Fatalf("rows = %+v", report.Rows)
+	}
+	a := report.Rows[1]
+	if a.Requests != 2 || a.Errors != 1 || a.InputTokens != 20 || a.Cost != 1 || a.AvgLatencyMS != 250 {
+		t.Errorf("row a = %+v", a)
+	}
+	if report.Total.Requests != 4 || report.Total.Errors != 2 || report.Total.TotalTokens != 35 || report.Total.Cost != 1.5 {
+		t.Errorf("total = %+v", report.Total)
+	}
+
+	byDay, err := Summarize(records, "day")
+	if err != nil || len(byDay.Rows) != 2 || byDay.Rows[0].Key != "2026-03-10" || byDay.Rows[1].Requests != 2 {
+		t.Errorf("by day = %+v, err = %v", byDay, err)
+	}
+
+	if _, err := Summarize(records, "hour"); err == nil {
+		t.Error("unsupported dimension should fail")
+	}
+}
@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record 表示一次完成的请求的用量记录
+type Record struct {
+	Timestamp         time.Time `json:"timestamp"`
+	RequestID         string    `json:"request_id"`
+	UpstreamRequestID string    `json:"upstream_request_id,omitempty"` // 上游返回的请求ID
+	Provider          string    `json:"provider"`
+	RequestedModel    string    `json:"requested_model"`
+	ServedModel       string    `json:"served_model"`
+	Session           string    `json:"session,omitempty"`
+	StatusCode        int       `json:"status"`
+	LatencyMS         int64     `json:"latency_ms"`
+	Usage
+	Cost float64 `json:"cost"` // 按记录时的价格计算，价格调整不影响历史记录
+}
+
+// Store 用量记录存储，以 JSON Lines 格式追加写入 ~/.claude-code-env/usage.jsonl
+type Store struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// DefaultStorePath 返回默认的用量记录文件路径
+func DefaultStorePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户主目录失败: %v", err)
+	}
+	return filepath.Join(homeDir, ".claude-code-env", "usage.jsonl"), nil
+}
+
+// NewStore 创建用量记录存储
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Append 追加一条用量记录
+func (s *Store) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("序列化用量记录失败: %v", err)
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开用量记录文件失败: %v", err)
+	}
+	defer file.Close()
+
+	// 单次 write 追加整行，配置重载期间新旧代理服务器同时写入也不会交错
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("写入用量记录失败: %v", err)
+	}
+	return nil
+}
+
+// Load 读取 since 之后（含）的所有用量记录，since 为零值时读取全部，无法解析的行会被跳过
+func (s *Store) Load(since time.Time) ([]Record, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("打开用量记录文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if json.Unmarshal(scanner.Bytes(), &record) != nil {
+			continue
+		}
+		if !since.IsZero() && record.Timestamp.Before(since) {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取用量记录文件失败: %v", err)
+	}
+
+	return records, nil
+}
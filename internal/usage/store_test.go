@@ -0,0 +1,50 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreAppendLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	store := NewStore(path)
+
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Timestamp: start, RequestID: "a", Provider: "p", StatusCode: 200, Usage: Usage{InputTokens: 10}},
+		{Timestamp: start.Add(time.Hour), RequestID: "b", StatusCode: 402},
+		{Timestamp: start.Add(2 * time.Hour), RequestID: "c", Provider: "p", StatusCode: 200},
+	}
+	for _, record := range records {
+		if err := store.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 损坏的行会被跳过
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("not json\n")
+	file.Close()
+
+	all, err := store.Load(time.Time{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("Load all = %d records, err = %v", len(all), err)
+	}
+	if all[0].InputTokens != 10 || all[1].StatusCode != 402 {
+		t.Errorf("loaded records = %+v", all)
+	}
+
+	recent, err := store.Load(start.Add(time.Hour))
+	if err != nil || len(recent) != 2 || recent[0].RequestID != "b" {
+		t.Errorf("Load since = %+v, err = %v", recent, err)
+	}
+
+	if missing, err := NewStore(filepath.Join(t.TempDir(), "missing.jsonl")).Load(time.Time{}); err != nil || missing != nil {
+		t.Errorf("missing file: %v, %v", missing, err)
+	}
+}
@@ -0,0 +1,62 @@
+package usage
+
+import (
+	"github.com/imty42/claude-code-env/internal/config"
+)
+
+// Usage 表示一次请求的 token 用量
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// Total 返回总 token 数（包括缓存读写）
+func (u Usage) Total() int {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// IsZero 判断是否没有任何用量
+func (u Usage) IsZero() bool {
+	return u.Total() == 0
+}
+
+// Merge 合并响应中的用量字段：非零值覆盖已有值
+// 流式响应中 message_start 和 message_delta 都会携带 usage，后者的 output_tokens 是累计值
+func (u *Usage) Merge(fields map[string]interface{}) {
+	mergeField(&u.InputTokens, fields["input_tokens"])
+	mergeField(&u.OutputTokens, fields["output_tokens"])
+	mergeField(&u.CacheCreationInputTokens, fields["cache_creation_input_tokens"])
+	mergeField(&u.CacheReadInputTokens, fields["cache_read_input_tokens"])
+}
+
+// mergeField 用 JSON 数值覆盖计数
+func mergeField(target *int, value interface{}) {
+	if number, ok := value.(float64); ok && number > 0 {
+		*target = int(number)
+	}
+}
+
+// Cost 按价格计算用量费用，未配置价格时返回 0；未单独配置缓存价格时按输入价格计算
+func Cost(pricing *config.Pricing, u Usage) float64 {
+	if pricing == nil {
+		return 0
+	}
+
+	cacheWrite := pricing.CacheWritePerMTok
+	if cacheWrite == 0 {
+		cacheWrite = pricing.InputPerMTok
+	}
+	cacheRead := pricing.CacheReadPerMTok
+	if cacheRead == 0 {
+		cacheRead = pricing.InputPerMTok
+	}
+
+	cost := float64(u.InputTokens)*pricing.InputPerMTok +
+		float64(u.OutputTokens)*pricing.OutputPerMTok +
+		float64(u.CacheCreationInputTokens)*cacheWrite +
+		float64(u.CacheReadInputTokens)*cacheRead
+
+	return cost / 1000000
+}
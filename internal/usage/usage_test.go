@@ -0,0 +1,43 @@
+package usage
+
+import (
+	"math"
+	"testing"
+
+	"github.com/imty42/claude-code-env/internal/config"
+)
+
+func TestMerge(t *testing.T) {
+	var u Usage
+	// message_start 携带输入用量，message_delta 携带累计的输出用量
+	u.Merge(map[string]interface{}{"input_tokens": 100.0, "output_tokens": 1.0, "cache_read_input_tokens": 50.0})
+	u.Merge(map[string]interface{}{"output_tokens": 42.0, "input_tokens": 0.0})
+
+	want := Usage{InputTokens: 100, OutputTokens: 42, CacheReadInputTokens: 50}
+	if u != want {
+		t.Errorf("merged usage = %+v, want %+v", u, want)
+	}
+	if u.Total() != 192 || u.IsZero() {
+		t.Errorf("Total() = %d, IsZero() = %v", u.Total(), u.IsZero())
+	}
+}
+
+func TestCost(t *testing.T) {
+	u := Usage{InputTokens: 1000000, OutputTokens: 500000, CacheCreationInputTokens: 200000, CacheReadInputTokens: 1000000}
+
+	tests := []struct {
+		name    string
+		pricing *config.Pricing
+		want    float64
+	}{
+		{"no pricing", nil, 0},
+		{"cache priced as input", &config.Pricing{InputPerMTok: 3, OutputPerMTok: 15}, 3 + 7.5 + 0.6 + 3},
+		{"cache priced separately", &config.Pricing{InputPerMTok: 3, OutputPerMTok: 15, CacheWritePerMTok: 3.75, CacheReadPerMTok: 0.3}, 3 + 7.5 + 0.75 + 0.3},
+	}
+
+	for _, tt := range tests {
+		if got := Cost(tt.pricing, u); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: Cost = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}